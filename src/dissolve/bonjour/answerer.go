@@ -2,10 +2,13 @@ package bonjour
 
 import (
 	"context"
+	"net"
+	"strings"
 	"sync"
 
 	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
 	"github.com/jmalloc/dissolve/src/dissolve/names"
 	"github.com/jmalloc/dissolve/src/dissolve/resolver"
 )
@@ -13,11 +16,20 @@ import (
 // Answerer is an mDNS answerer that answers questions about DNS-SD services,
 // thus making a Bonjour server.
 type Answerer struct {
+	// Resolver is used to find the addresses of target hosts that do not
+	// refer to this machine. If it is nil, net.DefaultResolver is used.
 	Resolver resolver.Resolver
 
+	// Network is used to find the addresses of the interfaces on which
+	// questions are received, for target hosts that refer to this machine. It
+	// must be the same network that is used by the responder. If it is nil,
+	// the host's network interfaces are used.
+	Network transport.Network
+
 	m         sync.RWMutex
 	domains   dnssd.DomainCollection
 	answerers map[names.FQDN]responder.Answerer
+	observers []func()
 }
 
 // AddInstance adds a service instance to the answerer.
@@ -29,8 +41,15 @@ func (an *Answerer) AddInstance(i *dnssd.Instance) {
 	}
 
 	an.m.Lock()
-	defer an.m.Unlock()
+	an.addInstance(i)
+	an.m.Unlock()
+
+	an.changed()
+}
 
+// addInstance adds a service instance to the answerer.
+// It assumes an.m is already locked for writing.
+func (an *Answerer) addInstance(i *dnssd.Instance) {
 	if an.domains == nil {
 		an.domains = dnssd.DomainCollection{}
 		an.answerers = map[names.FQDN]responder.Answerer{}
@@ -56,7 +75,7 @@ func (an *Answerer) AddInstance(i *dnssd.Instance) {
 		}
 
 		d.Services[s.Type] = s
-		an.answerers[s.InstanceEnumDomain()] = &instanceEnumAnswerer{an.Resolver, s}
+		an.answerers[s.InstanceEnumDomain()] = &instanceEnumAnswerer{an.Resolver, an.Network, s}
 	}
 
 	x, ok := s.Instances[i.Name]
@@ -66,8 +85,8 @@ func (an *Answerer) AddInstance(i *dnssd.Instance) {
 	}
 
 	s.Instances[i.Name] = i
-	an.answerers[i.FQDN()] = &instanceAnswerer{an.Resolver, i}
-	an.answerers[i.TargetFQDN()] = &targetAnswerer{an.Resolver, i}
+	an.answerers[i.FQDN()] = &instanceAnswerer{an.Resolver, an.Network, i}
+	an.answerers[i.TargetFQDN()] = &targetAnswerer{an.Resolver, an.Network, i}
 }
 
 // RemoveInstance removes a service instance from the handler.
@@ -77,8 +96,19 @@ func (an *Answerer) RemoveInstance(
 	domain names.FQDN,
 ) {
 	an.m.Lock()
-	defer an.m.Unlock()
+	an.removeInstance(instance, service, domain)
+	an.m.Unlock()
+
+	an.changed()
+}
 
+// removeInstance removes a service instance from the handler.
+// It assumes an.m is already locked for writing.
+func (an *Answerer) removeInstance(
+	instance dnssd.InstanceName,
+	service dnssd.ServiceType,
+	domain names.FQDN,
+) {
 	d, ok := an.domains[domain]
 	if !ok {
 		return
@@ -109,6 +139,105 @@ func (an *Answerer) RemoveInstance(
 	}
 }
 
+// Rename re-publishes the service instance with the given FQDN under a new
+// instance name, such as "Printer (2)", after a conflict has been detected.
+//
+// It returns false if n is not the name of one of the answerer's instances.
+func (an *Answerer) Rename(
+	ctx context.Context,
+	n names.FQDN,
+) (names.FQDN, bool, error) {
+	an.m.Lock()
+	renamed, ok := an.rename(n)
+	an.m.Unlock()
+
+	if ok {
+		an.changed()
+	}
+
+	return renamed, ok, nil
+}
+
+// rename re-publishes the service instance with the given FQDN under a new
+// instance name.
+// It assumes an.m is already locked for writing.
+func (an *Answerer) rename(n names.FQDN) (names.FQDN, bool) {
+	for _, d := range an.domains {
+		for _, s := range d.Services {
+			for _, i := range s.Instances {
+				if !strings.EqualFold(i.FQDN().String(), n.String()) {
+					continue
+				}
+
+				x := *i // shallow copy
+				x.Name = i.Name.Next()
+
+				for {
+					if _, ok := s.Instances[x.Name]; !ok {
+						break
+					}
+
+					x.Name = x.Name.Next()
+				}
+
+				an.removeInstance(i.Name, i.ServiceType, i.Domain)
+				an.addInstance(&x)
+
+				return x.FQDN(), true
+			}
+		}
+	}
+
+	return "", false
+}
+
+// Notify registers fn to be called whenever the records published by the
+// answerer are changed.
+func (an *Answerer) Notify(fn func()) {
+	an.m.Lock()
+	defer an.m.Unlock()
+
+	an.observers = append(an.observers, fn)
+}
+
+// changed calls each of the functions registered via Notify().
+func (an *Answerer) changed() {
+	an.m.RLock()
+	observers := an.observers
+	an.m.RUnlock()
+
+	for _, fn := range observers {
+		fn()
+	}
+}
+
+// Names returns the names of the records published on the given interface.
+func (an *Answerer) Names(
+	ctx context.Context,
+	iface net.Interface,
+) ([]names.FQDN, error) {
+	an.m.RLock()
+	defer an.m.RUnlock()
+
+	result := make([]names.FQDN, 0, len(an.answerers))
+	for n, v := range an.answerers {
+		// the address records of a remote target host are published by that
+		// host, so its name is not one of ours to probe or announce.
+		if t, ok := v.(*targetAnswerer); ok && t.Instance.TargetHost.IsQualified() {
+			continue
+		}
+
+		result = append(result, n)
+	}
+
+	reverse, err := an.reverseNames(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(result, reverse...), nil
+}
+
 // Answer populates an answer to a single DNS question.
 func (an *Answerer) Answer(
 	ctx context.Context,
@@ -122,5 +251,9 @@ func (an *Answerer) Answer(
 		return v.Answer(ctx, q, a)
 	}
 
+	if isReverseName(q.Question.Name) {
+		return an.answerReverse(ctx, q, a)
+	}
+
 	return nil
 }
@@ -0,0 +1,226 @@
+package bonjour_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/bonjour"
+	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+)
+
+var _ = Describe("Answerer", func() {
+	var (
+		iface    *transport.VirtualInterface
+		answerer *Answerer
+		instance *dnssd.Instance
+	)
+
+	BeforeEach(func() {
+		link := &transport.Link{}
+		iface = link.NewInterface("eth0", cidr("192.168.1.10/24"))
+
+		answerer = &Answerer{
+			Network: transport.VirtualNetwork{iface},
+		}
+
+		instance = &dnssd.Instance{
+			Name:        "Printer",
+			ServiceType: "_http._tcp",
+			Domain:      "local.",
+			TargetHost:  names.Label("host"),
+			TargetPort:  80,
+			TTL:         120 * time.Second,
+		}
+	})
+
+	// answer asks the answerer a question about the records at n.
+	answer := func(n string, t uint16, known ...dns.RR) *responder.Answer {
+		q := dns.Question{Name: n, Qtype: t, Qclass: dns.ClassINET}
+		m := mdns.NewQuery(false, q)
+		m.Answer = known
+
+		a := &responder.Answer{}
+		err := answerer.Answer(
+			context.Background(),
+			&responder.Question{
+				Question:     q,
+				Query:        m,
+				Interface:    iface.Interface(),
+				KnownAnswers: known,
+			},
+			a,
+		)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		return a
+	}
+
+	// publishedNames returns the names published on the interface.
+	publishedNames := func() []names.FQDN {
+		n, err := answerer.Names(context.Background(), iface.Interface())
+		Expect(err).ShouldNot(HaveOccurred())
+		return n
+	}
+
+	Describe("Notify", func() {
+		var notified chan struct{}
+
+		BeforeEach(func() {
+			notified = make(chan struct{}, 10)
+			answerer.Notify(func() {
+				notified <- struct{}{}
+			})
+		})
+
+		It("notifies the observers when an instance is added", func() {
+			answerer.AddInstance(instance)
+			Expect(notified).To(Receive())
+		})
+
+		It("notifies the observers when an instance is updated", func() {
+			answerer.AddInstance(instance)
+			Expect(notified).To(Receive())
+
+			x := *instance
+			x.TargetPort = 8080
+			answerer.AddInstance(&x)
+			Expect(notified).To(Receive())
+
+			a := answer("Printer._http._tcp.local.", dns.TypeSRV)
+			Expect(a.Unique.AnswerSection).To(HaveLen(1))
+			Expect(a.Unique.AnswerSection[0].(*dns.SRV).Port).To(BeEquivalentTo(8080))
+		})
+	})
+
+	Describe("RemoveInstance", func() {
+		It("notifies the observers", func() {
+			answerer.AddInstance(instance)
+
+			notified := make(chan struct{}, 10)
+			answerer.Notify(func() {
+				notified <- struct{}{}
+			})
+
+			answerer.RemoveInstance(instance.Name, instance.ServiceType, instance.Domain)
+			Expect(notified).To(Receive())
+		})
+
+		It("withdraws the instance's records", func() {
+			answerer.AddInstance(instance)
+			answerer.RemoveInstance(instance.Name, instance.ServiceType, instance.Domain)
+
+			Expect(publishedNames()).To(BeEmpty())
+
+			a := answer("_http._tcp.local.", dns.TypePTR)
+			Expect(a.Shared.AnswerSection).To(BeEmpty())
+
+			a = answer("Printer._http._tcp.local.", dns.TypeANY)
+			Expect(a.Unique.AnswerSection).To(BeEmpty())
+		})
+
+		It("does not withdraw the records of other instances of the same service", func() {
+			x := *instance
+			x.Name = "Scanner"
+
+			answerer.AddInstance(instance)
+			answerer.AddInstance(&x)
+			answerer.RemoveInstance(instance.Name, instance.ServiceType, instance.Domain)
+
+			Expect(publishedNames()).NotTo(ContainElement(names.FQDN("Printer._http._tcp.local.")))
+			Expect(publishedNames()).To(ContainElement(names.FQDN("Scanner._http._tcp.local.")))
+
+			a := answer("_http._tcp.local.", dns.TypePTR)
+			Expect(a.Shared.AnswerSection).To(HaveLen(1))
+			Expect(a.Shared.AnswerSection[0].(*dns.PTR).Ptr).To(Equal("Scanner._http._tcp.local."))
+		})
+	})
+
+	Describe("Answer", func() {
+		Context("when browsing for instances of a service", func() {
+			It("answers with the PTR record of each instance, and its SRV, TXT and address records as additional records", func() {
+				answerer.AddInstance(instance)
+
+				a := answer("_http._tcp.local.", dns.TypePTR)
+				Expect(a.Shared.AnswerSection).To(ConsistOf(
+					sameRecord(instance.PTR()),
+				))
+				Expect(a.Unique.AdditionalSection).To(ConsistOf(
+					sameRecord(instance.SRV()),
+					sameRecord(instance.TXT()),
+					sameRecord(instance.A(net.ParseIP("192.168.1.10"))),
+				))
+			})
+
+			It("omits instances that the querier already knows, along with their additional records", func() {
+				x := *instance
+				x.Name = "Scanner"
+
+				answerer.AddInstance(instance)
+				answerer.AddInstance(&x)
+
+				a := answer("_http._tcp.local.", dns.TypePTR, instance.PTR())
+				Expect(a.Shared.AnswerSection).To(ConsistOf(
+					sameRecord(x.PTR()),
+				))
+				Expect(a.Unique.AdditionalSection).NotTo(ContainElement(
+					sameRecord(instance.SRV()),
+				))
+			})
+		})
+	})
+
+	Describe("Names", func() {
+		It("returns nothing if there are no instances", func() {
+			Expect(publishedNames()).To(BeEmpty())
+		})
+
+		It("returns the enumeration domains, and the names of the instance and its target host", func() {
+			answerer.AddInstance(instance)
+
+			Expect(publishedNames()).To(ContainElement(names.FQDN("_services._dns-sd._udp.local.")))
+			Expect(publishedNames()).To(ContainElement(names.FQDN("_http._tcp.local.")))
+			Expect(publishedNames()).To(ContainElement(names.FQDN("Printer._http._tcp.local.")))
+			Expect(publishedNames()).To(ContainElement(names.FQDN("host.local.")))
+		})
+
+		It("does not return the name of a remote target host", func() {
+			instance.TargetHost = names.FQDN("remote.example.org.")
+			answerer.AddInstance(instance)
+
+			Expect(publishedNames()).NotTo(ContainElement(names.FQDN("remote.example.org.")))
+		})
+	})
+})
+
+// sameRecord returns a matcher that succeeds if a record has the same text
+// representation as rr.
+func sameRecord(rr dns.RR) types.GomegaMatcher {
+	return WithTransform(
+		func(x dns.RR) string {
+			return x.String()
+		},
+		Equal(rr.String()),
+	)
+}
+
+// cidr parses s as an IP address with a network prefix, such as
+// "192.168.1.10/24".
+func cidr(s string) *net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	n.IP = ip
+
+	return n
+}
@@ -6,6 +6,7 @@ import (
 	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
 
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
 	"github.com/jmalloc/dissolve/src/dissolve/resolver"
 	"github.com/miekg/dns"
 )
@@ -41,6 +42,7 @@ func (an *typeEnumAnswerer) Answer(
 // See https://tools.ietf.org/html/rfc6763#section-4.
 type instanceEnumAnswerer struct {
 	Resolver resolver.Resolver
+	Network  transport.Network
 	Service  *dnssd.Service
 }
 
@@ -52,7 +54,21 @@ func (an *instanceEnumAnswerer) Answer(
 	switch q.Qtype {
 	case dns.TypePTR, dns.TypeANY:
 		for _, i := range an.Service.Instances {
-			a.Unique.Answer(i.PTR())
+			ptr := i.PTR()
+
+			// https://tools.ietf.org/html/rfc6762#section-7.1
+			//
+			// Skip instances that the querier already knows about, along with
+			// their additional records.
+			if q.IsKnownAnswer(ptr) {
+				continue
+			}
+
+			// https://tools.ietf.org/html/rfc6762#section-2
+			//
+			// PTR records used in DNS-SD browsing are shared records, as
+			// several responders may provide instances of the same service.
+			a.Shared.Answer(ptr)
 
 			// https://tools.ietf.org/html/rfc6763#section-12.1
 			//
@@ -69,7 +85,7 @@ func (an *instanceEnumAnswerer) Answer(
 			)
 
 			// attempt to resolve the A/AAAA records, ignore on failure
-			if v4, v6, err := addressRecords(ctx, an.Resolver, q.Interface, i); err == nil {
+			if v4, v6, err := addressRecords(ctx, an.Resolver, an.Network, q.Interface, i); err == nil {
 				a.Unique.Additional(v4...)
 				a.Unique.Additional(v6...)
 			}
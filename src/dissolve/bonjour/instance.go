@@ -6,6 +6,7 @@ import (
 	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
 
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
 	"github.com/jmalloc/dissolve/src/dissolve/resolver"
 	"github.com/miekg/dns"
 )
@@ -14,6 +15,7 @@ import (
 // DNS-SD records associated with a service instance.
 type instanceAnswerer struct {
 	Resolver resolver.Resolver
+	Network  transport.Network
 	Instance *dnssd.Instance
 }
 
@@ -24,6 +26,13 @@ func (an *instanceAnswerer) Answer(
 ) error {
 	hasSRV := false
 
+	a.Owns(
+		an.Instance.FQDN().String(),
+		an.Instance.TTLInSeconds(),
+		dns.TypeSRV,
+		dns.TypeTXT,
+	)
+
 	switch q.Qtype {
 	case dns.TypeANY:
 		hasSRV = true
@@ -48,7 +57,7 @@ func (an *instanceAnswerer) Answer(
 	// o  All address records (type "A" and "AAAA") named in the SRV rdata.
 	if hasSRV {
 		// attempt to resolve the A/AAAA records, ignore on failure
-		if v4, v6, err := addressRecords(ctx, an.Resolver, q.Interface, an.Instance); err == nil {
+		if v4, v6, err := addressRecords(ctx, an.Resolver, an.Network, q.Interface, an.Instance); err == nil {
 			a.Unique.Additional(v4...)
 			a.Unique.Additional(v6...)
 		}
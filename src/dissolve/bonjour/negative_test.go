@@ -0,0 +1,83 @@
+package bonjour_test
+
+import (
+	"net"
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/bonjour"
+	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Answerer negative responses", func() {
+	var (
+		instance *dnssd.Instance
+		server   *testServer
+	)
+
+	BeforeEach(func() {
+		answerer := &Answerer{}
+
+		instance = &dnssd.Instance{
+			Name:        "Printer",
+			ServiceType: "_http._tcp",
+			Domain:      "local.",
+			TargetHost:  names.Label("host"),
+			TargetPort:  80,
+			TTL:         120 * time.Second,
+		}
+
+		server = newTestServer(answerer, "192.168.1.10/24")
+		answerer.AddInstance(instance)
+		server.Start()
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	// nsec returns the NSEC record in the answer section of m.
+	nsec := func(m *dns.Msg) *dns.NSEC {
+		Expect(m).NotTo(BeNil())
+		Expect(m.Answer).To(HaveLen(1))
+
+		rr, ok := m.Answer[0].(*dns.NSEC)
+		Expect(ok).To(BeTrue())
+
+		return rr
+	}
+
+	It("asserts that the target host has no AAAA records when the interface has no IPv6 addresses", func() {
+		m := server.Query("host.local.", dns.TypeAAAA)
+
+		rr := nsec(m)
+		Expect(rr.Hdr.Name).To(Equal("host.local."))
+		Expect(rr.Hdr.Ttl).To(BeEquivalentTo(120))
+		Expect(rr.TypeBitMap).To(Equal([]uint16{dns.TypeA}))
+
+		// the address record is sent with the cache-flush bit set
+		Expect(m.Extra).To(ContainElement(
+			sameRecord(mdns.SetUniqueRecord(instance.A(net.ParseIP("192.168.1.10")))),
+		))
+	})
+
+	It("asserts that the target host has only address records when asked for other types", func() {
+		m := server.Query("host.local.", dns.TypeTXT)
+
+		rr := nsec(m)
+		Expect(rr.Hdr.Name).To(Equal("host.local."))
+		Expect(rr.TypeBitMap).To(Equal([]uint16{dns.TypeA}))
+	})
+
+	It("asserts that the instance has no records other than its SRV and TXT records", func() {
+		m := server.Query("Printer._http._tcp.local.", dns.TypeA)
+
+		rr := nsec(m)
+		Expect(rr.Hdr.Name).To(Equal("Printer._http._tcp.local."))
+		Expect(rr.TypeBitMap).To(Equal([]uint16{dns.TypeTXT, dns.TypeSRV}))
+	})
+})
@@ -0,0 +1,185 @@
+package bonjour_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/bonjour"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+// testServer runs an mDNS responder for a Bonjour answerer on a virtual link
+// with a fake clock, and queries it from another interface on the same link.
+type testServer struct {
+	Clock     *clock.Fake
+	Interface *transport.VirtualInterface
+	Responder *responder.Responder
+
+	querier  *transport.VirtualTransport
+	iface    net.Interface
+	messages chan *dns.Msg
+	cancel   context.CancelFunc
+	done     chan error
+}
+
+// newTestServer returns a server for a, which is attached to the link via an
+// interface with the given address. It sets a.Network to the server's network.
+func newTestServer(a *Answerer, addr string) *testServer {
+	c := clock.NewFake(time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC))
+	link := &transport.Link{Clock: c}
+
+	vi := link.NewInterface("eth0", cidr(addr))
+	vn := transport.VirtualNetwork{vi}
+	a.Network = vn
+
+	qi := link.NewInterface("eth1", cidr("192.168.1.200/24"))
+	s := &testServer{
+		Clock:     c,
+		Interface: vi,
+		querier:   transport.NewVirtualTransport(transport.VirtualNetwork{qi}),
+		iface:     qi.Interface(),
+		messages:  make(chan *dns.Msg, 100),
+	}
+
+	Expect(s.querier.Join(&s.iface)).To(Succeed())
+	go s.read()
+
+	var err error
+	s.Responder, err = responder.New(
+		a,
+		responder.UseNetwork(vn),
+		responder.UseTransport(transport.NewVirtualTransport(vn)),
+		responder.UseClock(c),
+		responder.UseRandSource(zeroSource{}),
+	)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	return s
+}
+
+// Start runs the responder in the background, and advances the clock until it
+// has probed and announced its records.
+func (s *testServer) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan error, 1)
+
+	go func() {
+		s.done <- s.Responder.Run(ctx)
+	}()
+
+	// skip the random delay before the first probe, which is at most
+	// 250ms
+	s.Clock.BlockUntil(1)
+	s.Clock.Advance(250 * time.Millisecond)
+
+	// each probe is sent 250ms after the previous one, and the first
+	// announcement 250ms after the last probe
+	for !s.next().Response {
+		s.Advance(250 * time.Millisecond)
+	}
+
+	s.Advance(1 * time.Second)
+	Expect(s.next().Response).To(BeTrue())
+
+	// wait until the records may be multicast again
+	s.Advance(1 * time.Second)
+	s.drain()
+}
+
+// Stop stops the responder and closes the querier's transport.
+func (s *testServer) Stop() {
+	if s.cancel != nil {
+		s.cancel()
+		Eventually(s.done).Should(Receive(BeNil()))
+	}
+
+	s.querier.Close()
+}
+
+// Advance waits for the responder to finish executing its current command,
+// then moves the fake clock forward by d.
+func (s *testServer) Advance(d time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	// commands are executed one at a time, so by the time the records are
+	// returned, the preceding command is complete
+	_, _ = s.Responder.Records(ctx, s.Interface.Interface())
+
+	s.Clock.Advance(d)
+}
+
+// Query multicasts a query for the records of type t at n, and returns the
+// response, or nil if there is none.
+func (s *testServer) Query(n string, t uint16) *dns.Msg {
+	m := mdns.NewQuery(false, dns.Question{Name: n, Qtype: t, Qclass: dns.ClassINET})
+	_, err := transport.SendMulticast(s.querier, &s.iface, m)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	// responses that contain shared records are delayed by at least 20ms
+	for i := 0; i < 3; i++ {
+		if res := s.receive(); res != nil {
+			return res
+		}
+
+		s.Advance(20 * time.Millisecond)
+	}
+
+	return nil
+}
+
+// read receives messages until the querier's transport is closed.
+func (s *testServer) read() {
+	for {
+		p, err := s.querier.Read()
+		if err != nil {
+			return
+		}
+
+		if m, err := p.Message(); err == nil {
+			s.messages <- m
+		}
+
+		p.Close()
+	}
+}
+
+// receive returns the next message received by the querier, or nil if none
+// arrives within a short period of real time.
+func (s *testServer) receive() *dns.Msg {
+	select {
+	case m := <-s.messages:
+		return m
+	case <-time.After(50 * time.Millisecond):
+		return nil
+	}
+}
+
+// next returns the next message received by the querier, failing the test if
+// none arrives.
+func (s *testServer) next() *dns.Msg {
+	var m *dns.Msg
+	Eventually(s.messages).Should(Receive(&m))
+	return m
+}
+
+// drain discards the messages received by the querier, until none have been
+// received for a short period of real time.
+func (s *testServer) drain() {
+	for s.receive() != nil {
+	}
+}
+
+// zeroSource is a rand.Source that always returns zero, so that each random
+// delay takes its minimum value.
+type zeroSource struct{}
+
+func (zeroSource) Int63() int64 { return 0 }
+func (zeroSource) Seed(int64)   {}
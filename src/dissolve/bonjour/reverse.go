@@ -0,0 +1,124 @@
+package bonjour
+
+import (
+	"context"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+)
+
+// isReverseName returns true if n is a name within one of the reverse-mapping
+// domains.
+func isReverseName(n string) bool {
+	n = strings.ToLower(n)
+
+	return strings.HasSuffix(n, ".in-addr.arpa.") ||
+		strings.HasSuffix(n, ".ip6.arpa.")
+}
+
+// localTargets returns one instance for each distinct target host that refers
+// to this machine, that is, for each instance with an unqualified target host.
+// It assumes an.m is already locked for reading.
+func (an *Answerer) localTargets() []*dnssd.Instance {
+	targets := map[string]*dnssd.Instance{}
+
+	for _, d := range an.domains {
+		for _, s := range d.Services {
+			for _, i := range s.Instances {
+				if i.TargetHost.IsQualified() {
+					continue
+				}
+
+				k := strings.ToLower(i.TargetFQDN().String())
+				if _, ok := targets[k]; !ok {
+					targets[k] = i
+				}
+			}
+		}
+	}
+
+	result := make([]*dnssd.Instance, 0, len(targets))
+	for _, i := range targets {
+		result = append(result, i)
+	}
+
+	// sort by target name so that the records are produced in a consistent
+	// order
+	sort.Slice(result, func(a, b int) bool {
+		return result[a].TargetFQDN() < result[b].TargetFQDN()
+	})
+
+	return result
+}
+
+// reverseNames returns the reverse-mapping names of the addresses of iface, if
+// there are any instances with a local target host.
+// It assumes an.m is already locked for reading.
+func (an *Answerer) reverseNames(iface net.Interface) ([]names.FQDN, error) {
+	if len(an.localTargets()) == 0 {
+		return nil, nil
+	}
+
+	addresses, err := resolveLocalAddrs(an.Network, iface)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]names.FQDN, 0, len(addresses))
+	for _, ip := range addresses {
+		if n, err := dns.ReverseAddr(ip.String()); err == nil {
+			result = append(result, names.FQDN(n))
+		}
+	}
+
+	return result, nil
+}
+
+// answerReverse answers a question about a reverse-mapping name for one of the
+// addresses of the interface on which the question was received.
+//
+// The PTR records point to the target hosts of those instances that refer to
+// this machine. They are unique records, and so are probed before they are
+// used, just as the address records of the target hosts are.
+//
+// It assumes an.m is already locked for reading.
+func (an *Answerer) answerReverse(
+	ctx context.Context,
+	q *responder.Question,
+	a *responder.Answer,
+) error {
+	targets := an.localTargets()
+	if len(targets) == 0 {
+		return nil
+	}
+
+	addresses, err := resolveLocalAddrs(an.Network, q.Interface)
+	if err != nil {
+		return err
+	}
+
+	for _, ip := range addresses {
+		n, err := dns.ReverseAddr(ip.String())
+		if err != nil || !strings.EqualFold(n, q.Name) {
+			continue
+		}
+
+		a.Owns(n, targets[0].TTLInSeconds(), dns.TypePTR)
+
+		switch q.Qtype {
+		case dns.TypePTR, dns.TypeANY:
+			for _, i := range targets {
+				a.Unique.Answer(i.ReversePTR(ip))
+			}
+		}
+
+		return nil
+	}
+
+	return nil
+}
@@ -0,0 +1,97 @@
+package bonjour_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/bonjour"
+	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Answerer reverse-mapping records", func() {
+	var (
+		answerer *Answerer
+		instance *dnssd.Instance
+		server   *testServer
+	)
+
+	BeforeEach(func() {
+		answerer = &Answerer{}
+
+		instance = &dnssd.Instance{
+			Name:        "Printer",
+			ServiceType: "_http._tcp",
+			Domain:      "local.",
+			TargetHost:  names.Label("host"),
+			TargetPort:  80,
+			TTL:         120 * time.Second,
+		}
+
+		server = newTestServer(answerer, "192.168.1.10/24")
+	})
+
+	AfterEach(func() {
+		server.Stop()
+	})
+
+	// publishedNames returns the names published on the server's interface.
+	publishedNames := func() []names.FQDN {
+		n, err := answerer.Names(context.Background(), server.Interface.Interface())
+		Expect(err).ShouldNot(HaveOccurred())
+		return n
+	}
+
+	It("answers with a PTR record that points to the target host", func() {
+		answerer.AddInstance(instance)
+		server.Start()
+
+		m := server.Query("10.1.168.192.in-addr.arpa.", dns.TypePTR)
+		Expect(m).NotTo(BeNil())
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord(mdns.SetUniqueRecord(instance.ReversePTR(net.ParseIP("192.168.1.10")))),
+		))
+		Expect(m.Answer[0].(*dns.PTR).Ptr).To(Equal("host.local."))
+	})
+
+	It("asserts that the reverse-mapping name has no other records", func() {
+		answerer.AddInstance(instance)
+		server.Start()
+
+		m := server.Query("10.1.168.192.in-addr.arpa.", dns.TypeTXT)
+		Expect(m).NotTo(BeNil())
+		Expect(m.Answer).To(HaveLen(1))
+
+		rr, ok := m.Answer[0].(*dns.NSEC)
+		Expect(ok).To(BeTrue())
+		Expect(rr.TypeBitMap).To(Equal([]uint16{dns.TypePTR}))
+	})
+
+	It("does not answer for addresses of other hosts", func() {
+		answerer.AddInstance(instance)
+		server.Start()
+
+		Expect(server.Query("20.1.168.192.in-addr.arpa.", dns.TypePTR)).To(BeNil())
+	})
+
+	It("publishes the reverse-mapping name so that it is probed and announced", func() {
+		answerer.AddInstance(instance)
+
+		Expect(publishedNames()).To(ContainElement(names.FQDN("10.1.168.192.in-addr.arpa.")))
+	})
+
+	It("does not publish a reverse-mapping name when there are no local target hosts", func() {
+		instance.TargetHost = names.FQDN("remote.example.org.")
+		answerer.AddInstance(instance)
+
+		Expect(publishedNames()).NotTo(ContainElement(names.FQDN("10.1.168.192.in-addr.arpa.")))
+
+		server.Start()
+		Expect(server.Query("10.1.168.192.in-addr.arpa.", dns.TypePTR)).To(BeNil())
+	})
+})
@@ -8,6 +8,7 @@ import (
 
 	"github.com/jmalloc/dissolve/src/dissolve/dnssd"
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
 	"github.com/jmalloc/dissolve/src/dissolve/resolver"
 	"github.com/miekg/dns"
 )
@@ -16,6 +17,7 @@ import (
 // target hostname of a DNS-SD service instance.
 type targetAnswerer struct {
 	Resolver resolver.Resolver
+	Network  transport.Network
 	Instance *dnssd.Instance
 }
 
@@ -24,17 +26,41 @@ func (an *targetAnswerer) Answer(
 	q *responder.Question,
 	a *responder.Answer,
 ) error {
+	var isAddress bool
 	switch q.Qtype {
 	case dns.TypeA, dns.TypeAAAA, dns.TypeANY:
-	default:
+		isAddress = true
+	}
+
+	// the responder is authoritative for a local target host, so questions of
+	// every type are answered, if only to assert that it has no such records.
+	if !isAddress && an.Instance.TargetHost.IsQualified() {
 		return nil
 	}
 
-	v4, v6, err := addressRecords(ctx, an.Resolver, q.Interface, an.Instance)
+	v4, v6, err := addressRecords(ctx, an.Resolver, an.Network, q.Interface, an.Instance)
 	if err != nil {
 		return err
 	}
 
+	var types []uint16
+	if len(v4) != 0 {
+		types = append(types, dns.TypeA)
+	}
+	if len(v6) != 0 {
+		types = append(types, dns.TypeAAAA)
+	}
+
+	// the address records of a remote target host are only provided as a
+	// convenience, that host is responsible for its own negative responses.
+	if len(types) != 0 && !an.Instance.TargetHost.IsQualified() {
+		a.Owns(
+			an.Instance.TargetFQDN().String(),
+			an.Instance.TTLInSeconds(),
+			types...,
+		)
+	}
+
 	switch q.Qtype {
 	case dns.TypeANY:
 		a.Unique.Answer(v4...)
@@ -56,6 +82,7 @@ func (an *targetAnswerer) Answer(
 func addressRecords(
 	ctx context.Context,
 	r resolver.Resolver,
+	n transport.Network,
 	f net.Interface,
 	i *dnssd.Instance,
 ) (
@@ -71,7 +98,7 @@ func addressRecords(
 	if i.TargetHost.IsQualified() {
 		addresses, err = resolveRemoteAddrs(ctx, r, i.TargetHost)
 	} else {
-		addresses, err = resolveLocalAddrs(f)
+		addresses, err = resolveLocalAddrs(n, f)
 	}
 
 	if err != nil {
@@ -114,11 +141,16 @@ func resolveRemoteAddrs(
 	return addresses, nil
 }
 
-// resolveLocalAddrs returns the IP addresses of the given interface.
+// resolveLocalAddrs uses n to find the IP addresses of the given interface.
 func resolveLocalAddrs(
+	n transport.Network,
 	f net.Interface,
 ) ([]net.IP, error) {
-	addrs, err := f.Addrs()
+	if n == nil {
+		n = transport.SystemNetwork{}
+	}
+
+	addrs, err := n.Addrs(f)
 	if err != nil {
 		return nil, err
 	}
@@ -141,6 +141,22 @@ func (i *Instance) AAAA(ip net.IP) *dns.AAAA {
 	}
 }
 
+// ReversePTR returns a reverse-mapping PTR record that maps the given IP
+// address to the instance's target host.
+func (i *Instance) ReversePTR(ip net.IP) *dns.PTR {
+	n, _ := dns.ReverseAddr(ip.String()) // ip.String() is always a valid address
+
+	return &dns.PTR{
+		Hdr: dns.RR_Header{
+			Name:   n,
+			Rrtype: dns.TypePTR,
+			Class:  dns.ClassINET,
+			Ttl:    i.TTLInSeconds(),
+		},
+		Ptr: i.TargetHost.Qualify(i.Domain).String(),
+	}
+}
+
 // TTLInSeconds returns the instance's DNS record TTL in seconds.
 // If i.TTL is 0, it uses DefaultTTL.
 func (i *Instance) TTLInSeconds() uint32 {
@@ -2,6 +2,7 @@ package dnssd
 
 import (
 	"errors"
+	"strconv"
 	"strings"
 
 	"github.com/jmalloc/dissolve/src/dissolve/names"
@@ -60,6 +61,27 @@ func SplitInstanceName(n names.Name) (head InstanceName, tail names.Name) {
 	return
 }
 
+// Next returns the name to use in place of n when n is already in use by
+// another host on the network.
+//
+// For example, "Printer" becomes "Printer (2)", and "Printer (2)" becomes
+// "Printer (3)".
+//
+// See https://tools.ietf.org/html/rfc6762#section-9.
+func (n InstanceName) Next() InstanceName {
+	s := string(n)
+
+	if strings.HasSuffix(s, ")") {
+		if i := strings.LastIndex(s, " ("); i != -1 {
+			if c, err := strconv.Atoi(s[i+2 : len(s)-1]); err == nil && c >= 2 {
+				return InstanceName(s[:i] + " (" + strconv.Itoa(c+1) + ")")
+			}
+		}
+	}
+
+	return InstanceName(s + " (2)")
+}
+
 // IsQualified returns false.
 func (n InstanceName) IsQualified() bool {
 	return false
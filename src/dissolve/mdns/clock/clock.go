@@ -0,0 +1,71 @@
+// Package clock provides an abstraction of the passage of time, so that the
+// timing behavior of mDNS responders and transports can be tested without real
+// delays.
+package clock
+
+import "time"
+
+// Clock is an interface for reading the current time and waiting for time to
+// pass.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a timer that fires once after d has elapsed.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker returns a ticker that fires every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Timer is a single event, equivalent to time.Timer.
+type Timer interface {
+	// C returns the channel on which the time is delivered when the timer
+	// fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if the timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// Ticker delivers the time at regular intervals, equivalent to time.Ticker.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// System is a clock that uses the system time.
+type System struct{}
+
+// Now returns the current time.
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer returns a timer that fires once after d has elapsed.
+func (System) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+// NewTicker returns a ticker that fires every d.
+func (System) NewTicker(d time.Duration) Ticker {
+	return systemTicker{time.NewTicker(d)}
+}
+
+type systemTimer struct {
+	t *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time { return t.t.C }
+func (t systemTimer) Stop() bool          { return t.t.Stop() }
+
+type systemTicker struct {
+	t *time.Ticker
+}
+
+func (t systemTicker) C() <-chan time.Time { return t.t.C }
+func (t systemTicker) Stop()               { t.t.Stop() }
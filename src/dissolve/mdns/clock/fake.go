@@ -0,0 +1,200 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a clock that only advances when told to do so. It allows tests to
+// step through the responder's delays deterministically.
+//
+// Timers and tickers fire, in order of their deadlines, as the clock is
+// advanced past them.
+type Fake struct {
+	m      sync.Mutex
+	cond   *sync.Cond
+	now    time.Time
+	timers []*fakeTimer
+}
+
+// NewFake returns a fake clock with the current time set to t.
+func NewFake(t time.Time) *Fake {
+	c := &Fake{now: t}
+	c.cond = sync.NewCond(&c.m)
+	return c
+}
+
+// Now returns the clock's current time.
+func (c *Fake) Now() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return c.now
+}
+
+// NewTimer returns a timer that fires once the clock has been advanced by d.
+func (c *Fake) NewTimer(d time.Duration) Timer {
+	return c.add(d, 0)
+}
+
+// NewTicker returns a ticker that fires each time the clock is advanced by d.
+//
+// It panics if d is not positive.
+func (c *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("non-positive interval for NewTicker")
+	}
+
+	return fakeTicker{c.add(d, d)}
+}
+
+// Advance moves the clock forward by d, firing any timers that expire along
+// the way.
+func (c *Fake) Advance(d time.Duration) {
+	c.m.Lock()
+	c.set(c.now.Add(d))
+	c.m.Unlock()
+}
+
+// Set moves the clock forward to t, firing any timers that expire along the
+// way. It has no effect if t is before the clock's current time.
+func (c *Fake) Set(t time.Time) {
+	c.m.Lock()
+	c.set(t)
+	c.m.Unlock()
+}
+
+// Timers returns the number of timers and tickers that are waiting to fire.
+func (c *Fake) Timers() int {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	return len(c.timers)
+}
+
+// Next returns the time at which the next timer or ticker fires, or the zero
+// time if there are none.
+//
+// It is used to ensure that a specific timer has started before the clock is
+// advanced, when other timers may also be waiting.
+func (c *Fake) Next() time.Time {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	var next time.Time
+	for _, t := range c.timers {
+		if next.IsZero() || t.deadline.Before(next) {
+			next = t.deadline
+		}
+	}
+
+	return next
+}
+
+// BlockUntil blocks until at least n timers and tickers are waiting to fire.
+//
+// It is used to ensure that a goroutine has started waiting before the clock
+// is advanced.
+func (c *Fake) BlockUntil(n int) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for len(c.timers) < n {
+		c.cond.Wait()
+	}
+}
+
+// add registers a new timer that fires after d. If period is non-zero the
+// timer is re-armed each time it fires.
+func (c *Fake) add(d, period time.Duration) *fakeTimer {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	t := &fakeTimer{
+		clock:    c,
+		ch:       make(chan time.Time, 1),
+		deadline: c.now.Add(d),
+		period:   period,
+	}
+
+	if d <= 0 {
+		t.fire(c.now)
+		return t
+	}
+
+	c.timers = append(c.timers, t)
+	c.cond.Broadcast()
+
+	return t
+}
+
+// set moves the clock forward to t.
+// It assumes c.m is already locked.
+func (c *Fake) set(t time.Time) {
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].deadline.Before(c.timers[j].deadline)
+		})
+
+		if len(c.timers) == 0 || c.timers[0].deadline.After(t) {
+			break
+		}
+
+		x := c.timers[0]
+		c.now = x.deadline
+		x.fire(c.now)
+
+		if x.period == 0 {
+			c.timers = c.timers[1:]
+		} else {
+			x.deadline = x.deadline.Add(x.period)
+		}
+	}
+
+	if t.After(c.now) {
+		c.now = t
+	}
+}
+
+// remove unregisters t.
+// It returns false if t was not registered.
+func (c *Fake) remove(t *fakeTimer) bool {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	for i, x := range c.timers {
+		if x == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			return true
+		}
+	}
+
+	return false
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	ch       chan time.Time
+	deadline time.Time
+	period   time.Duration
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+func (t *fakeTimer) Stop() bool          { return t.clock.remove(t) }
+
+// fire delivers now on the timer's channel, unless a previous value has not
+// yet been received, as per the behavior of time.Ticker.
+func (t *fakeTimer) fire(now time.Time) {
+	select {
+	case t.ch <- now:
+	default:
+	}
+}
+
+type fakeTicker struct {
+	t *fakeTimer
+}
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.ch }
+func (t fakeTicker) Stop()               { t.t.Stop() }
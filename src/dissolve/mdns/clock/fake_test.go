@@ -0,0 +1,220 @@
+package clock_test
+
+import (
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Fake", func() {
+	var (
+		epoch time.Time
+		clock *Fake
+	)
+
+	BeforeEach(func() {
+		epoch = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+		clock = NewFake(epoch)
+	})
+
+	Describe("Now", func() {
+		It("returns the initial time", func() {
+			Expect(clock.Now()).To(Equal(epoch))
+		})
+
+		It("does not advance on its own", func() {
+			time.Sleep(5 * time.Millisecond)
+			Expect(clock.Now()).To(Equal(epoch))
+		})
+	})
+
+	Describe("Advance", func() {
+		It("moves the current time forward", func() {
+			clock.Advance(3 * time.Second)
+			Expect(clock.Now()).To(Equal(epoch.Add(3 * time.Second)))
+		})
+	})
+
+	Describe("Set", func() {
+		It("moves the current time forward", func() {
+			t := epoch.Add(1 * time.Hour)
+			clock.Set(t)
+			Expect(clock.Now()).To(Equal(t))
+		})
+
+		It("does not move the current time backward", func() {
+			clock.Set(epoch.Add(-1 * time.Hour))
+			Expect(clock.Now()).To(Equal(epoch))
+		})
+	})
+
+	Describe("NewTimer", func() {
+		It("does not fire before the duration has elapsed", func() {
+			t := clock.NewTimer(1 * time.Second)
+			clock.Advance(999 * time.Millisecond)
+			Consistently(t.C()).ShouldNot(Receive())
+		})
+
+		It("fires with the deadline once the duration has elapsed", func() {
+			t := clock.NewTimer(1 * time.Second)
+			clock.Advance(3 * time.Second)
+			Expect(t.C()).To(Receive(Equal(epoch.Add(1 * time.Second))))
+		})
+
+		It("only fires once", func() {
+			t := clock.NewTimer(1 * time.Second)
+			clock.Advance(1 * time.Second)
+			Expect(t.C()).To(Receive())
+
+			clock.Advance(1 * time.Second)
+			Consistently(t.C()).ShouldNot(Receive())
+		})
+
+		It("fires immediately if the duration is not positive", func() {
+			t := clock.NewTimer(0)
+			Expect(t.C()).To(Receive(Equal(epoch)))
+			Expect(clock.Timers()).To(Equal(0))
+		})
+
+		It("fires timers in order of their deadlines", func() {
+			late := clock.NewTimer(2 * time.Second)
+			early := clock.NewTimer(1 * time.Second)
+
+			clock.Advance(5 * time.Second)
+
+			Expect(early.C()).To(Receive(Equal(epoch.Add(1 * time.Second))))
+			Expect(late.C()).To(Receive(Equal(epoch.Add(2 * time.Second))))
+			Expect(clock.Now()).To(Equal(epoch.Add(5 * time.Second)))
+		})
+	})
+
+	Describe("Timer.Stop", func() {
+		It("prevents the timer from firing", func() {
+			t := clock.NewTimer(1 * time.Second)
+			Expect(t.Stop()).To(BeTrue())
+
+			clock.Advance(1 * time.Second)
+			Consistently(t.C()).ShouldNot(Receive())
+		})
+
+		It("returns false if the timer has already fired", func() {
+			t := clock.NewTimer(1 * time.Second)
+			clock.Advance(1 * time.Second)
+			Expect(t.Stop()).To(BeFalse())
+		})
+
+		It("returns false if the timer has already been stopped", func() {
+			t := clock.NewTimer(1 * time.Second)
+			t.Stop()
+			Expect(t.Stop()).To(BeFalse())
+		})
+	})
+
+	Describe("NewTicker", func() {
+		It("fires each time the interval elapses", func() {
+			t := clock.NewTicker(1 * time.Second)
+			defer t.Stop()
+
+			clock.Advance(1 * time.Second)
+			Expect(t.C()).To(Receive(Equal(epoch.Add(1 * time.Second))))
+
+			clock.Advance(1 * time.Second)
+			Expect(t.C()).To(Receive(Equal(epoch.Add(2 * time.Second))))
+		})
+
+		It("drops ticks that are not received", func() {
+			t := clock.NewTicker(1 * time.Second)
+			defer t.Stop()
+
+			clock.Advance(5 * time.Second)
+			Expect(t.C()).To(Receive(Equal(epoch.Add(1 * time.Second))))
+			Consistently(t.C()).ShouldNot(Receive())
+		})
+
+		It("stops firing when it is stopped", func() {
+			t := clock.NewTicker(1 * time.Second)
+			t.Stop()
+
+			clock.Advance(1 * time.Second)
+			Consistently(t.C()).ShouldNot(Receive())
+			Expect(clock.Timers()).To(Equal(0))
+		})
+
+		It("panics if the interval is not positive", func() {
+			Expect(func() {
+				clock.NewTicker(0)
+			}).To(Panic())
+		})
+	})
+
+	Describe("Timers", func() {
+		It("returns the number of timers and tickers that have not fired", func() {
+			clock.NewTimer(1 * time.Second)
+			clock.NewTimer(2 * time.Second)
+			clock.NewTicker(1 * time.Second)
+			Expect(clock.Timers()).To(Equal(3))
+
+			clock.Advance(1 * time.Second)
+			Expect(clock.Timers()).To(Equal(2))
+		})
+	})
+
+	Describe("Next", func() {
+		It("returns the time at which the next timer or ticker fires", func() {
+			clock.NewTimer(2 * time.Second)
+			clock.NewTicker(3 * time.Second)
+			clock.NewTimer(1 * time.Second)
+			Expect(clock.Next()).To(Equal(epoch.Add(1 * time.Second)))
+
+			clock.Advance(2 * time.Second)
+			Expect(clock.Next()).To(Equal(epoch.Add(3 * time.Second)))
+		})
+
+		It("returns the zero time if there are no timers", func() {
+			Expect(clock.Next().IsZero()).To(BeTrue())
+		})
+	})
+
+	Describe("BlockUntil", func() {
+		It("returns immediately if there are already enough timers", func() {
+			clock.NewTimer(1 * time.Second)
+
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				clock.BlockUntil(1)
+			}()
+
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("blocks until enough timers have been created", func() {
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				clock.BlockUntil(2)
+			}()
+
+			clock.NewTimer(1 * time.Second)
+			Consistently(done).ShouldNot(BeClosed())
+
+			clock.NewTimer(1 * time.Second)
+			Eventually(done).Should(BeClosed())
+		})
+
+		It("allows a goroutine's timer to be advanced deterministically", func() {
+			fired := make(chan time.Time, 1)
+			go func() {
+				t := clock.NewTimer(1 * time.Second)
+				fired <- <-t.C()
+			}()
+
+			clock.BlockUntil(1)
+			clock.Advance(1 * time.Second)
+
+			Eventually(fired).Should(Receive(Equal(epoch.Add(1 * time.Second))))
+		})
+	})
+})
@@ -0,0 +1,111 @@
+package responder
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// watchAddresses calls fn whenever an IP address is added to or removed from
+// any network interface, until ctx is canceled.
+//
+// It listens for address notifications from the kernel via a netlink socket.
+func watchAddresses(ctx context.Context, fn func()) error {
+	fd, err := unix.Socket(
+		unix.AF_NETLINK,
+		unix.SOCK_RAW|unix.SOCK_CLOEXEC|unix.SOCK_NONBLOCK,
+		unix.NETLINK_ROUTE,
+	)
+	if err != nil {
+		return os.NewSyscallError("socket", err)
+	}
+	defer unix.Close(fd)
+
+	if err := unix.Bind(fd, &unix.SockaddrNetlink{
+		Family: unix.AF_NETLINK,
+		Groups: unix.RTMGRP_IPV4_IFADDR | unix.RTMGRP_IPV6_IFADDR,
+	}); err != nil {
+		return os.NewSyscallError("bind", err)
+	}
+
+	// the netlink socket can not be read via the runtime's network poller on
+	// all supported versions of Go, so it is polled directly, along with a
+	// pipe that is closed to interrupt the poll when ctx is canceled.
+	var pipe [2]int
+	if err := unix.Pipe2(pipe[:], unix.O_CLOEXEC|unix.O_NONBLOCK); err != nil {
+		return os.NewSyscallError("pipe2", err)
+	}
+	defer unix.Close(pipe[0])
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+		}
+
+		unix.Close(pipe[1])
+	}()
+
+	fds := []unix.PollFd{
+		{Fd: int32(fd), Events: unix.POLLIN},
+		{Fd: int32(pipe[0]), Events: unix.POLLIN},
+	}
+
+	buf := make([]byte, os.Getpagesize())
+
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+
+			return os.NewSyscallError("poll", err)
+		}
+
+		if fds[1].Revents != 0 {
+			return ctx.Err()
+		}
+
+		n, _, err := unix.Recvfrom(fd, buf, 0)
+		switch err {
+		case nil:
+		case unix.EAGAIN, unix.EINTR:
+			continue
+		case unix.ENOBUFS:
+			// the kernel has dropped notifications because the socket's
+			// receive buffer was full, so the addresses of every interface
+			// must be checked again.
+			fn()
+			continue
+		default:
+			return os.NewSyscallError("recvfrom", err)
+		}
+
+		if isAddressChange(buf[:n]) {
+			fn()
+		}
+	}
+}
+
+// isAddressChange returns true if data, which was read from a netlink socket,
+// contains a notification that an address was added or removed.
+func isAddressChange(data []byte) bool {
+	msgs, err := syscall.ParseNetlinkMessage(data)
+	if err != nil {
+		return false
+	}
+
+	for _, m := range msgs {
+		if m.Header.Type == syscall.RTM_NEWADDR ||
+			m.Header.Type == syscall.RTM_DELADDR {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,49 @@
+package responder
+
+import (
+	"syscall"
+	"unsafe"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("isAddressChange", func() {
+	It("returns true for address notifications", func() {
+		Expect(isAddressChange(netlinkMessage(syscall.RTM_NEWADDR))).To(BeTrue())
+		Expect(isAddressChange(netlinkMessage(syscall.RTM_DELADDR))).To(BeTrue())
+	})
+
+	It("returns false for other notifications", func() {
+		Expect(isAddressChange(netlinkMessage(syscall.RTM_NEWLINK))).To(BeFalse())
+		Expect(isAddressChange(netlinkMessage(syscall.RTM_NEWROUTE))).To(BeFalse())
+	})
+
+	It("returns true if any of several messages is an address notification", func() {
+		data := append(
+			netlinkMessage(syscall.RTM_NEWLINK),
+			netlinkMessage(syscall.RTM_DELADDR)...,
+		)
+
+		Expect(isAddressChange(data)).To(BeTrue())
+	})
+
+	It("returns false for truncated messages", func() {
+		data := netlinkMessage(syscall.RTM_NEWADDR)
+		Expect(isAddressChange(data[:syscall.NLMSG_HDRLEN-1])).To(BeFalse())
+	})
+})
+
+// netlinkMessage returns a netlink message of the given type, with an empty
+// interface address payload, in the host's byte order.
+func netlinkMessage(t uint16) []byte {
+	h := syscall.NlMsghdr{
+		Len:  syscall.NLMSG_HDRLEN + syscall.SizeofIfAddrmsg,
+		Type: t,
+	}
+
+	data := make([]byte, h.Len)
+	copy(data, (*[syscall.NLMSG_HDRLEN]byte)(unsafe.Pointer(&h))[:])
+
+	return data
+}
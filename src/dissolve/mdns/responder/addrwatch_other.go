@@ -0,0 +1,17 @@
+//+build !linux
+
+package responder
+
+import (
+	"context"
+)
+
+// watchAddresses calls fn whenever an IP address is added to or removed from
+// any network interface, until ctx is canceled.
+//
+// It is not supported on this platform, in which case address changes are
+// detected by the responder's periodic interface polling alone.
+func watchAddresses(ctx context.Context, fn func()) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
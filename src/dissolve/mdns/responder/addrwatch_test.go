@@ -0,0 +1,116 @@
+package responder_test
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder handling of address changes", func() {
+	var (
+		network    *testNetwork
+		renumbered *renumberedNetwork
+		eth0       *transport.VirtualInterface
+		r          *testResponder
+		q          *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+
+		eth0 = network.Link.NewInterface("eth0", cidr("192.168.1.10/24"))
+		vn := transport.VirtualNetwork{eth0}
+		renumbered = &renumberedNetwork{VirtualNetwork: vn}
+
+		r = network.Attach(
+			eth0,
+			renumbered,
+			transport.NewVirtualTransport(vn),
+			newTestAnswerer(nil, nil),
+			PublishHost(NewHostWithName("myhost")),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("sends goodbye packets for old address records and announces the new ones", func() {
+		renumbered.Set(eth0, cidr("192.168.1.11/24"))
+		network.Advance(5 * time.Second)
+
+		var goodbye, announced []dns.RR
+		for len(goodbye) == 0 || len(announced) == 0 {
+			m := q.Receive()
+			Expect(m.Response).To(BeTrue())
+
+			for _, rr := range m.Answer {
+				if rr.Header().Ttl == 0 {
+					goodbye = append(goodbye, rr)
+				} else {
+					announced = append(announced, rr)
+				}
+			}
+		}
+
+		Expect(goodbye).To(ConsistOf(sameRecord("myhost.local. 0 IN A 192.168.1.10")))
+		Expect(announced).To(ConsistOf(sameRecord("myhost.local. 120 IN A 192.168.1.11")))
+
+		u, _ := mdns.IsUniqueRecord(announced[0])
+		Expect(u).To(BeTrue())
+
+		Expect(r.Published()).To(ConsistOf(sameRecord("myhost.local. 120 IN A 192.168.1.11")))
+	})
+
+	It("does not re-announce the records if the addresses are unchanged", func() {
+		network.Advance(5 * time.Second)
+		q.ExpectNothing()
+	})
+})
+
+// renumberedNetwork is a virtual network in which the addresses of each
+// interface can be changed while a responder is running.
+type renumberedNetwork struct {
+	transport.VirtualNetwork
+
+	m     sync.Mutex
+	addrs map[int][]net.Addr
+}
+
+// Addrs returns the unicast addresses assigned to iface.
+func (n *renumberedNetwork) Addrs(iface net.Interface) ([]net.Addr, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if addrs, ok := n.addrs[iface.Index]; ok {
+		return addrs, nil
+	}
+
+	return n.VirtualNetwork.Addrs(iface)
+}
+
+// Set replaces the addresses of an interface.
+func (n *renumberedNetwork) Set(vi *transport.VirtualInterface, addrs ...*net.IPNet) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if n.addrs == nil {
+		n.addrs = map[int][]net.Addr{}
+	}
+
+	var x []net.Addr
+	for _, a := range addrs {
+		x = append(x, a)
+	}
+
+	n.addrs[vi.Interface().Index] = x
+}
@@ -5,6 +5,7 @@ import (
 	"net"
 
 	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
 
 	"github.com/miekg/dns"
 )
@@ -16,12 +17,52 @@ type Answerer interface {
 	Answer(context.Context, *Question, *Answer) error
 }
 
+// Publisher is an Answerer that can enumerate the names of the records that it
+// publishes.
+//
+// The responder queries a publisher for all records (qtype ANY) at each of its
+// names when it starts, so that any unique records can be probed before the
+// responder answers questions about them.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.
+type Publisher interface {
+	Answerer
+
+	// Names returns the names of the records published on the given
+	// interface.
+	// The implementation must allow concurrent calls.
+	Names(context.Context, net.Interface) ([]names.FQDN, error)
+}
+
+// Notifier is a Publisher that notifies the responder when its records change,
+// so that they can be announced to the network.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.4.
+type Notifier interface {
+	Publisher
+
+	// Notify registers fn to be called whenever the records published by the
+	// answerer are changed.
+	//
+	// fn does not block, and may be called from any goroutine.
+	Notify(fn func())
+}
+
 // Question encapsulates a DNS question.
 type Question struct {
 	dns.Question
 
 	Query     *dns.Msg
 	Interface net.Interface
+
+	// KnownAnswers contains the records that the querier already has in its
+	// cache, as listed in the answer section of the query.
+	//
+	// The responder removes known answers from the response automatically,
+	// answerers may use IsKnownAnswer() to avoid producing them at all.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-7.1.
+	KnownAnswers []dns.RR
 }
 
 // Answer is an answer to a DNS question.
@@ -45,24 +86,38 @@ type Answer struct {
 	//
 	// See // https://tools.ietf.org/html/rfc6762#section-2.
 	Shared ResponseSections
+
+	// owned is the set of record types at each of the names declared by
+	// calls to Owns().
+	owned []ownedTypes
+}
+
+// count returns the number of records in the answer.
+func (a *Answer) count() int {
+	return a.Unique.count() + a.Shared.count()
 }
 
 // appendToMessage appends the answer's records to m.
 func (a *Answer) appendToMessage(m *dns.Msg, legacy bool) {
 	if legacy {
-		m.Answer = append(m.Answer, a.Unique.AnswerSection...)
-		m.Ns = append(m.Ns, a.Unique.AuthoritySection...)
-		m.Extra = append(m.Extra, a.Unique.AdditionalSection...)
-	} else {
-		m.Answer = appendUnique(m.Answer, a.Unique.AnswerSection)
-		m.Ns = appendUnique(m.Ns, a.Unique.AuthoritySection)
-		m.Extra = appendUnique(m.Extra, a.Unique.AdditionalSection)
+		m.Answer = appendLegacy(m.Answer, a.Unique.AnswerSection)
+		m.Ns = appendLegacy(m.Ns, a.Unique.AuthoritySection)
+		m.Extra = appendLegacy(m.Extra, a.Unique.AdditionalSection)
+
+		m.Answer = appendLegacy(m.Answer, a.Shared.AnswerSection)
+		m.Ns = appendLegacy(m.Ns, a.Shared.AuthoritySection)
+		m.Extra = appendLegacy(m.Extra, a.Shared.AdditionalSection)
+
+		return
 	}
 
+	m.Answer = appendUnique(m.Answer, a.Unique.AnswerSection)
+	m.Ns = appendUnique(m.Ns, a.Unique.AuthoritySection)
+	m.Extra = appendUnique(m.Extra, a.Unique.AdditionalSection)
+
 	m.Answer = append(m.Answer, a.Shared.AnswerSection...)
 	m.Ns = append(m.Ns, a.Shared.AuthoritySection...)
 	m.Extra = append(m.Extra, a.Shared.AdditionalSection...)
-
 }
 
 // appendUnique appends copies of the records in source to target, with the
@@ -78,6 +133,37 @@ func appendUnique(target, source []dns.RR) []dns.RR {
 	return target
 }
 
+// legacyTTL is the maximum TTL, in seconds, of records sent in response to a
+// legacy query.
+const legacyTTL = 10
+
+// appendLegacy appends copies of the records in source to target, with TTLs
+// suitable for a response to a legacy querier.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.7.
+func appendLegacy(target, source []dns.RR) []dns.RR {
+	for _, r := range source {
+		// The resource record TTL given in a legacy unicast response SHOULD
+		// NOT be greater than ten seconds, even if the true TTL of the
+		// Multicast DNS resource record is higher.  This is because Multicast
+		// DNS responders that fully participate in the protocol use the
+		// cache coherency mechanisms described in Section 10 to update and
+		// invalidate stale data.  Were unicast responses sent to legacy
+		// resolvers to use the same high TTLs, these legacy resolvers, which
+		// do not implement these cache coherency mechanisms, could retain
+		// stale cached resource record data long after it is no longer
+		// valid.
+		if r.Header().Ttl > legacyTTL {
+			r = dns.Copy(r)
+			r.Header().Ttl = legacyTTL
+		}
+
+		target = append(target, r)
+	}
+
+	return target
+}
+
 // ResponseSections contains the various response sections of a response to a
 // DNS query.
 type ResponseSections struct {
@@ -93,6 +179,13 @@ func (rs *ResponseSections) IsEmpty() bool {
 		len(rs.AdditionalSection) == 0
 }
 
+// count returns the number of records in all sections.
+func (rs *ResponseSections) count() int {
+	return len(rs.AnswerSection) +
+		len(rs.AuthoritySection) +
+		len(rs.AdditionalSection)
+}
+
 // Answer appends records to the "answer" section of the answer.
 func (rs *ResponseSections) Answer(records ...dns.RR) {
 	rs.AnswerSection = append(rs.AnswerSection, records...)
@@ -122,3 +215,47 @@ func (an UnionAnswerer) Answer(ctx context.Context, q *Question, a *Answer) erro
 
 	return nil
 }
+
+// Names returns the names of the records published on the given interface by
+// those answerers that implement Publisher.
+func (an UnionAnswerer) Names(ctx context.Context, iface net.Interface) ([]names.FQDN, error) {
+	var result []names.FQDN
+
+	for _, x := range an {
+		if p, ok := x.(Publisher); ok {
+			n, err := p.Names(ctx, iface)
+			if err != nil {
+				return nil, err
+			}
+
+			result = append(result, n...)
+		}
+	}
+
+	return result, nil
+}
+
+// Rename re-publishes the unique records at the given name under a new name
+// using the first of those answerers that implement Renamer and own the name.
+func (an UnionAnswerer) Rename(ctx context.Context, n names.FQDN) (names.FQDN, bool, error) {
+	for _, x := range an {
+		if rn, ok := x.(Renamer); ok {
+			renamed, ok, err := rn.Rename(ctx, n)
+			if err != nil || ok {
+				return renamed, ok, err
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+// Notify registers fn to be called whenever the records published by any of
+// those answerers that implement Notifier are changed.
+func (an UnionAnswerer) Notify(fn func()) {
+	for _, x := range an {
+		if n, ok := x.(Notifier); ok {
+			n.Notify(fn)
+		}
+	}
+}
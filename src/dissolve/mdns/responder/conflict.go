@@ -0,0 +1,223 @@
+package responder
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+)
+
+const (
+	// conflictLimit is the number of conflicts that may occur within
+	// conflictWindow before the responder begins to rate-limit probing.
+	conflictLimit = 15
+
+	// conflictWindow is the period over which conflicts are counted.
+	conflictWindow = 10 * time.Second
+
+	// conflictBackOff is the time the responder waits before probing once
+	// conflictLimit has been reached.
+	conflictBackOff = 5 * time.Second
+)
+
+// Conflict describes a name that has been claimed by another responder on the
+// network.
+type Conflict struct {
+	// Name is the name that is in conflict.
+	Name names.FQDN
+
+	// Source is the address of the responder that claimed the name.
+	Source *net.UDPAddr
+
+	// RenamedTo is the name under which the records have been re-published, if
+	// automatic renaming is enabled and the answerer supports it.
+	// It is empty if the records were not renamed.
+	RenamedTo names.FQDN
+}
+
+// ConflictHandler is a function that is called when a conflict is detected.
+//
+// It is called on its own goroutine.
+type ConflictHandler func(Conflict)
+
+// Renamer is an Answerer that can re-publish its unique records under a new
+// name when a conflict is detected.
+type Renamer interface {
+	Answerer
+
+	// Rename re-publishes the unique records at the given name under a new
+	// name, returning the new name.
+	//
+	// It returns false if the records at the given name can not be renamed.
+	// The implementation must allow concurrent calls.
+	Rename(ctx context.Context, n names.FQDN) (names.FQDN, bool, error)
+}
+
+// conflict handles the loss of n to another responder on ifc. The records are
+// re-published under a new name if they can be renamed, otherwise probing for
+// n begins again.
+//
+// See https://tools.ietf.org/html/rfc6762#section-9.
+func (r *Responder) conflict(
+	ctx context.Context,
+	ifc *ifaceContext,
+	n *uniqueName,
+	src *net.UDPAddr,
+) {
+	n.State = stateConflicted
+	n.probe = nil
+
+	r.logger.Log(
+		"the name '%s' is already in use by the mDNS responder at %s on %s",
+		n.Name,
+		src,
+		ifc.Interface.Name,
+	)
+
+	r.recordConflict()
+	r.stats.add(&r.stats.conflicts, 1)
+
+	c := &resolveConflict{
+		Interface: ifc.Interface.Index,
+		Name:      n,
+		Conflict: Conflict{
+			Name:   names.FQDN(n.Name),
+			Source: src,
+		},
+	}
+
+	if rn, ok := r.renamerFor(c.Conflict.Name); ok {
+		r.submit(ctx, &renameJob{rn, c})
+		return
+	}
+
+	_ = c.Execute(ctx, r) // always nil
+}
+
+// renameJob is a job that renames the records at a conflicted name.
+type renameJob struct {
+	Renamer Renamer
+	Result  *resolveConflict
+}
+
+// Run renames the records, within the query deadline, and passes the result
+// to the main loop.
+func (j *renameJob) Run(ctx context.Context, r *Responder) {
+	rctx, cancel := r.withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	c := j.Result
+	n := c.Conflict.Name
+
+	renamed, ok, err := j.Renamer.Rename(rctx, n)
+	if err != nil {
+		r.logger.Log("unable to rename '%s': %s", n, err)
+	} else if ok {
+		r.logger.Log("renamed '%s' to '%s'", n, renamed)
+		c.Conflict.RenamedTo = renamed
+	}
+
+	_ = r.execute(ctx, c) // only fails if the responder is stopping
+}
+
+// resolveConflict is a command that updates the responder's state after a
+// conflict, once any attempt to rename the conflicted records is complete.
+type resolveConflict struct {
+	Interface int
+	Name      *uniqueName
+	Conflict  Conflict
+}
+
+func (c *resolveConflict) Execute(ctx context.Context, r *Responder) error {
+	if r.onConflict != nil {
+		go r.onConflict(c.Conflict)
+	}
+
+	// the interface may have been removed, or the name withdrawn by the
+	// answerer, in the meantime
+	ifc, ok := r.interfaces[c.Interface]
+	if !ok || ifc.Names[canonicalName(c.Name.Name)] != c.Name {
+		return nil
+	}
+
+	if c.Conflict.RenamedTo == "" {
+		// https://tools.ietf.org/html/rfc6762#section-9
+		//
+		// [...] the host MUST immediately reset its configuration to the
+		// probing state, and proceed from step one.
+		r.beginProbing(ctx, ifc, 0, []*uniqueName{c.Name})
+		return nil
+	}
+
+	// the name now belongs to the other responder, so it is forgotten
+	// without sending goodbye packets on this interface
+	delete(ifc.Names, canonicalName(c.Name.Name))
+
+	// the records have moved on every interface, not just the one on which
+	// the conflict occurred
+	for _, x := range r.interfaces {
+		r.publish(ctx, x)
+	}
+
+	// names that are not published by the answerer are discovered, as they
+	// would be when answering a question
+	r.discover(ctx, ifc, []string{c.Conflict.RenamedTo.String()})
+
+	return nil
+}
+
+// renamerFor returns the Renamer used to rename n after a conflict.
+//
+// The host name is always renamed, as the host's address records are of little
+// use under a name that is owned by another host. Other names are only renamed
+// if automatic renaming is enabled.
+func (r *Responder) renamerFor(n names.FQDN) (Renamer, bool) {
+	if r.host != nil && strings.EqualFold(n.String(), r.host.Name().String()) {
+		return r.host, true
+	}
+
+	if !r.autoRename {
+		return nil, false
+	}
+
+	rn, ok := r.answerer.(Renamer)
+	return rn, ok
+}
+
+// recordConflict records the occurrence of a conflict.
+func (r *Responder) recordConflict() {
+	r.expireConflicts()
+	r.conflicts = append(r.conflicts, r.now())
+}
+
+// probeBackOff returns the delay that must be observed before probing, based
+// on the number of recent conflicts.
+func (r *Responder) probeBackOff() time.Duration {
+	r.expireConflicts()
+
+	// https://tools.ietf.org/html/rfc6762#section-8.1
+	//
+	// If fifteen conflicts occur within any ten-second period, then the
+	// host MUST wait at least five seconds before each successive
+	// additional probe attempt.
+	if len(r.conflicts) >= conflictLimit {
+		return conflictBackOff
+	}
+
+	return 0
+}
+
+// expireConflicts removes the conflicts that occurred before the current
+// conflict window.
+func (r *Responder) expireConflicts() {
+	threshold := r.now().Add(-conflictWindow)
+
+	i := 0
+	for i < len(r.conflicts) && r.conflicts[i].Before(threshold) {
+		i++
+	}
+
+	r.conflicts = r.conflicts[i:]
+}
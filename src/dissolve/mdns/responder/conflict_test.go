@@ -0,0 +1,308 @@
+package responder_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder conflict resolution", func() {
+	var (
+		network   *testNetwork
+		answerer  *testAnswerer
+		q         *querier
+		conflicts chan Conflict
+		handler   Option
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		answerer = newTestAnswerer(
+			[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+			nil,
+		)
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+
+		conflicts = make(chan Conflict, 100)
+		handler = UseConflictHandler(func(c Conflict) {
+			conflicts <- c
+		})
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// start starts r and discards its first probe.
+	start := func(r *testResponder) {
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		Expect(q.Receive().Response).To(BeFalse())
+	}
+
+	// respond multicasts an unsolicited response from q containing the given
+	// records.
+	respond := func(records ...string) {
+		m := mdns.NewUnsolicitedResponse()
+		for _, s := range records {
+			m.Answer = append(m.Answer, rr(s))
+		}
+
+		q.Send(m)
+	}
+
+	// conflict waits for the conflict handler to be called.
+	//
+	// The handler is called while the responder is handling the conflicting
+	// response, so once the responder is synced any probing that has restarted
+	// is scheduled.
+	conflict := func(r *testResponder) Conflict {
+		var c Conflict
+		EventuallyWithOffset(1, conflicts).Should(Receive(&c))
+		r.Sync()
+
+		return c
+	}
+
+	Context("while probing", func() {
+		It("restarts probing if a response contains other records with the same name", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			start(r)
+
+			respond("host.local. 120 IN A 192.168.1.30")
+
+			c := conflict(r)
+			Expect(c.Name).To(Equal(names.FQDN("host.local.")))
+			Expect(c.Source.IP.Equal(net.ParseIP("192.168.1.20"))).To(BeTrue())
+			Expect(c.RenamedTo).To(BeEmpty())
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Question[0].Name).To(Equal("host.local."))
+
+			unicast, _ := mdns.WantsUnicastResponse(m.Question[0])
+			Expect(unicast).To(BeTrue())
+		})
+
+		It("does not consider a response containing identical records to be a conflict", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			start(r)
+
+			respond("host.local. 120 IN A 192.168.1.10")
+
+			Consistently(conflicts).ShouldNot(Receive())
+
+			network.Advance(250 * time.Millisecond)
+
+			m := q.Receive()
+			unicast, _ := mdns.WantsUnicastResponse(m.Question[0])
+			Expect(unicast).To(BeFalse())
+		})
+
+		It("renames the records if automatic renaming is enabled", func() {
+			answerer.Renames = true
+
+			r := network.NewResponder(
+				"eth0", "192.168.1.10/24",
+				answerer,
+				handler,
+				EnableAutoRename,
+			)
+			start(r)
+
+			respond("host.local. 120 IN A 192.168.1.30")
+
+			c := conflict(r)
+			Expect(c.Name).To(Equal(names.FQDN("host.local.")))
+			Expect(c.RenamedTo).To(Equal(names.FQDN("host-2.local.")))
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Question[0].Name).To(Equal("host-2.local."))
+			Expect(m.Ns).To(haveRecord("host-2.local. 120 IN A 192.168.1.10"))
+
+			for i := 0; i < 3; i++ {
+				network.Advance(250 * time.Millisecond)
+				q.Receive()
+			}
+
+			records := r.Published()
+			Expect(records).To(HaveLen(1))
+			Expect(records).To(haveRecord("host-2.local. 120 IN A 192.168.1.10"))
+		})
+
+		It("does not rename the records if automatic renaming is disabled", func() {
+			answerer.Renames = true
+
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			start(r)
+
+			respond("host.local. 120 IN A 192.168.1.30")
+
+			c := conflict(r)
+			Expect(c.RenamedTo).To(BeEmpty())
+
+			m := q.Receive()
+			Expect(m.Question[0].Name).To(Equal("host.local."))
+		})
+
+		It("waits five seconds before each probe once fifteen conflicts have occurred within ten seconds", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			start(r)
+
+			for i := 1; i < 15; i++ {
+				respond("host.local. 120 IN A 192.168.1.30")
+				conflict(r)
+
+				// probing restarts immediately
+				Expect(q.Receive().Response).To(BeFalse())
+			}
+
+			respond("host.local. 120 IN A 192.168.1.30")
+			conflict(r)
+
+			network.Advance(4999 * time.Millisecond)
+			q.ExpectNothing()
+			network.Advance(1 * time.Millisecond)
+
+			Expect(q.Receive().Response).To(BeFalse())
+		})
+
+		It("stops backing off once the earlier conflicts are more than ten seconds old", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			start(r)
+
+			for i := 0; i < 15; i++ {
+				respond("host.local. 120 IN A 192.168.1.30")
+				conflict(r)
+			}
+
+			// the probe that was delayed by five seconds
+			network.Advance(11 * time.Second)
+			Expect(q.Receive().Response).To(BeFalse())
+
+			respond("host.local. 120 IN A 192.168.1.30")
+			conflict(r)
+
+			Expect(q.Receive().Response).To(BeFalse())
+		})
+	})
+
+	Context("once established", func() {
+		It("defends the name if its own records are lexicographically later", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			network.Establish(r, q)
+
+			respond("host.local. 120 IN A 192.168.1.5")
+
+			// the defending response is sent immediately
+			m := q.Receive()
+			Expect(m.Response).To(BeTrue())
+			Expect(m.Answer).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+
+			Consistently(conflicts).ShouldNot(Receive())
+			Expect(r.Published()).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+		})
+
+		It("yields the name if the other records are lexicographically later", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			network.Establish(r, q)
+
+			respond("host.local. 120 IN A 192.168.1.30")
+
+			c := conflict(r)
+			Expect(c.Name).To(Equal(names.FQDN("host.local.")))
+			Expect(r.Published()).To(BeEmpty())
+
+			// probing restarts immediately
+			Expect(q.Receive().Response).To(BeFalse())
+		})
+
+		It("ignores goodbye records", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			network.Establish(r, q)
+
+			respond("host.local. 0 IN A 192.168.1.30")
+
+			Consistently(conflicts).ShouldNot(Receive())
+			q.ExpectNothing()
+			Expect(r.Published()).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+		})
+
+		It("ignores records of other types", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer, handler)
+			network.Establish(r, q)
+
+			respond("host.local. 120 IN TXT \"other\"")
+
+			Consistently(conflicts).ShouldNot(Receive())
+			q.ExpectNothing()
+		})
+	})
+
+	It("renames the records of a responder that loses a name to another responder on the same link", func() {
+		answerer.Renames = true
+
+		a := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			handler,
+			EnableAutoRename,
+		)
+		b := network.NewResponder(
+			"eth2", "192.168.1.30/24",
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.30")},
+				nil,
+			),
+		)
+
+		network.Establish(b, q)
+
+		a.Start()
+		network.Clock.BlockUntil(2)
+		network.Clock.Advance(0)
+
+		// b defends its name against a's first probe
+		m := q.Receive()
+		Expect(m.Response).To(BeFalse())
+		Expect(m.Question[0].Name).To(Equal("host.local."))
+
+		c := conflict(a)
+		Expect(c.RenamedTo).To(Equal(names.FQDN("host-2.local.")))
+
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				network.Advance(250 * time.Millisecond)
+			}
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Question[0].Name).To(Equal("host-2.local."))
+		}
+
+		network.Advance(250 * time.Millisecond)
+
+		m = q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host-2.local. 120 IN A 192.168.1.10"),
+		))
+
+		Expect(a.Published()).To(ConsistOf(
+			sameRecord("host-2.local. 120 IN A 192.168.1.10"),
+		))
+		Expect(b.Published()).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.30"),
+		))
+	})
+})
@@ -0,0 +1,140 @@
+package responder
+
+import (
+	"context"
+	"net"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+)
+
+// handlePacket is a command that routes an inbound packet to the context of the
+// interface on which it was received, before handling it as a query or a
+// response.
+type handlePacket struct {
+	Packet  *transport.InboundPacket
+	Message *dns.Msg
+}
+
+func (c *handlePacket) Execute(ctx context.Context, r *Responder) error {
+	if _, ok := r.demux(c.Packet); !ok {
+		r.stats.add(&r.stats.dropped, 1)
+		c.Packet.Close()
+		return nil
+	}
+
+	r.stats.packet(r.stats.received, c.Packet.Transport, c.Packet.Source.InterfaceIndex)
+
+	if c.Message.Response {
+		return (&handleResponse{c.Packet, c.Message}).Execute(ctx, r)
+	}
+
+	return (&handleQuery{c.Packet, c.Message}).Execute(ctx, r)
+}
+
+// demux returns the context for the interface on which p was received.
+//
+// The transports bind to the wildcard address, so they receive packets from
+// every interface, not only those on which they have joined their multicast
+// group. It returns false if the responder is not serving the interface via
+// p's transport, or if p did not originate on the link attached to that
+// interface, in which case the packet must be ignored.
+//
+// If the transport was unable to determine the interface on which p was
+// received, it is inferred from the source address, and p is updated to refer
+// to that interface.
+//
+// See https://tools.ietf.org/html/rfc6762#section-5.5 and
+// https://tools.ietf.org/html/rfc6762#section-11.
+func (r *Responder) demux(p *transport.InboundPacket) (*ifaceContext, bool) {
+	var (
+		ifc *ifaceContext
+		ok  bool
+	)
+
+	if p.Source.InterfaceIndex == 0 {
+		ifc, ok = r.inferInterface(p)
+		if !ok {
+			r.logger.Debug(
+				"ignoring mDNS packet from %s, unable to determine the interface on which it was received",
+				p.Source.Address,
+			)
+
+			return nil, false
+		}
+
+		p.Source.InterfaceIndex = ifc.Interface.Index
+	} else {
+		ifc, ok = r.interfaces[p.Source.InterfaceIndex]
+		if !ok || !ifc.hasTransport(p.Transport) {
+			return nil, false
+		}
+	}
+
+	// the interface's prefixes are only needed for packets that were not sent
+	// to the multicast group
+	if !p.IsMulticast() && !p.IsOnLink(r.prefixes(ifc)) {
+		r.logger.Debug(
+			"ignoring mDNS packet from off-link source %s on %s",
+			p.Source.Address,
+			ifc.Interface.Name,
+		)
+
+		return nil, false
+	}
+
+	return ifc, true
+}
+
+// inferInterface returns the context for the interface on which p must have
+// been received, based on its source address.
+//
+// A link-local IPv6 source address identifies the interface by its zone.
+// Otherwise, the interface is the one with a network prefix that contains the
+// source address. It returns false if there is not exactly one such interface.
+func (r *Responder) inferInterface(p *transport.InboundPacket) (*ifaceContext, bool) {
+	var matches []*ifaceContext
+
+	for _, ifc := range r.interfaces {
+		if !ifc.hasTransport(p.Transport) {
+			continue
+		}
+
+		if z := p.Source.Address.Zone; z != "" {
+			if z == ifc.Interface.Name {
+				matches = append(matches, ifc)
+			}
+		} else if containsIP(r.prefixes(ifc), p.Source.Address.IP) {
+			matches = append(matches, ifc)
+		}
+	}
+
+	if len(matches) != 1 {
+		return nil, false
+	}
+
+	return matches[0], true
+}
+
+// hasTransport returns true if t has joined its multicast group on the
+// interface.
+func (ifc *ifaceContext) hasTransport(t transport.Transport) bool {
+	for _, x := range ifc.Transports {
+		if x == t {
+			return true
+		}
+	}
+
+	return false
+}
+
+// containsIP returns true if any of the given prefixes contain ip.
+func containsIP(prefixes []*net.IPNet, ip net.IP) bool {
+	for _, n := range prefixes {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,192 @@
+package responder_test
+
+import (
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder handling of off-link packets", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+
+		vi := network.Link.NewInterface("eth0", cidr("192.168.1.10/24"))
+		vn := transport.VirtualNetwork{vi}
+
+		r = network.Attach(
+			vi,
+			vn,
+			unknownHopLimitTransport{transport.NewVirtualTransport(vn)},
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+				nil,
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("answers direct unicast queries from sources within the interface's network prefixes", func() {
+		q.SendTo("192.168.1.10", mdns.NewQuery(false, question("host.local.", dns.TypeA)))
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+
+	It("ignores direct unicast queries from off-link sources", func() {
+		remote := network.NewQuerier("eth2", "10.0.0.20/24", 0)
+		remote.SendTo("192.168.1.10", mdns.NewQuery(false, question("host.local.", dns.TypeA)))
+
+		Consistently(r.Tracer.Queries).ShouldNot(Receive())
+		q.ExpectNothing()
+	})
+
+	It("answers multicast queries from off-link sources", func() {
+		remote := network.NewQuerier("eth2", "10.0.0.20/24", 0)
+		remote.Query(question("host.local.", dns.TypeA))
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+})
+
+var _ = Describe("Responder demultiplexing of inbound packets", func() {
+	var (
+		network    *testNetwork
+		eth0, eth1 *transport.VirtualInterface
+		q0, q1     *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		link := &transport.Link{Clock: network.Clock}
+
+		eth0 = network.Link.NewInterface("eth0", cidr("192.168.1.10/24"))
+		eth1 = link.NewInterface("eth1", cidr("10.0.0.10/24"))
+
+		q0 = network.NewQuerier("q0", "192.168.1.20/24", 0)
+		q1 = network.NewQuerierOn(link, "q1", "10.0.0.20/24", 0)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// start starts a responder that serves both interfaces, and receives
+	// packets via a transport that modifies them using fn.
+	start := func(fn func(*transport.InboundPacket), options ...Option) *testResponder {
+		vn := transport.VirtualNetwork{eth0, eth1}
+
+		r := network.Attach(
+			eth0,
+			vn,
+			&misdirectedTransport{transport.NewVirtualTransport(vn), fn},
+			interfaceAnswerer{
+				"eth0": rr("host.local. 120 IN A 192.168.1.10"),
+				"eth1": rr("host.local. 120 IN A 10.0.0.10"),
+			},
+			options...,
+		)
+
+		network.Establish(r, q0)
+		q1.Drain()
+
+		return r
+	}
+
+	It("infers the interface from the source address if the transport could not determine it", func() {
+		r := start(func(p *transport.InboundPacket) {
+			p.Source.InterfaceIndex = 0
+		})
+
+		q1.Query(question("host.local.", dns.TypeA))
+
+		Expect(r.HandledQuery().Interface).To(Equal(eth1.Interface().Index))
+
+		m := q1.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 10.0.0.10")))
+		q0.ExpectNothing()
+	})
+
+	It("ignores packets from sources that do not identify an interface, if the transport could not determine it", func() {
+		r := start(func(p *transport.InboundPacket) {
+			p.Source.InterfaceIndex = 0
+		})
+
+		remote := network.NewQuerier("eth2", "172.16.0.20/24", 0)
+		remote.Query(question("host.local.", dns.TypeA))
+
+		Consistently(r.Tracer.Queries).ShouldNot(Receive())
+	})
+
+	It("ignores packets received on interfaces that it does not serve", func() {
+		r := start(
+			func(p *transport.InboundPacket) {
+				// report every packet as received on eth1
+				p.Source.InterfaceIndex = eth1.Interface().Index
+			},
+			UseInterface(eth0.Interface()),
+		)
+
+		q0.Query(question("host.local.", dns.TypeA))
+
+		Consistently(r.Tracer.Queries).ShouldNot(Receive())
+		q0.ExpectNothing()
+
+		Expect(r.Stats().DroppedPackets).To(BeEquivalentTo(1))
+	})
+})
+
+// misdirectedTransport is a virtual transport that modifies each packet it
+// receives, to simulate a transport that receives packets from interfaces
+// other than those on which it has joined its multicast group.
+type misdirectedTransport struct {
+	*transport.VirtualTransport
+
+	Modify func(*transport.InboundPacket)
+}
+
+// Read reads the next packet from the transport.
+func (t *misdirectedTransport) Read() (*transport.InboundPacket, error) {
+	p, err := t.VirtualTransport.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	t.Modify(p)
+
+	return p, nil
+}
+
+// unknownHopLimitTransport is a virtual transport that can not determine the
+// hop limit of the packets it receives, such that only their source addresses
+// show whether they originated on the local link.
+type unknownHopLimitTransport struct {
+	*transport.VirtualTransport
+}
+
+// Read reads the next packet from the transport.
+func (t unknownHopLimitTransport) Read() (*transport.InboundPacket, error) {
+	p, err := t.VirtualTransport.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	p.Transport = t
+	p.HopLimit = -1
+
+	return p, nil
+}
@@ -0,0 +1,267 @@
+package responder_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/types"
+)
+
+// testAnswerer is a Notifier that publishes a set of unique and shared
+// records, which can be changed while the responder is running.
+//
+// If Renames is true it is also a Renamer, which renames records by appending
+// "-2" to the first label of their name.
+type testAnswerer struct {
+	// Renames enables renaming of records after a conflict.
+	Renames bool
+
+	// Slow is a name that the answerer takes forever to answer questions
+	// about. Answer() blocks until its context is canceled.
+	Slow string
+
+	m         sync.Mutex
+	unique    []dns.RR
+	shared    []dns.RR
+	observers []func()
+}
+
+// newTestAnswerer returns an answerer that publishes the given unique and
+// shared records.
+func newTestAnswerer(unique, shared []dns.RR) *testAnswerer {
+	return &testAnswerer{
+		unique: unique,
+		shared: shared,
+	}
+}
+
+// Answer populates an answer to a single DNS question.
+func (a *testAnswerer) Answer(ctx context.Context, q *Question, ans *Answer) error {
+	if a.Slow != "" && strings.EqualFold(q.Name, a.Slow) {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	var types []uint16
+
+	for _, rr := range a.unique {
+		h := rr.Header()
+		if !strings.EqualFold(h.Name, q.Name) {
+			continue
+		}
+
+		types = append(types, h.Rrtype)
+
+		if q.Qtype == dns.TypeANY || q.Qtype == h.Rrtype {
+			ans.Unique.Answer(dns.Copy(rr))
+		}
+	}
+
+	if len(types) != 0 {
+		ans.Owns(q.Name, a.unique[0].Header().Ttl, types...)
+	}
+
+	for _, rr := range a.shared {
+		h := rr.Header()
+		if !strings.EqualFold(h.Name, q.Name) {
+			continue
+		}
+
+		if q.Qtype == dns.TypeANY || q.Qtype == h.Rrtype {
+			ans.Shared.Answer(dns.Copy(rr))
+		}
+	}
+
+	return nil
+}
+
+// Names returns the names of the records published on the given interface.
+func (a *testAnswerer) Names(context.Context, net.Interface) ([]names.FQDN, error) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	var (
+		result []names.FQDN
+		seen   = map[string]struct{}{}
+	)
+
+	for _, records := range [][]dns.RR{a.unique, a.shared} {
+		for _, rr := range records {
+			k := strings.ToLower(rr.Header().Name)
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				result = append(result, names.FQDN(rr.Header().Name))
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// Notify registers fn to be called whenever the records are changed.
+func (a *testAnswerer) Notify(fn func()) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	a.observers = append(a.observers, fn)
+}
+
+// Rename renames the unique records at n by appending "-2" to the first label.
+func (a *testAnswerer) Rename(ctx context.Context, n names.FQDN) (names.FQDN, bool, error) {
+	if !a.Renames {
+		return "", false, nil
+	}
+
+	a.m.Lock()
+
+	i := strings.IndexByte(n.String(), '.')
+	renamed := names.FQDN(n.String()[:i] + "-2" + n.String()[i:])
+	found := false
+
+	for j, rr := range a.unique {
+		if strings.EqualFold(rr.Header().Name, n.String()) {
+			rr = dns.Copy(rr)
+			rr.Header().Name = renamed.String()
+			a.unique[j] = rr
+			found = true
+		}
+	}
+
+	a.m.Unlock()
+
+	if !found {
+		return "", false, nil
+	}
+
+	a.notify()
+
+	return renamed, true, nil
+}
+
+// Set replaces the published records, and notifies the responder.
+func (a *testAnswerer) Set(unique, shared []dns.RR) {
+	a.m.Lock()
+	a.unique = unique
+	a.shared = shared
+	a.m.Unlock()
+
+	a.notify()
+}
+
+// notify calls each of the registered observers.
+func (a *testAnswerer) notify() {
+	a.m.Lock()
+	observers := a.observers
+	a.m.Unlock()
+
+	for _, fn := range observers {
+		fn()
+	}
+}
+
+// unpublished is an Answerer that is not a Publisher, so its unique records are
+// only discovered by the responder when it answers questions about them.
+type unpublished struct {
+	Answerer
+}
+
+// testTracer is a Tracer that records the events it receives.
+type testTracer struct {
+	Queries chan QueryEvent
+
+	m       sync.Mutex
+	packets []PacketEvent
+}
+
+// newTestTracer returns a new test tracer.
+func newTestTracer() *testTracer {
+	return &testTracer{
+		Queries: make(chan QueryEvent, 100),
+	}
+}
+
+// TracePacket records e.
+func (t *testTracer) TracePacket(e PacketEvent) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	t.packets = append(t.packets, e)
+}
+
+// TraceQuery records e.
+func (t *testTracer) TraceQuery(e QueryEvent) {
+	select {
+	case t.Queries <- e:
+	default:
+	}
+}
+
+// Packets returns the packet events received so far.
+func (t *testTracer) Packets() []PacketEvent {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	return append([]PacketEvent(nil), t.packets...)
+}
+
+// discardLogger is a logger that discards all messages.
+type discardLogger struct{}
+
+func (discardLogger) Log(string, ...interface{})   {}
+func (discardLogger) LogString(string)             {}
+func (discardLogger) Debug(string, ...interface{}) {}
+func (discardLogger) DebugString(string)           {}
+func (discardLogger) IsDebug() bool                { return false }
+
+// constantSource is a rand.Source that always produces the same value.
+//
+// math/rand reduces the value modulo the size of the requested range, so each
+// random delay chosen by the responder is the minimum of its range plus d,
+// provided d is smaller than the range.
+type constantSource time.Duration
+
+func (s constantSource) Int63() int64 { return int64(s) }
+func (s constantSource) Seed(int64)   {}
+
+// rr parses a record from its text representation, such as
+// "host.local. 120 IN A 192.168.1.10".
+func rr(s string) dns.RR {
+	r, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
+
+// haveRecord returns a matcher that succeeds if a slice of records contains a
+// record with the same name, class, type and rdata as the record described by s.
+func haveRecord(s string) types.GomegaMatcher {
+	return ContainElement(sameRecord(s))
+}
+
+// sameRecord returns a matcher that succeeds if a record has the same name,
+// class, type and rdata as the record described by s. The TTL and the unique
+// record bit are ignored.
+func sameRecord(s string) types.GomegaMatcher {
+	want := rr(s)
+
+	return WithTransform(
+		func(x dns.RR) bool {
+			return strings.EqualFold(x.Header().Name, want.Header().Name) &&
+				mdns.CompareRecords(x, want) == 0
+		},
+		BeTrue(),
+	)
+}
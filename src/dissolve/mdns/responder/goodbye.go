@@ -0,0 +1,45 @@
+package responder
+
+import (
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+)
+
+// goodbye sends "goodbye" packets for the given records, which cause other
+// hosts on ifc to remove the records from their caches.
+//
+// See https://tools.ietf.org/html/rfc6762#section-10.1.
+func (r *Responder) goodbye(ifc *ifaceContext, records []dns.RR) {
+	if len(records) == 0 {
+		return
+	}
+
+	// In the case where a host knows that certain resource record data is
+	// about to become invalid (for example, when the host is undergoing a
+	// clean shutdown), the host SHOULD send an unsolicited Multicast DNS
+	// response packet, giving the same resource record name, rrtype,
+	// rrclass, and rdata, but an RR TTL of zero.
+	m := mdns.NewUnsolicitedResponse()
+
+	for _, rr := range records {
+		rr = dns.Copy(rr)
+		rr.Header().Ttl = 0
+		m.Answer = append(m.Answer, rr)
+	}
+
+	if err := r.multicast(ifc, m); err != nil {
+		r.logger.Log("error sending mDNS goodbye packet on %s: %s", ifc.Interface.Name, err)
+	} else {
+		r.stats.add(&r.stats.goodbyes, len(records))
+	}
+}
+
+// shutdown sends any pending responses, then withdraws all of the responder's
+// established records from each interface.
+func (r *Responder) shutdown() {
+	r.flushPending()
+
+	for _, ifc := range r.interfaces {
+		r.goodbye(ifc, ifc.published())
+	}
+}
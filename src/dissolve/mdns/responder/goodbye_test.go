@@ -0,0 +1,127 @@
+package responder_test
+
+import (
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder goodbye packets", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		q        *querier
+		unique   []dns.RR
+		shared   []dns.RR
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		unique = []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.10"),
+		}
+		shared = []dns.RR{
+			rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+		}
+		answerer = newTestAnswerer(unique, shared)
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// expectGoodbye expects m to contain exactly the given records, each with
+	// a TTL of zero.
+	expectGoodbye := func(m *received, records ...string) {
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(HaveLen(len(records)))
+
+		for _, s := range records {
+			Expect(m.Answer).To(haveRecord(s))
+		}
+
+		for _, x := range m.Answer {
+			Expect(x.Header().Ttl).To(BeZero())
+		}
+	}
+
+	It("sends goodbye packets for shared records that are withdrawn by the answerer", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		answerer.Set(unique, nil)
+
+		expectGoodbye(
+			q.Receive(),
+			"_http._tcp.local. 0 IN PTR web._http._tcp.local.",
+		)
+		q.ExpectNothing()
+	})
+
+	It("sends goodbye packets for unique records that are withdrawn by the answerer", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		answerer.Set(nil, shared)
+
+		expectGoodbye(
+			q.Receive(),
+			"host.local. 0 IN A 192.168.1.10",
+		)
+		q.ExpectNothing()
+
+		Expect(r.Published()).NotTo(haveRecord("host.local. 120 IN A 192.168.1.10"))
+	})
+
+	It("sends goodbye packets for all published records when it stops", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		r.Stop()
+
+		expectGoodbye(
+			q.Receive(),
+			"host.local. 0 IN A 192.168.1.10",
+			"_http._tcp.local. 0 IN PTR web._http._tcp.local.",
+		)
+	})
+
+	It("sends pending responses before the goodbye packets when it stops", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		// the response contains a shared record, so it is deferred
+		q.Query(question("_http._tcp.local.", dns.TypePTR))
+		r.HandledQuery()
+
+		r.Stop()
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+		))
+		Expect(m.Answer[0].Header().Ttl).To(BeEquivalentTo(4500))
+
+		expectGoodbye(
+			q.Receive(),
+			"host.local. 0 IN A 192.168.1.10",
+			"_http._tcp.local. 0 IN PTR web._http._tcp.local.",
+		)
+	})
+
+	It("does not send goodbye packets for records that have not been probed", func() {
+		answerer.Set(unique, nil)
+
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+		Expect(q.Receive().Response).To(BeFalse())
+
+		r.Stop()
+
+		q.ExpectNothing()
+	})
+})
@@ -0,0 +1,124 @@
+package responder
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// multicastLimit is the minimum time between multicasts of the same record
+	// on the same interface.
+	multicastLimit = 1 * time.Second
+
+	// probeMulticastLimit is the minimum time between multicasts of the same
+	// record on the same interface when responding to a probe.
+	probeMulticastLimit = 250 * time.Millisecond
+)
+
+// history is a record of when each record was last multicast on a specific
+// interface.
+type history map[string]historyEntry
+
+// historyEntry is an entry in a history.
+type historyEntry struct {
+	At  time.Time
+	TTL time.Duration
+}
+
+// Add records that the records in m were multicast at time t.
+func (h history) Add(m *dns.Msg, t time.Time) {
+	for _, rr := range responseRecords(m) {
+		h[recordKey(rr)] = historyEntry{
+			t,
+			time.Duration(rr.Header().Ttl) * time.Second,
+		}
+	}
+
+	// remove entries for records that have since expired from the caches of
+	// any hosts that received them.
+	for k, e := range h {
+		if t.Sub(e.At) > e.TTL && t.Sub(e.At) > multicastLimit {
+			delete(h, k)
+		}
+	}
+}
+
+// LastMulticast returns the time at which rr was last multicast.
+// It returns false if rr has not been multicast.
+func (h history) LastMulticast(rr dns.RR) (time.Time, bool) {
+	e, ok := h[recordKey(rr)]
+	return e.At, ok
+}
+
+// IsRecent returns true if rr was multicast within the last quarter of its TTL
+// before time t.
+//
+// See https://tools.ietf.org/html/rfc6762#section-5.4.
+func (h history) IsRecent(rr dns.RR, t time.Time) bool {
+	at, ok := h.LastMulticast(rr)
+	if !ok {
+		return false
+	}
+
+	ttl := time.Duration(rr.Header().Ttl) * time.Second
+
+	return t.Sub(at) <= ttl/4
+}
+
+// RateLimit removes any records from m that were multicast more recently than
+// d before time t.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.2.
+func (h history) RateLimit(m *dns.Msg, d time.Duration, t time.Time) {
+	filter := func(records []dns.RR) []dns.RR {
+		var result []dns.RR
+
+		for _, rr := range records {
+			if at, ok := h.LastMulticast(rr); !ok || t.Sub(at) >= d {
+				result = append(result, rr)
+			}
+		}
+
+		return result
+	}
+
+	m.Answer = filter(m.Answer)
+	m.Ns = filter(m.Ns)
+	m.Extra = filter(m.Extra)
+}
+
+// allRecent returns true if every record in the answer sections of a was
+// multicast within the last quarter of its TTL before time t.
+func (h history) allRecent(a *Answer, t time.Time) bool {
+	for _, rs := range []*ResponseSections{&a.Unique, &a.Shared} {
+		for _, rr := range rs.AnswerSection {
+			if !h.IsRecent(rr, t) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// recordKey returns a string that uniquely identifies rr by its name, class,
+// type and rdata.
+func recordKey(rr dns.RR) string {
+	rr = dns.Copy(rr)
+
+	h := rr.Header()
+	h.Name = canonicalName(h.Name)
+	h.Class &^= mdns.UniqueRecordBit
+	h.Ttl = 0
+
+	return rr.String()
+}
+
+// isProbe returns true if m is a probe query.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.1.
+func isProbe(m *dns.Msg) bool {
+	return len(m.Question) != 0 && len(m.Ns) != 0
+}
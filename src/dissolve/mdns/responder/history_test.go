@@ -0,0 +1,99 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder rate limiting", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{
+					rr("host.local. 120 IN A 192.168.1.10"),
+					rr("web._http._tcp.local. 120 IN SRV 0 0 80 host.local."),
+				},
+				nil,
+			),
+		)
+		network.Establish(r, q)
+
+		q.Query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.10"),
+		))
+		r.HandledQuery()
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("does not multicast the same record more than once per second", func() {
+		q.Query(question("host.local.", dns.TypeA))
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		network.Advance(999 * time.Millisecond)
+		q.Query(question("host.local.", dns.TypeA))
+
+		e = r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+		q.ExpectNothing()
+
+		network.Advance(1 * time.Millisecond)
+		q.Query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.10"),
+		))
+	})
+
+	It("allows records to be multicast after 250ms in response to a probe", func() {
+		probe := mdns.NewQuery(false, question("host.local.", dns.TypeANY))
+		probe.Ns = []dns.RR{rr("host.local. 120 IN A 192.168.1.99")}
+
+		network.Advance(249 * time.Millisecond)
+		q.Send(probe)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		network.Advance(1 * time.Millisecond)
+		q.Send(probe)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.10"),
+		))
+	})
+
+	It("answers the other questions in the query", func() {
+		q.Query(
+			question("host.local.", dns.TypeA),
+			question("web._http._tcp.local.", dns.TypeSRV),
+		)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("web._http._tcp.local. 120 IN SRV 0 0 80 host.local."),
+		))
+	})
+})
@@ -0,0 +1,242 @@
+package responder
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+)
+
+const (
+	// hostDomain is the domain in which the host name is published.
+	hostDomain = names.FQDN("local.")
+
+	// defaultHostLabel is the host name used if the system's host name does
+	// not contain any usable characters.
+	defaultHostLabel = "host"
+
+	// hostTTL is the TTL, in seconds, of the host's address records.
+	//
+	// As a general rule, the recommended TTL value for Multicast DNS
+	// resource records with a host name as the resource record's name
+	// (e.g., A, AAAA, HINFO) or a host name contained within the resource
+	// record's rdata (e.g., SRV, reverse mapping PTR record) SHOULD be 120
+	// seconds.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-10.
+	hostTTL = 120
+)
+
+// Host is an answerer that publishes the address records of this machine under
+// a host name in the "local." domain, such as "myhost.local.", independently
+// of any services.
+//
+// It is a Renamer, so if the name is already in use by another host it is
+// re-published under a new name, such as "myhost-2.local.". When published via
+// the PublishHost option the host is always renamed, whether or not automatic
+// renaming is enabled for other records.
+type Host struct {
+	network   transport.Network
+	m         sync.RWMutex
+	label     string
+	attempt   int
+	observers []func()
+}
+
+// NewHost returns a new host answerer that uses a name derived from the
+// system's host name.
+func NewHost() (*Host, error) {
+	n, err := os.Hostname()
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHostWithName(n), nil
+}
+
+// NewHostWithName returns a new host answerer that uses a name derived from n.
+//
+// Only the first label of n is used, and any characters other than letters,
+// digits and hyphens are replaced.
+func NewHostWithName(n string) *Host {
+	return &Host{
+		label:   sanitizeHostLabel(n),
+		attempt: 1,
+	}
+}
+
+// Name returns the host name that is currently published.
+//
+// It changes if the host is renamed after a conflict, in which case the
+// responder's ConflictHandler is called with the new name.
+func (h *Host) Name() names.FQDN {
+	h.m.RLock()
+	defer h.m.RUnlock()
+
+	return h.name()
+}
+
+// name returns the host name that is currently published.
+// It assumes h.m is already locked for reading.
+func (h *Host) name() names.FQDN {
+	l := h.label
+	if h.attempt > 1 {
+		l = fmt.Sprintf("%s-%d", l, h.attempt)
+	}
+
+	return names.Label(l).Qualify(hostDomain)
+}
+
+// Answer populates an answer to a single DNS question.
+func (h *Host) Answer(ctx context.Context, q *Question, a *Answer) error {
+	h.m.RLock()
+	n := h.name().String()
+	h.m.RUnlock()
+
+	if !strings.EqualFold(q.Name, n) {
+		return nil
+	}
+
+	network := h.network
+	if network == nil {
+		network = transport.SystemNetwork{}
+	}
+
+	addrs, err := network.Addrs(q.Interface)
+	if err != nil {
+		return err
+	}
+
+	var (
+		v4, v6 []dns.RR
+		types  []uint16
+	)
+
+	for _, addr := range addrs {
+		x, ok := addr.(*net.IPNet)
+		if !ok {
+			continue
+		}
+
+		hdr := dns.RR_Header{
+			Name:  n,
+			Class: dns.ClassINET,
+			Ttl:   hostTTL,
+		}
+
+		if ip := x.IP.To4(); ip != nil {
+			hdr.Rrtype = dns.TypeA
+			v4 = append(v4, &dns.A{Hdr: hdr, A: ip})
+		} else {
+			hdr.Rrtype = dns.TypeAAAA
+			v6 = append(v6, &dns.AAAA{Hdr: hdr, AAAA: x.IP})
+		}
+	}
+
+	if len(v4) != 0 {
+		types = append(types, dns.TypeA)
+	}
+
+	if len(v6) != 0 {
+		types = append(types, dns.TypeAAAA)
+	}
+
+	if len(types) == 0 {
+		return nil
+	}
+
+	a.Owns(n, hostTTL, types...)
+
+	switch q.Qtype {
+	case dns.TypeANY:
+		a.Unique.Answer(v4...)
+		a.Unique.Answer(v6...)
+
+	case dns.TypeA:
+		a.Unique.Answer(v4...)
+		a.Unique.Additional(v6...)
+
+	case dns.TypeAAAA:
+		a.Unique.Answer(v6...)
+		a.Unique.Additional(v4...)
+	}
+
+	return nil
+}
+
+// Names returns the names of the records published on the given interface.
+func (h *Host) Names(context.Context, net.Interface) ([]names.FQDN, error) {
+	return []names.FQDN{h.Name()}, nil
+}
+
+// Notify registers fn to be called whenever the host name changes.
+func (h *Host) Notify(fn func()) {
+	h.m.Lock()
+	defer h.m.Unlock()
+
+	h.observers = append(h.observers, fn)
+}
+
+// Rename changes the host name after a conflict, by appending or incrementing a
+// numeric suffix, for example "myhost.local." becomes "myhost-2.local.".
+//
+// It returns false if n is not the current host name.
+func (h *Host) Rename(ctx context.Context, n names.FQDN) (names.FQDN, bool, error) {
+	h.m.Lock()
+
+	if !strings.EqualFold(n.String(), h.name().String()) {
+		h.m.Unlock()
+		return "", false, nil
+	}
+
+	h.attempt++
+	renamed := h.name()
+	observers := h.observers
+
+	h.m.Unlock()
+
+	for _, fn := range observers {
+		fn()
+	}
+
+	return renamed, true, nil
+}
+
+// sanitizeHostLabel returns a DNS label suitable for use as a host name, based
+// on the first label of n.
+func sanitizeHostLabel(n string) string {
+	if i := strings.IndexByte(n, '.'); i != -1 {
+		n = n[:i]
+	}
+
+	var b strings.Builder
+
+	for _, c := range strings.ToLower(n) {
+		switch {
+		case c >= 'a' && c <= 'z',
+			c >= '0' && c <= '9':
+			b.WriteRune(c)
+		default:
+			b.WriteByte('-')
+		}
+	}
+
+	l := strings.Trim(b.String(), "-")
+
+	// leave room for a suffix such as "-99" within the 63 octet limit
+	if len(l) > 59 {
+		l = strings.TrimRight(l[:59], "-")
+	}
+
+	if l == "" {
+		return defaultHostLabel
+	}
+
+	return l
+}
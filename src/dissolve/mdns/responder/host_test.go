@@ -0,0 +1,136 @@
+package responder_test
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Host", func() {
+	Describe("NewHostWithName", func() {
+		It("uses the first label of the name, in lowercase", func() {
+			h := NewHostWithName("MyHost.example.org")
+			Expect(h.Name()).To(Equal(names.FQDN("myhost.local.")))
+		})
+
+		It("replaces characters other than letters, digits and hyphens", func() {
+			h := NewHostWithName("my_host's mac")
+			Expect(h.Name()).To(Equal(names.FQDN("my-host-s-mac.local.")))
+		})
+
+		It("uses a default name if there are no usable characters", func() {
+			h := NewHostWithName("__")
+			Expect(h.Name()).To(Equal(names.FQDN("host.local.")))
+		})
+
+		It("leaves room for a numeric suffix within the label length limit", func() {
+			h := NewHostWithName(strings.Repeat("a", 100))
+			Expect(h.Name().String()).To(HaveLen(59 + len(".local.")))
+		})
+	})
+
+	Describe("when published by a responder", func() {
+		var (
+			network   *testNetwork
+			host      *Host
+			q         *querier
+			conflicts chan Conflict
+			r         *testResponder
+		)
+
+		BeforeEach(func() {
+			network = newTestNetwork()
+			host = NewHostWithName("myhost")
+			q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+
+			conflicts = make(chan Conflict, 100)
+			r = network.NewResponder(
+				"eth0", "192.168.1.10/24",
+				newTestAnswerer(nil, nil),
+				PublishHost(host),
+				UseConflictHandler(func(c Conflict) {
+					conflicts <- c
+				}),
+			)
+		})
+
+		AfterEach(func() {
+			network.Close()
+		})
+
+		It("answers with the address records of the interface", func() {
+			network.Establish(r, q)
+
+			q.Query(question("myhost.local.", dns.TypeA))
+
+			m := q.Receive()
+			Expect(m.Answer).To(ConsistOf(sameRecord("myhost.local. 120 IN A 192.168.1.10")))
+
+			u, _ := mdns.IsUniqueRecord(m.Answer[0])
+			Expect(u).To(BeTrue())
+		})
+
+		It("asserts that the host has no address records of other types", func() {
+			network.Establish(r, q)
+
+			q.Query(question("myhost.local.", dns.TypeAAAA))
+
+			m := q.Receive()
+			Expect(m.Answer).To(HaveLen(1))
+
+			nsec, ok := m.Answer[0].(*dns.NSEC)
+			Expect(ok).To(BeTrue())
+			Expect(nsec.TypeBitMap).To(Equal([]uint16{dns.TypeA}))
+		})
+
+		It("probes the host name before announcing it", func() {
+			r.Start()
+
+			network.Clock.BlockUntil(1)
+			network.Clock.Advance(0)
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Question[0].Name).To(Equal("myhost.local."))
+			Expect(m.Ns).To(haveRecord("myhost.local. 120 IN A 192.168.1.10"))
+		})
+
+		It("renames the host after a conflict, even though automatic renaming is disabled", func() {
+			r.Start()
+
+			network.Clock.BlockUntil(1)
+			network.Clock.Advance(0)
+			Expect(q.Receive().Response).To(BeFalse())
+
+			m := mdns.NewUnsolicitedResponse()
+			m.Answer = append(m.Answer, rr("myhost.local. 120 IN A 192.168.1.20"))
+			q.Send(m)
+
+			var c Conflict
+			Eventually(conflicts).Should(Receive(&c))
+			Expect(c.Name).To(Equal(names.FQDN("myhost.local.")))
+			Expect(c.RenamedTo).To(Equal(names.FQDN("myhost-2.local.")))
+			Expect(host.Name()).To(Equal(names.FQDN("myhost-2.local.")))
+
+			r.Sync()
+
+			// the new name is probed three times, then announced
+			for i := 0; i < 3; i++ {
+				m := q.Receive()
+				Expect(m.Response).To(BeFalse())
+				Expect(m.Question[0].Name).To(Equal("myhost-2.local."))
+
+				network.Advance(250 * time.Millisecond)
+			}
+
+			Expect(q.Receive().Response).To(BeTrue())
+			Expect(r.Published()).To(ConsistOf(sameRecord("myhost-2.local. 120 IN A 192.168.1.10")))
+		})
+	})
+})
@@ -0,0 +1,59 @@
+package responder
+
+import (
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+)
+
+// instrumentedTransport is a transport that records statistics about, and
+// traces, the packets sent and received by another transport.
+type instrumentedTransport struct {
+	transport.Transport
+	r *Responder
+}
+
+func (t *instrumentedTransport) Read() (*transport.InboundPacket, error) {
+	in, err := t.Transport.Read()
+	if err != nil {
+		return nil, err
+	}
+
+	// responses are sent via the transport that the packet arrived on, so
+	// replace it with t to ensure they are instrumented.
+	//
+	// received packets are counted once they have been demultiplexed, see
+	// handlePacket.
+	in.Transport = t
+
+	if tr := t.r.tracer(); tr != nil {
+		tr.TracePacket(newInboundPacketEvent(
+			in,
+			t.r.now(),
+			t.r.directory.lookup(in.Source.InterfaceIndex),
+		))
+	}
+
+	return in, nil
+}
+
+func (t *instrumentedTransport) Write(p *transport.OutboundPacket) error {
+	if err := t.Transport.Write(p); err != nil {
+		return err
+	}
+
+	t.r.stats.packet(t.r.stats.sent, t.Transport, p.Destination.InterfaceIndex)
+
+	if tr := t.r.tracer(); tr != nil {
+		tr.TracePacket(newOutboundPacketEvent(
+			t.Transport,
+			p,
+			t.r.now(),
+			t.r.directory.lookup(p.Destination.InterfaceIndex),
+		))
+	}
+
+	return nil
+}
+
+func (t *instrumentedTransport) InterfaceMTU(index int) (int, bool) {
+	return transport.InterfaceMTU(t.Transport, index)
+}
@@ -1,41 +1,294 @@
 package responder
 
 import (
-	"errors"
+	"context"
 	"net"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
 )
 
-// internetInterface returns the network interface that is used to connect to
-// the internet. This is a fairly naive solution that assumes whatever network
-// is used to connect to Google's DNS server is the appropriate interface.
-func internetInterface() (net.Interface, error) {
-	candidates, err := net.Interfaces()
-	if err != nil {
-		return net.Interface{}, err
+// interfacePollInterval is the interval at which the responder checks for
+// network interfaces that have been added or removed.
+const interfacePollInterval = 5 * time.Second
+
+// ifaceContext is the responder's state for a single network interface.
+type ifaceContext struct {
+	// Interface is the network interface.
+	Interface net.Interface
+
+	// Transports is the set of transports that have joined their multicast
+	// group on this interface.
+	Transports []transport.Transport
+
+	// Names is the set of names for which the responder provides unique
+	// records on this interface, keyed by their canonical name.
+	Names map[string]*uniqueName
+
+	// Shared is the set of shared records published on this interface, keyed
+	// by their canonical name.
+	Shared map[string][]dns.RR
+
+	// History is the record of when each record was last multicast on this
+	// interface.
+	History history
+
+	// Addrs is a representation of the interface's addresses, as of the last
+	// time its records were published.
+	Addrs string
+
+	// Generation identifies the most recent publishJob for this interface.
+	// The results of earlier jobs are discarded.
+	Generation uint64
+}
+
+// newIfaceContext returns a new context for the given interface.
+func (r *Responder) newIfaceContext(iface net.Interface) *ifaceContext {
+	return &ifaceContext{
+		Interface: iface,
+		Addrs:     r.interfaceAddrs(iface),
+		Names:     map[string]*uniqueName{},
+		Shared:    map[string][]dns.RR{},
+		History:   history{},
 	}
+}
 
-	con, err := net.Dial("udp4", "8.8.8.8:53")
+// isEligible returns true if the responder should serve the given interface.
+func (r *Responder) isEligible(iface net.Interface) bool {
+	if iface.Flags&net.FlagUp == 0 ||
+		iface.Flags&net.FlagMulticast == 0 {
+		return false
+	}
+
+	if len(r.allowed) == 0 {
+		return iface.Flags&net.FlagLoopback == 0
+	}
+
+	_, ok := r.allowed[iface.Name]
+	return ok
+}
+
+// refreshInterfaces compares the network interfaces that are currently
+// available with those served by the responder, and begins or stops serving
+// interfaces as necessary.
+func (r *Responder) refreshInterfaces(ctx context.Context) {
+	candidates, err := r.network.Interfaces()
 	if err != nil {
-		return net.Interface{}, err
+		r.logger.Log("unable to enumerate network interfaces: %s", err)
+		return
 	}
 
-	ip := con.LocalAddr().(*net.UDPAddr).IP
-	con.Close()
+	seen := map[int]struct{}{}
 
-	for _, i := range candidates {
-		addrs, err := i.Addrs()
-		if err != nil {
+	for _, iface := range candidates {
+		if !r.isEligible(iface) {
 			continue
 		}
 
-		for _, a := range addrs {
-			if ipn, ok := a.(*net.IPNet); ok {
-				if ipn.IP.Equal(ip) {
-					return i, nil
-				}
-			}
+		seen[iface.Index] = struct{}{}
+
+		if ifc, ok := r.interfaces[iface.Index]; ok {
+			r.updateInterface(ctx, ifc, iface)
+		} else {
+			r.addInterface(ctx, iface)
 		}
 	}
 
-	return net.Interface{}, errors.New("could not find internet network interface")
+	for i, ifc := range r.interfaces {
+		if _, ok := seen[i]; !ok {
+			r.removeInterface(ifc)
+		}
+	}
+}
+
+// addInterface begins serving the given interface.
+func (r *Responder) addInterface(ctx context.Context, iface net.Interface) {
+	ifc := r.newIfaceContext(iface)
+
+	for _, t := range r.transports {
+		if err := t.Join(&ifc.Interface); err == nil {
+			ifc.Transports = append(ifc.Transports, t)
+		}
+	}
+
+	if len(ifc.Transports) == 0 {
+		return
+	}
+
+	r.logger.Debug("serving mDNS requests on %s", iface.Name)
+	r.interfaces[iface.Index] = ifc
+	r.directory.set(iface, r.network)
+	r.publish(ctx, ifc)
+}
+
+// updateInterface updates the context for an interface that is already being
+// served.
+//
+// If the interface's addresses have changed its records are re-published,
+// which sends goodbye packets for any records that are no longer valid, and
+// announces the new records.
+//
+// See https://tools.ietf.org/html/rfc6762#section-10.2.
+func (r *Responder) updateInterface(ctx context.Context, ifc *ifaceContext, iface net.Interface) {
+	ifc.Interface = iface // pick up changes to flags, MTU, etc
+	r.directory.set(iface, r.network)
+
+	addrs := r.interfaceAddrs(iface)
+	if addrs == ifc.Addrs {
+		return
+	}
+
+	r.logger.Debug("network addresses on %s have changed", iface.Name)
+	ifc.Addrs = addrs
+	r.publish(ctx, ifc)
+}
+
+// removeInterface stops serving the given interface.
+func (r *Responder) removeInterface(ifc *ifaceContext) {
+	r.logger.Debug("no longer serving mDNS requests on %s", ifc.Interface.Name)
+
+	// attempt to withdraw the records, though it's likely that the interface
+	// has already gone away
+	r.goodbye(ifc, ifc.published())
+
+	for _, t := range ifc.Transports {
+		_ = t.Leave(&ifc.Interface) // errors are logged by the transport
+	}
+
+	delete(r.interfaces, ifc.Interface.Index)
+
+	for k, p := range r.pending {
+		if p.Interface == ifc.Interface.Index {
+			delete(r.pending, k)
+		}
+	}
+
+	for k, h := range r.held {
+		if h.Query.Packet.Source.InterfaceIndex == ifc.Interface.Index {
+			delete(r.held, k)
+			h.Query.Packet.Close()
+		}
+	}
+}
+
+// notifyAddressChange causes the responder to check each interface for
+// changes to its addresses.
+//
+// It does not block, multiple notifications that occur before the responder
+// checks the interfaces are coalesced.
+func (r *Responder) notifyAddressChange() {
+	select {
+	case r.addressChanged <- struct{}{}:
+	default:
+	}
+}
+
+// interfaceAddrs returns a string representation of the addresses of iface,
+// used to detect changes.
+func (r *Responder) interfaceAddrs(iface net.Interface) string {
+	addrs, err := r.network.Addrs(iface)
+	if err != nil {
+		return ""
+	}
+
+	s := make([]string, len(addrs))
+	for i, addr := range addrs {
+		s[i] = addr.String()
+	}
+
+	sort.Strings(s)
+
+	return strings.Join(s, " ")
+}
+
+// lookupInterface returns the context for the interface on which p was
+// received, which has already been determined by demux().
+//
+// It returns false if the responder has stopped serving that interface since
+// p was received.
+func (r *Responder) lookupInterface(p *transport.InboundPacket) (*ifaceContext, bool) {
+	ifc, ok := r.interfaces[p.Source.InterfaceIndex]
+	return ifc, ok
+}
+
+// prefixes returns the network prefixes assigned to the given interface.
+func (r *Responder) prefixes(ifc *ifaceContext) []*net.IPNet {
+	addrs, err := r.network.Addrs(ifc.Interface)
+	if err != nil {
+		return nil
+	}
+
+	var result []*net.IPNet
+	for _, addr := range addrs {
+		if n, ok := addr.(*net.IPNet); ok {
+			result = append(result, n)
+		}
+	}
+
+	return result
+}
+
+// published returns all of the established unique records and shared records
+// published on the interface.
+func (ifc *ifaceContext) published() []dns.RR {
+	var records []dns.RR
+
+	for _, n := range ifc.Names {
+		if n.State == stateEstablished {
+			records = append(records, n.Records...)
+		}
+	}
+
+	for _, s := range ifc.Shared {
+		records = append(records, s...)
+	}
+
+	return records
+}
+
+// interfaceDirectory describes the interfaces served by the responder. Unlike
+// the interface contexts, it may be used outside of the main loop, such as when
+// labeling statistics and traces.
+//
+// Descriptions are retained after an interface is removed, so that statistics
+// about it remain labeled.
+type interfaceDirectory struct {
+	m      sync.RWMutex
+	ifaces map[int]interfaceDescription
+}
+
+// interfaceDescription describes a network interface served by the responder.
+type interfaceDescription struct {
+	// Name is the name of the interface. It is empty if the interface is not
+	// known.
+	Name string
+
+	// Addrs is the set of unicast addresses assigned to the interface.
+	Addrs []net.Addr
+}
+
+// set records the description of iface, using n to find its addresses.
+func (d *interfaceDirectory) set(iface net.Interface, n transport.Network) {
+	addrs, _ := n.Addrs(iface) // unknown addresses are left empty
+
+	d.m.Lock()
+	defer d.m.Unlock()
+
+	if d.ifaces == nil {
+		d.ifaces = map[int]interfaceDescription{}
+	}
+
+	d.ifaces[iface.Index] = interfaceDescription{iface.Name, addrs}
+}
+
+// lookup returns the description of the interface with the given index.
+func (d *interfaceDirectory) lookup(index int) interfaceDescription {
+	d.m.RLock()
+	defer d.m.RUnlock()
+
+	return d.ifaces[index]
 }
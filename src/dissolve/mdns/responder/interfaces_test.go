@@ -0,0 +1,205 @@
+package responder_test
+
+import (
+	"context"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/jmalloc/dissolve/src/dissolve/names"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder with multiple interfaces", func() {
+	var (
+		network    *testNetwork
+		eth0, eth1 *transport.VirtualInterface
+		hotplug    *hotplugNetwork
+		r          *testResponder
+		q0, q1     *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		link := &transport.Link{Clock: network.Clock}
+
+		eth0 = network.Link.NewInterface("eth0", cidr("192.168.1.10/24"))
+		eth1 = link.NewInterface("eth1", cidr("10.0.0.10/24"))
+
+		q0 = network.NewQuerier("q0", "192.168.1.20/24", 0)
+		q1 = network.NewQuerierOn(link, "q1", "10.0.0.20/24", 0)
+
+		vn := transport.VirtualNetwork{eth0, eth1}
+		hotplug = &hotplugNetwork{VirtualNetwork: vn}
+
+		r = network.Attach(
+			eth0,
+			hotplug,
+			transport.NewVirtualTransport(vn),
+			interfaceAnswerer{
+				"eth0": rr("host.local. 120 IN A 192.168.1.10"),
+				"eth1": rr("host.local. 120 IN A 10.0.0.10"),
+			},
+		)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("answers questions on every interface, using the interface on which the query arrived", func() {
+		network.Establish(r, q0)
+		q1.Drain()
+
+		q0.Query(question("host.local.", dns.TypeA))
+
+		m := q0.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+		Expect(r.HandledQuery().Interface).To(Equal(eth0.Interface().Index))
+		q1.ExpectNothing()
+
+		q1.Query(question("host.local.", dns.TypeA))
+
+		m = q1.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 10.0.0.10")))
+		Expect(r.HandledQuery().Interface).To(Equal(eth1.Interface().Index))
+		q0.ExpectNothing()
+	})
+
+	It("only serves the interfaces that are allowed by UseInterface()", func() {
+		r = network.Attach(
+			eth0,
+			hotplug,
+			transport.NewVirtualTransport(transport.VirtualNetwork{eth0, eth1}),
+			interfaceAnswerer{"eth1": rr("host.local. 120 IN A 10.0.0.10")},
+			UseInterface(eth1.Interface()),
+		)
+		network.Establish(r, q1)
+
+		q0.Query(question("host.local.", dns.TypeA))
+		q0.ExpectNothing()
+	})
+
+	It("begins serving interfaces that are added", func() {
+		hotplug.Remove(eth1)
+
+		network.Establish(r, q0)
+		q1.ExpectNothing()
+
+		hotplug.Add(eth1)
+		network.Advance(5 * time.Second)
+
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				network.Advance(250 * time.Millisecond)
+			}
+
+			m := q1.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Ns).To(ConsistOf(sameRecord("host.local. 120 IN A 10.0.0.10")))
+		}
+
+		network.Advance(250 * time.Millisecond)
+
+		m := q1.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 10.0.0.10")))
+	})
+
+	It("stops serving interfaces that are removed", func() {
+		network.Establish(r, q0)
+		q1.Drain()
+
+		hotplug.Remove(eth1)
+		network.Advance(5 * time.Second)
+
+		m := q1.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 0 IN A 10.0.0.10")))
+		Expect(m.Answer[0].Header().Ttl).To(BeZero())
+
+		q1.Query(question("host.local.", dns.TypeA))
+		q1.ExpectNothing()
+		Consistently(r.Tracer.Queries).ShouldNot(Receive())
+	})
+})
+
+// hotplugNetwork is a virtual network from which interfaces can be removed, and
+// added again, while a responder is running.
+type hotplugNetwork struct {
+	transport.VirtualNetwork
+
+	m       sync.Mutex
+	removed map[int]struct{}
+}
+
+// Interfaces returns the interfaces that have not been removed.
+func (n *hotplugNetwork) Interfaces() ([]net.Interface, error) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	all, err := n.VirtualNetwork.Interfaces()
+	if err != nil {
+		return nil, err
+	}
+
+	var ifaces []net.Interface
+	for _, iface := range all {
+		if _, ok := n.removed[iface.Index]; !ok {
+			ifaces = append(ifaces, iface)
+		}
+	}
+
+	return ifaces, nil
+}
+
+// Add restores an interface that was removed.
+func (n *hotplugNetwork) Add(vi *transport.VirtualInterface) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	delete(n.removed, vi.Interface().Index)
+}
+
+// Remove removes an interface from the network.
+func (n *hotplugNetwork) Remove(vi *transport.VirtualInterface) {
+	n.m.Lock()
+	defer n.m.Unlock()
+
+	if n.removed == nil {
+		n.removed = map[int]struct{}{}
+	}
+
+	n.removed[vi.Interface().Index] = struct{}{}
+}
+
+// interfaceAnswerer is a Publisher that publishes a single unique record on
+// each interface, keyed by the interface name.
+type interfaceAnswerer map[string]dns.RR
+
+// Answer populates an answer to a single DNS question.
+func (a interfaceAnswerer) Answer(_ context.Context, q *Question, ans *Answer) error {
+	rr, ok := a[q.Interface.Name]
+	if !ok || !strings.EqualFold(q.Name, rr.Header().Name) {
+		return nil
+	}
+
+	if q.Qtype == dns.TypeANY || q.Qtype == rr.Header().Rrtype {
+		ans.Unique.Answer(dns.Copy(rr))
+	}
+
+	return nil
+}
+
+// Names returns the name of the record published on the given interface.
+func (a interfaceAnswerer) Names(_ context.Context, iface net.Interface) ([]names.FQDN, error) {
+	if rr, ok := a[iface.Name]; ok {
+		return []names.FQDN{names.FQDN(rr.Header().Name)}, nil
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,58 @@
+package responder
+
+import (
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+)
+
+// IsKnownAnswer returns true if rr is listed in the question's known answers
+// with at least half of its TTL remaining, in which case it should not be
+// included in the response.
+//
+// See https://tools.ietf.org/html/rfc6762#section-7.1.
+func (q *Question) IsKnownAnswer(rr dns.RR) bool {
+	for _, k := range q.KnownAnswers {
+		// A Multicast DNS responder MUST NOT answer a Multicast DNS query if
+		// the answer it would give is already included in the Answer Section
+		// with an RR TTL at least half the correct value.  If the RR TTL of
+		// the answer as given in the Answer Section is less than half of the
+		// true RR TTL as known by the Multicast DNS responder, the responder
+		// MUST send an answer so as to update the querier's cache before the
+		// record becomes in danger of expiration.
+		if isSameRecord(k, rr) && k.Header().Ttl >= rr.Header().Ttl/2 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// suppressKnownAnswers removes the question's known answers from rs.
+func (q *Question) suppressKnownAnswers(rs *ResponseSections) {
+	if len(q.KnownAnswers) == 0 {
+		return
+	}
+
+	filter := func(records []dns.RR) []dns.RR {
+		var result []dns.RR
+
+		for _, rr := range records {
+			if !q.IsKnownAnswer(rr) {
+				result = append(result, rr)
+			}
+		}
+
+		return result
+	}
+
+	rs.AnswerSection = filter(rs.AnswerSection)
+	rs.AuthoritySection = filter(rs.AuthoritySection)
+	rs.AdditionalSection = filter(rs.AdditionalSection)
+}
+
+// isSameRecord returns true if a and b have the same name, class, type and
+// rdata.
+func isSameRecord(a, b dns.RR) bool {
+	return canonicalName(a.Header().Name) == canonicalName(b.Header().Name) &&
+		mdns.CompareRecords(a, b) == 0
+}
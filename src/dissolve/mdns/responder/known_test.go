@@ -0,0 +1,163 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Question", func() {
+	Describe("IsKnownAnswer", func() {
+		var q *Question
+
+		BeforeEach(func() {
+			q = &Question{
+				Question: question("_http._tcp.local.", dns.TypePTR),
+				KnownAnswers: []dns.RR{
+					rr("_http._tcp.local. 2250 IN PTR a._http._tcp.local."),
+					rr("_http._tcp.local. 2249 IN PTR b._http._tcp.local."),
+				},
+			}
+		})
+
+		It("returns true if the record is known with at least half of its TTL remaining", func() {
+			Expect(q.IsKnownAnswer(rr("_http._tcp.local. 4500 IN PTR a._http._tcp.local."))).To(BeTrue())
+		})
+
+		It("returns false if the record is known with less than half of its TTL remaining", func() {
+			Expect(q.IsKnownAnswer(rr("_http._tcp.local. 4500 IN PTR b._http._tcp.local."))).To(BeFalse())
+		})
+
+		It("returns false if the record is not known", func() {
+			Expect(q.IsKnownAnswer(rr("_http._tcp.local. 4500 IN PTR c._http._tcp.local."))).To(BeFalse())
+		})
+
+		It("compares names case-insensitively", func() {
+			Expect(q.IsKnownAnswer(rr("_HTTP._tcp.local. 4500 IN PTR a._http._tcp.local."))).To(BeTrue())
+		})
+	})
+})
+
+var _ = Describe("Responder known-answer suppression", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+				[]dns.RR{
+					rr("_http._tcp.local. 4500 IN PTR a._http._tcp.local."),
+					rr("_http._tcp.local. 4500 IN PTR b._http._tcp.local."),
+				},
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// query sends a query containing a single question and the given known
+	// answers.
+	query := func(qu bool, n string, t uint16, known ...string) {
+		x := question(n, t)
+		if qu {
+			x = mdns.SetUnicastResponse(x)
+		}
+
+		m := mdns.NewQuery(false, x)
+		for _, s := range known {
+			m.Answer = append(m.Answer, rr(s))
+		}
+
+		q.Send(m)
+	}
+
+	It("does not multicast shared records that the querier already knows", func() {
+		query(
+			false,
+			"_http._tcp.local.", dns.TypePTR,
+			"_http._tcp.local. 4500 IN PTR a._http._tcp.local.",
+		)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR b._http._tcp.local."),
+		))
+
+		network.Advance(20 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR b._http._tcp.local."),
+		))
+	})
+
+	It("does not respond at all if the querier already knows every answer", func() {
+		query(
+			false,
+			"_http._tcp.local.", dns.TypePTR,
+			"_http._tcp.local. 4500 IN PTR a._http._tcp.local.",
+			"_http._tcp.local. 4500 IN PTR b._http._tcp.local.",
+		)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		network.Advance(1 * time.Second)
+		q.ExpectNothing()
+	})
+
+	It("does not multicast unique records that the querier already knows", func() {
+		query(
+			false,
+			"host.local.", dns.TypeA,
+			"host.local. 60 IN A 192.168.1.10",
+		)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+		q.ExpectNothing()
+	})
+
+	It("answers if the querier's copy of the record has less than half of its TTL remaining", func() {
+		query(
+			false,
+			"host.local.", dns.TypeA,
+			"host.local. 59 IN A 192.168.1.10",
+		)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.10"),
+		))
+	})
+
+	It("does not unicast records that the querier already knows", func() {
+		// the records were recently multicast by Establish(), so they are
+		// eligible to be sent via unicast
+		query(
+			true,
+			"_http._tcp.local.", dns.TypePTR,
+			"_http._tcp.local. 4500 IN PTR a._http._tcp.local.",
+		)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+		Expect(e.Unicast.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR b._http._tcp.local."),
+		))
+	})
+})
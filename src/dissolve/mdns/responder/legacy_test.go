@@ -0,0 +1,85 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder handling of legacy queriers", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+		legacy  *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		legacy = network.NewQuerier("eth2", "192.168.1.30/24", 12345)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+				[]dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")},
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("responds directly to the querier, echoing the query ID and questions", func() {
+		query := mdns.NewQuery(true, question("host.local.", dns.TypeA))
+		legacy.Send(query)
+
+		m := legacy.Receive()
+		Expect(m.Multicast).To(BeFalse())
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Id).To(Equal(query.Id))
+		Expect(m.Question).To(Equal(query.Question))
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 10 IN A 192.168.1.10")))
+	})
+
+	It("limits the TTL of each record to 10 seconds, and does not set the cache-flush bit", func() {
+		legacy.Query(question("host.local.", dns.TypeA))
+
+		m := legacy.Receive()
+		Expect(m.Answer).To(HaveLen(1))
+		Expect(m.Answer[0].Header().Ttl).To(BeEquivalentTo(10))
+
+		u, _ := mdns.IsUniqueRecord(m.Answer[0])
+		Expect(u).To(BeFalse())
+	})
+
+	It("answers questions about shared records immediately", func() {
+		legacy.Query(question("_http._tcp.local.", dns.TypePTR))
+
+		m := legacy.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("_http._tcp.local. 10 IN PTR web._http._tcp.local.")))
+	})
+
+	It("does not send a multicast copy of the response", func() {
+		legacy.Query(
+			question("host.local.", dns.TypeA),
+			question("_http._tcp.local.", dns.TypePTR),
+		)
+
+		e := r.HandledQuery()
+		Expect(e.Legacy).To(BeTrue())
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		Expect(legacy.Receive().Multicast).To(BeFalse())
+		network.Advance(1 * time.Second)
+
+		// the only message seen by the other querier is the query itself
+		Expect(q.Receive().Response).To(BeFalse())
+		q.ExpectNothing()
+	})
+})
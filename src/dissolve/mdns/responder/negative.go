@@ -0,0 +1,116 @@
+package responder
+
+import (
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+// ownedTypes is the complete set of record types at a unique name.
+type ownedTypes struct {
+	Name  string
+	TTL   uint32
+	Types []uint16
+}
+
+// Owns declares that the answerer provides all of the unique records at the
+// given name, and that only records of the given types exist at that name.
+//
+// It may be called multiple times for the same name, in which case the types
+// are combined. The responder uses this information to send a negative
+// response when asked for a record type that does not exist at the name. ttl
+// is the TTL used for the negative response, which should be the same as the
+// TTL of the records at the name.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.1.
+func (a *Answer) Owns(name string, ttl uint32, types ...uint16) {
+	k := canonicalName(name)
+
+	for i := range a.owned {
+		o := &a.owned[i]
+
+		if canonicalName(o.Name) == k {
+			o.Types = append(o.Types, types...)
+			return
+		}
+	}
+
+	a.owned = append(a.owned, ownedTypes{name, ttl, types})
+}
+
+// addNegativeResponse adds an NSEC record to the unique answer section of a if
+// the answerer owns the name in q, but there are no records of the requested
+// type.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.1.
+func (a *Answer) addNegativeResponse(q *Question) {
+	if q.Qtype == dns.TypeANY {
+		return
+	}
+
+	if q.Qclass != dns.ClassINET && q.Qclass != dns.ClassANY {
+		return
+	}
+
+	k := canonicalName(q.Name)
+
+	for _, o := range a.owned {
+		if canonicalName(o.Name) != k {
+			continue
+		}
+
+		for _, t := range o.Types {
+			if t == q.Qtype {
+				return
+			}
+		}
+
+		// Any time a responder receives a query for a name for which it has
+		// verified exclusive ownership, for a type for which that name has
+		// no records, the responder MUST (except as allowed in (a) below)
+		// respond asserting the nonexistence of that record using a DNS NSEC
+		// record [RFC3845].
+		a.Unique.Answer(newNSEC(o))
+
+		return
+	}
+}
+
+// newNSEC returns an NSEC record asserting that only the records of the types in
+// o exist at o.Name.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.1.
+func newNSEC(o ownedTypes) *dns.NSEC {
+	seen := map[uint16]struct{}{}
+
+	// The 'Next Domain Name' field contains the record's own name. When used
+	// with name compression, this means that the 'Next Domain Name' field
+	// always takes exactly two bytes in the message.
+	//
+	// The Type Bit Map block number is 0, the Type Bit Map block length is
+	// no more than 32, and the other block numbers 1-255 are not used.
+	rr := &dns.NSEC{
+		Hdr: dns.RR_Header{
+			Name:   o.Name,
+			Rrtype: dns.TypeNSEC,
+			Class:  dns.ClassINET,
+			Ttl:    o.TTL,
+		},
+		NextDomain: o.Name,
+	}
+
+	for _, t := range o.Types {
+		if _, ok := seen[t]; ok || t > 255 {
+			continue
+		}
+
+		seen[t] = struct{}{}
+		rr.TypeBitMap = append(rr.TypeBitMap, t)
+	}
+
+	sort.Slice(rr.TypeBitMap, func(i, j int) bool {
+		return rr.TypeBitMap[i] < rr.TypeBitMap[j]
+	})
+
+	return rr
+}
@@ -0,0 +1,78 @@
+package responder_test
+
+import (
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder negative responses", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{
+					rr("host.local. 120 IN A 192.168.1.10"),
+					rr("host.local. 120 IN TXT \"x\""),
+				},
+				[]dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")},
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("answers with an NSEC record listing the types that exist when asked for a type that does not", func() {
+		q.Query(question("host.local.", dns.TypeAAAA))
+
+		m := q.Receive()
+		Expect(m.Answer).To(HaveLen(1))
+
+		nsec, ok := m.Answer[0].(*dns.NSEC)
+		Expect(ok).To(BeTrue())
+		Expect(nsec.Hdr.Name).To(Equal("host.local."))
+		Expect(nsec.Hdr.Ttl).To(BeEquivalentTo(120))
+		Expect(nsec.NextDomain).To(Equal("host.local."))
+		Expect(nsec.TypeBitMap).To(Equal([]uint16{dns.TypeA, dns.TypeTXT}))
+
+		u, _ := mdns.IsUniqueRecord(nsec)
+		Expect(u).To(BeTrue())
+	})
+
+	It("does not send an NSEC record when records of the requested type exist", func() {
+		q.Query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+
+	It("does not send an NSEC record in response to an ANY question", func() {
+		q.Query(question("host.local.", dns.TypeANY))
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.10"),
+			sameRecord("host.local. 120 IN TXT \"x\""),
+		))
+	})
+
+	It("does not send an NSEC record for names that the answerer does not own", func() {
+		q.Query(question("_http._tcp.local.", dns.TypeSRV))
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+		q.ExpectNothing()
+	})
+})
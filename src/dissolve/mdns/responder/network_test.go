@@ -0,0 +1,385 @@
+package responder_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/gomega"
+)
+
+// epoch is the time at which the fake clock used by each test network starts.
+var epoch = time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// testNetwork is a virtual link with a fake clock, to which responders and
+// queriers are attached, so that their behavior can be tested deterministically
+// within a single process.
+type testNetwork struct {
+	Clock *clock.Fake
+	Link  *transport.Link
+
+	responders []*testResponder
+	queriers   []*querier
+}
+
+// newTestNetwork returns a new, empty test network.
+func newTestNetwork() *testNetwork {
+	c := clock.NewFake(epoch)
+
+	return &testNetwork{
+		Clock: c,
+		Link:  &transport.Link{Clock: c},
+	}
+}
+
+// NewResponder attaches a new responder to the network via an interface with
+// the given name and address, such as "192.168.1.10/24".
+//
+// The responder uses the network's fake clock, and a rand source under which
+// each random delay takes its minimum value. These, and the other defaults, can
+// be overridden by options.
+func (n *testNetwork) NewResponder(
+	name, addr string,
+	a Answerer,
+	options ...Option,
+) *testResponder {
+	vi := n.Link.NewInterface(name, cidr(addr))
+	vn := transport.VirtualNetwork{vi}
+
+	return n.Attach(vi, vn, transport.NewVirtualTransport(vn), a, options...)
+}
+
+// Attach attaches a new responder that serves the interfaces of network, and
+// communicates via t, which is usually a virtual transport for interfaces that
+// are attached to links that use the test network's clock.
+//
+// vi is the interface that is used by the responder's Sync() and Published()
+// methods.
+func (n *testNetwork) Attach(
+	vi *transport.VirtualInterface,
+	network transport.Network,
+	t transport.Transport,
+	a Answerer,
+	options ...Option,
+) *testResponder {
+	r := &testResponder{
+		Interface: vi,
+		Transport: t,
+		Tracer:    newTestTracer(),
+	}
+
+	options = append(
+		[]Option{
+			UseNetwork(network),
+			UseTransport(r.Transport),
+			UseClock(n.Clock),
+			UseRandSource(constantSource(0)),
+			UseLogger(discardLogger{}),
+			UseTracer(r.Tracer),
+		},
+		options...,
+	)
+
+	var err error
+	r.Responder, err = New(a, options...)
+	Expect(err).ShouldNot(HaveOccurred())
+
+	n.responders = append(n.responders, r)
+
+	return r
+}
+
+// NewQuerier attaches a new querier to the network via an interface with the
+// given name and address. If port is not the mDNS port, the querier is a
+// "legacy" querier.
+func (n *testNetwork) NewQuerier(name, addr string, port int) *querier {
+	return n.NewQuerierOn(n.Link, name, addr, port)
+}
+
+// NewQuerierOn attaches a new querier to the given link, which must use the
+// network's clock.
+func (n *testNetwork) NewQuerierOn(l *transport.Link, name, addr string, port int) *querier {
+	vi := l.NewInterface(name, cidr(addr))
+
+	t := transport.NewVirtualTransport(transport.VirtualNetwork{vi})
+	t.Port = port
+
+	iface := vi.Interface()
+	Expect(t.Join(&iface)).To(Succeed())
+
+	q := &querier{
+		Interface: vi,
+		Transport: t,
+		messages:  make(chan *received, 100),
+	}
+
+	go q.read()
+
+	n.queriers = append(n.queriers, q)
+
+	return q
+}
+
+// Advance moves the fake clock forward by d.
+//
+// It first waits for each running responder to finish executing its current
+// command, so that any timers started by that command are in place before the
+// clock moves.
+func (n *testNetwork) Advance(d time.Duration) {
+	for _, r := range n.responders {
+		r.Sync()
+	}
+
+	n.Clock.Advance(d)
+}
+
+// Establish starts r, and advances the clock until it has probed and announced
+// its records. The packets received by q in the meantime are discarded.
+//
+// When it returns the clock has moved on far enough that the records are not
+// subject to multicast rate-limiting.
+func (n *testNetwork) Establish(r *testResponder, q *querier) {
+	r.Start()
+
+	// skip the random delay before the first probe, which is at most 250ms,
+	// once the probe has been scheduled, or the first announcement has been
+	// sent if there is nothing to probe
+	limit := n.Clock.Now().Add(250 * time.Millisecond)
+	Eventually(func() bool {
+		next := n.Clock.Next()
+		return len(q.messages) != 0 || !next.IsZero() && !next.After(limit)
+	}).Should(BeTrue())
+	n.Clock.Advance(250 * time.Millisecond)
+
+	if m := q.Receive(); !m.Response {
+		// the first message is a probe, so the remaining probes are sent
+		// before the first announcement
+		for i := 1; i < 3; i++ {
+			n.Advance(250 * time.Millisecond)
+			Expect(q.Receive().Response).To(BeFalse())
+		}
+
+		n.Advance(250 * time.Millisecond)
+		Expect(q.Receive().Response).To(BeTrue())
+	}
+
+	n.Advance(1 * time.Second)
+	Expect(q.Receive().Response).To(BeTrue())
+
+	n.Advance(1 * time.Second)
+	q.ExpectNothing()
+}
+
+// Close stops all of the responders and queriers attached to the network.
+func (n *testNetwork) Close() {
+	for _, r := range n.responders {
+		r.Stop()
+	}
+
+	for _, q := range n.queriers {
+		q.Transport.Close()
+	}
+}
+
+// testResponder is a responder attached to a test network.
+type testResponder struct {
+	*Responder
+
+	Interface *transport.VirtualInterface
+	Transport transport.Transport
+	Tracer    *testTracer
+
+	cancel context.CancelFunc
+	done   chan error
+}
+
+// Start runs the responder in the background.
+func (r *testResponder) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan error, 1)
+
+	go func() {
+		r.done <- r.Run(ctx)
+	}()
+}
+
+// Stop stops the responder, if it is running, and waits for it to return.
+func (r *testResponder) Stop() {
+	if r.cancel == nil {
+		return
+	}
+
+	r.cancel()
+	r.cancel = nil
+
+	Eventually(r.done).Should(Receive(BeNil()))
+}
+
+// Sync waits for the responder to finish executing its current command, if it
+// is running.
+func (r *testResponder) Sync() {
+	if r.cancel == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	// commands are executed one at a time, so by the time the records are
+	// returned, the preceding command is complete
+	_, _ = r.Records(ctx, r.Interface.Interface())
+}
+
+// HandledQuery waits for the responder to finish handling a query, and returns
+// the event that describes it.
+//
+// By the time the event is available, any multicast response to the query has
+// been sent or scheduled.
+func (r *testResponder) HandledQuery() QueryEvent {
+	var e QueryEvent
+	EventuallyWithOffset(1, r.Tracer.Queries).Should(Receive(&e))
+	return e
+}
+
+// Published returns the records that the responder has published.
+func (r *testResponder) Published() []dns.RR {
+	ctx, cancel := context.WithTimeout(context.Background(), 1*time.Second)
+	defer cancel()
+
+	records, err := r.Records(ctx, r.Interface.Interface())
+	Expect(err).ShouldNot(HaveOccurred())
+
+	return records
+}
+
+// querier sends queries, and receives the packets sent by responders, via its
+// own interface on a test network.
+type querier struct {
+	Interface *transport.VirtualInterface
+	Transport *transport.VirtualTransport
+
+	messages chan *received
+}
+
+// received is a message received by a querier.
+type received struct {
+	*dns.Msg
+
+	// Source is the address of the sender.
+	Source *net.UDPAddr
+
+	// Multicast is true if the message was sent to the multicast group.
+	Multicast bool
+}
+
+// read receives messages until the querier's transport is closed.
+func (q *querier) read() {
+	for {
+		p, err := q.Transport.Read()
+		if err != nil {
+			return
+		}
+
+		m, err := p.Message()
+		if err == nil {
+			q.messages <- &received{m, p.Source.Address, p.IsMulticast()}
+		}
+
+		p.Close()
+	}
+}
+
+// Query multicasts a query containing the given questions.
+func (q *querier) Query(questions ...dns.Question) {
+	q.Send(mdns.NewQuery(q.Transport.Port != 0, questions...))
+}
+
+// Send multicasts m.
+func (q *querier) Send(m *dns.Msg) {
+	iface := q.Interface.Interface()
+	_, err := transport.SendMulticast(q.Transport, &iface, m)
+	Expect(err).ShouldNot(HaveOccurred())
+}
+
+// SendTo sends m directly to the mDNS port at the unicast address ip.
+func (q *querier) SendTo(ip string, m *dns.Msg) {
+	_, err := transport.Send(
+		q.Transport,
+		transport.Endpoint{
+			InterfaceIndex: q.Interface.Interface().Index,
+			Address: &net.UDPAddr{
+				IP:   net.ParseIP(ip),
+				Port: transport.Port,
+			},
+		},
+		m,
+	)
+	Expect(err).ShouldNot(HaveOccurred())
+}
+
+// Receive returns the next message received by the querier, failing the test
+// if none arrives.
+func (q *querier) Receive() *received {
+	var m *received
+	EventuallyWithOffset(1, q.messages).Should(Receive(&m))
+	return m
+}
+
+// ReceiveResponse returns the next response received by the querier, ignoring
+// any queries, such as probes, that are received first.
+func (q *querier) ReceiveResponse() *received {
+	for {
+		var m *received
+		EventuallyWithOffset(1, q.messages).Should(Receive(&m))
+
+		if m.Response {
+			return m
+		}
+	}
+}
+
+// ExpectNothing fails the test if the querier receives a message within a
+// short period of real time.
+func (q *querier) ExpectNothing() {
+	ConsistentlyWithOffset(1, q.messages).ShouldNot(Receive())
+}
+
+// Drain discards messages until none have been received for a short period of
+// real time.
+func (q *querier) Drain() {
+	for {
+		select {
+		case <-q.messages:
+		case <-time.After(50 * time.Millisecond):
+			return
+		}
+	}
+}
+
+// question returns a question for records of type t at the name n.
+func question(n string, t uint16) dns.Question {
+	return dns.Question{
+		Name:   n,
+		Qtype:  t,
+		Qclass: dns.ClassINET,
+	}
+}
+
+// cidr parses s as an IP address with a network prefix, such as
+// "192.168.1.10/24".
+func cidr(s string) *net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	n.IP = ip
+
+	return n
+}
@@ -1,7 +1,13 @@
 package responder
 
 import (
+	"fmt"
+	"math/rand"
 	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
 
 	"github.com/jmalloc/twelf/src/twelf"
 )
@@ -18,13 +24,80 @@ func UseLogger(l twelf.Logger) Option {
 	}
 }
 
-// UseInterface sets the network interface that is used by the server.
+// UseInterface adds a network interface to the set of interfaces that are used
+// by the server. It may be provided multiple times.
 //
-// If this option is not provided, the server will choose the interface used to
-// access the internet.
+// If this option is not provided, the server uses every non-loopback interface
+// that supports multicast, including interfaces that are added after the
+// server has started.
 func UseInterface(iface net.Interface) Option {
 	return func(r *Responder) error {
-		r.iface = &iface
+		if r.allowed == nil {
+			r.allowed = map[string]struct{}{}
+		}
+
+		r.allowed[iface.Name] = struct{}{}
+		return nil
+	}
+}
+
+// UseNetwork returns a server option that sets the source of the network
+// interfaces served by the server, and of their addresses, such as a
+// transport.VirtualNetwork.
+//
+// If this option is not provided, the host's network interfaces are used.
+func UseNetwork(n transport.Network) Option {
+	return func(r *Responder) error {
+		r.network = n
+		return nil
+	}
+}
+
+// UseTransport returns a server option that adds a transport to the set of
+// transports used by the server, such as a transport.VirtualTransport. It may
+// be provided multiple times.
+//
+// If this option is provided, the server does not use the default IPv4 and IPv6
+// transports, and the DisableIPv4 and DisableIPv6 options have no effect.
+func UseTransport(t transport.Transport) Option {
+	return func(r *Responder) error {
+		r.custom = append(r.custom, t)
+		return nil
+	}
+}
+
+// UseQueryWorkers returns a server option that sets the number of queries that
+// the server may answer concurrently. The default is 8.
+//
+// Each worker calls the server's answerer for the questions in one query at a
+// time, so a slow answerer only delays the queries that it is answering. The
+// workers also call the answerer to discover and rename the records that the
+// server publishes.
+func UseQueryWorkers(n int) Option {
+	return func(r *Responder) error {
+		if n < 1 {
+			return fmt.Errorf("the number of query workers must be at least 1, got %d", n)
+		}
+
+		r.workers = n
+		return nil
+	}
+}
+
+// UseQueryTimeout returns a server option that sets the time allowed for the
+// server's answerer to answer the questions in a query. The default is one
+// second. The same limit applies when the server calls the answerer to
+// discover or rename its published records.
+//
+// The context passed to the answerer is canceled when the timeout elapses, and
+// any answers produced before then are sent.
+func UseQueryTimeout(d time.Duration) Option {
+	return func(r *Responder) error {
+		if d <= 0 {
+			return fmt.Errorf("the query timeout must be positive, got %s", d)
+		}
+
+		r.queryTimeout = d
 		return nil
 	}
 }
@@ -42,3 +115,69 @@ func DisableIPv6(r *Responder) error {
 	r.disableIPv6 = true
 	return nil
 }
+
+// UseConflictHandler returns a server option that sets a function that is
+// called when another responder on the network claims one of the names for
+// which the server provides unique records.
+func UseConflictHandler(h ConflictHandler) Option {
+	return func(r *Responder) error {
+		r.onConflict = h
+		return nil
+	}
+}
+
+// PublishHost returns a server option that publishes the address records of
+// this machine under the host name provided by h, on every interface.
+//
+// If another host is already using the name, h is renamed, regardless of
+// whether EnableAutoRename is used, and the server's ConflictHandler is called
+// with the new name.
+func PublishHost(h *Host) Option {
+	return func(r *Responder) error {
+		r.host = h
+		return nil
+	}
+}
+
+// EnableAutoRename is a server option that causes the server to re-publish
+// conflicting records under a new name, such as "Printer (2)", if the answerer
+// implements the Renamer interface.
+//
+// See https://tools.ietf.org/html/rfc6762#section-9.
+func EnableAutoRename(r *Responder) error {
+	r.autoRename = true
+	return nil
+}
+
+// UseTracer returns a server option that sets the tracer used to observe the
+// server's packets and responses. The tracer can also be changed while the
+// server is running using Responder.SetTracer().
+func UseTracer(t Tracer) Option {
+	return func(r *Responder) error {
+		r.SetTracer(t)
+		return nil
+	}
+}
+
+// UseClock returns a server option that sets the clock used for all of the
+// server's timing, including probe, announcement and response delays.
+//
+// If this option is not provided, the server uses the system clock.
+func UseClock(c clock.Clock) Option {
+	return func(r *Responder) error {
+		r.clock = c
+		return nil
+	}
+}
+
+// UseRandSource returns a server option that sets the source of the random
+// numbers used to choose the server's randomized delays.
+//
+// If this option is not provided, the server uses a source seeded from the
+// current time.
+func UseRandSource(s rand.Source) Option {
+	return func(r *Responder) error {
+		r.rand = rand.New(s)
+		return nil
+	}
+}
@@ -0,0 +1,190 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"net"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+)
+
+const (
+	// protocolUDP is the IP protocol number of UDP.
+	protocolUDP = 17
+
+	// hopLimit is the TTL or hop limit used in synthesized IP headers. The
+	// responder sends all packets with a hop limit of 255.
+	hopLimit = 255
+)
+
+// encodePacket returns the UDP payload described by e wrapped in synthesized IP
+// and UDP headers.
+func encodePacket(e responder.PacketEvent) []byte {
+	src, dst := addresses(e)
+	udp := encodeUDP(src, dst, e.Data)
+
+	if e.Transport == "ipv4" {
+		return append(encodeIPv4Header(src.IP, dst.IP, len(udp)), udp...)
+	}
+
+	return append(encodeIPv6Header(src.IP, dst.IP, len(udp)), udp...)
+}
+
+// addresses returns the source and destination addresses of the packet
+// described by e.
+//
+// Addresses that are not known to the responder are replaced with the
+// interface's own address, or the multicast group address, as appropriate.
+func addresses(e responder.PacketEvent) (src, dst *net.UDPAddr) {
+	v4 := e.Transport == "ipv4"
+
+	group := transport.IPv6GroupAddress
+	if v4 {
+		group = transport.IPv4GroupAddress
+	}
+
+	if e.Direction == responder.Inbound {
+		src = e.Source
+		dst = e.Destination
+		if dst == nil {
+			dst = group
+		}
+	} else {
+		src = &net.UDPAddr{
+			IP:   interfaceAddress(e.InterfaceAddrs, v4),
+			Port: transport.Port,
+		}
+		dst = e.Destination
+	}
+
+	if src == nil {
+		src = &net.UDPAddr{IP: unspecified(v4)}
+	}
+
+	if dst == nil {
+		dst = group
+	}
+
+	return src, dst
+}
+
+// interfaceAddress returns one of the given interface addresses. Link-local
+// IPv6 addresses are preferred, as they are always used as the source address
+// of multicast packets.
+func interfaceAddress(addrs []net.Addr, v4 bool) net.IP {
+	var result net.IP
+
+	for _, addr := range addrs {
+		x, ok := addr.(*net.IPNet)
+		if !ok || (x.IP.To4() != nil) != v4 {
+			continue
+		}
+
+		if v4 || x.IP.IsLinkLocalUnicast() {
+			return x.IP
+		}
+
+		if result == nil {
+			result = x.IP
+		}
+	}
+
+	if result == nil {
+		return unspecified(v4)
+	}
+
+	return result
+}
+
+// unspecified returns the unspecified address of the given address family.
+func unspecified(v4 bool) net.IP {
+	if v4 {
+		return net.IPv4zero
+	}
+
+	return net.IPv6unspecified
+}
+
+// encodeIPv4Header returns an IPv4 header for a UDP datagram of length n.
+func encodeIPv4Header(src, dst net.IP, n int) []byte {
+	h := make([]byte, 20)
+	h[0] = 0x45 // version 4, header length of 5 words
+	binary.BigEndian.PutUint16(h[2:], uint16(len(h)+n))
+	h[8] = hopLimit
+	h[9] = protocolUDP
+	copy(h[12:16], src.To4())
+	copy(h[16:20], dst.To4())
+	binary.BigEndian.PutUint16(h[10:], checksum(0, h))
+
+	return h
+}
+
+// encodeIPv6Header returns an IPv6 header for a UDP datagram of length n.
+func encodeIPv6Header(src, dst net.IP, n int) []byte {
+	h := make([]byte, 40)
+	h[0] = 0x60 // version 6
+	binary.BigEndian.PutUint16(h[4:], uint16(n))
+	h[6] = protocolUDP
+	h[7] = hopLimit
+	copy(h[8:24], src.To16())
+	copy(h[24:40], dst.To16())
+
+	return h
+}
+
+// encodeUDP returns a UDP datagram containing payload.
+func encodeUDP(src, dst *net.UDPAddr, payload []byte) []byte {
+	n := 8 + len(payload)
+
+	d := make([]byte, 8, n)
+	binary.BigEndian.PutUint16(d[0:], uint16(src.Port))
+	binary.BigEndian.PutUint16(d[2:], uint16(dst.Port))
+	binary.BigEndian.PutUint16(d[4:], uint16(n))
+	d = append(d, payload...)
+
+	// the checksum covers a "pseudo-header" containing the IP addresses,
+	// protocol and length, followed by the datagram itself.
+	var pseudo []byte
+	if s4, d4 := src.IP.To4(), dst.IP.To4(); s4 != nil && d4 != nil {
+		pseudo = append(pseudo, s4...)
+		pseudo = append(pseudo, d4...)
+	} else {
+		pseudo = append(pseudo, src.IP.To16()...)
+		pseudo = append(pseudo, dst.IP.To16()...)
+	}
+	pseudo = append(pseudo, 0, protocolUDP, byte(n>>8), byte(n))
+
+	cs := checksum(sum(0, pseudo), d)
+	if cs == 0 {
+		cs = 0xffff
+	}
+	binary.BigEndian.PutUint16(d[6:], cs)
+
+	return d
+}
+
+// sum adds the 16-bit big-endian words in b to the one's complement sum s.
+func sum(s uint32, b []byte) uint32 {
+	for i := 0; i+1 < len(b); i += 2 {
+		s += uint32(b[i])<<8 | uint32(b[i+1])
+	}
+
+	if len(b)%2 != 0 {
+		s += uint32(b[len(b)-1]) << 8
+	}
+
+	return s
+}
+
+// checksum returns the internet checksum of b, starting from the partial sum s.
+//
+// See https://tools.ietf.org/html/rfc1071.
+func checksum(s uint32, b []byte) uint16 {
+	s = sum(s, b)
+
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+
+	return ^uint16(s)
+}
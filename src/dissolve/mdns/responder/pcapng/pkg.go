@@ -0,0 +1,6 @@
+// Package pcapng provides a responder tracer that writes the packets sent and
+// received by an mDNS responder to a pcap-ng capture file, which can be opened
+// with tools such as Wireshark.
+//
+// See https://tools.ietf.org/html/draft-tuexen-opsawg-pcapng.
+package pcapng
@@ -0,0 +1,200 @@
+package pcapng
+
+import (
+	"encoding/binary"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+)
+
+const (
+	// blockTypeSectionHeader is the block type of a section header block.
+	blockTypeSectionHeader = 0x0A0D0D0A
+
+	// blockTypeInterfaceDescription is the block type of an interface
+	// description block.
+	blockTypeInterfaceDescription = 0x00000001
+
+	// blockTypeEnhancedPacket is the block type of an enhanced packet block.
+	blockTypeEnhancedPacket = 0x00000006
+
+	// byteOrderMagic identifies the byte order of a section.
+	byteOrderMagic = 0x1A2B3C4D
+
+	// linkTypeRaw is the link type for packets that begin with an IPv4 or
+	// IPv6 header, with no link-layer header.
+	linkTypeRaw = 101
+
+	// optionEnd marks the end of a block's options.
+	optionEnd = 0
+
+	// optionUserApplication is the section header option that names the
+	// application that wrote the section.
+	optionUserApplication = 4
+
+	// optionInterfaceName is the interface description option that names the
+	// interface.
+	optionInterfaceName = 2
+)
+
+// Writer is a responder tracer that writes each packet sent or received by the
+// responder to a pcap-ng capture.
+//
+// The captured packets are the UDP payloads seen by the responder, wrapped in
+// synthesized IP and UDP headers. Query events are ignored.
+type Writer struct {
+	m      sync.Mutex
+	w      io.Writer
+	ifaces map[int]uint32
+	err    error
+}
+
+// NewWriter returns a writer that writes a pcap-ng capture to w.
+//
+// The section header is written along with the first packet.
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// Err returns the first error that occurred while writing to the underlying
+// writer, if any. Once an error has occurred no further packets are written.
+func (w *Writer) Err() error {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	return w.err
+}
+
+// TracePacket writes the packet described by e to the capture.
+func (w *Writer) TracePacket(e responder.PacketEvent) {
+	w.m.Lock()
+	defer w.m.Unlock()
+
+	if w.err != nil {
+		return
+	}
+
+	if w.ifaces == nil {
+		w.ifaces = map[int]uint32{}
+		w.err = w.writeSectionHeader()
+	}
+
+	id, ok := w.ifaces[e.Interface]
+	if !ok && w.err == nil {
+		id = uint32(len(w.ifaces))
+		w.ifaces[e.Interface] = id
+		w.err = w.writeInterfaceDescription(e)
+	}
+
+	if w.err == nil {
+		w.err = w.writeEnhancedPacket(id, e.Time, encodePacket(e))
+	}
+}
+
+// TraceQuery does nothing.
+func (w *Writer) TraceQuery(responder.QueryEvent) {}
+
+// writeSectionHeader writes a section header block.
+func (w *Writer) writeSectionHeader() error {
+	var body []byte
+	body = appendUint32(body, byteOrderMagic)
+	body = appendUint16(body, 1)          // major version
+	body = appendUint16(body, 0)          // minor version
+	body = appendUint64(body, ^uint64(0)) // section length is not specified
+	body = appendOption(body, optionUserApplication, []byte("dissolve"))
+	body = appendOption(body, optionEnd, nil)
+
+	return w.writeBlock(blockTypeSectionHeader, body)
+}
+
+// writeInterfaceDescription writes an interface description block for the
+// interface on which the packet described by e was sent or received.
+func (w *Writer) writeInterfaceDescription(e responder.PacketEvent) error {
+	name := e.InterfaceName
+	if name == "" {
+		name = strconv.Itoa(e.Interface)
+	}
+
+	var body []byte
+	body = appendUint16(body, linkTypeRaw)
+	body = appendUint16(body, 0) // reserved
+	body = appendUint32(body, 0) // no snapshot length limit
+	body = appendOption(body, optionInterfaceName, []byte(name))
+	body = appendOption(body, optionEnd, nil)
+
+	return w.writeBlock(blockTypeInterfaceDescription, body)
+}
+
+// writeEnhancedPacket writes an enhanced packet block containing data.
+func (w *Writer) writeEnhancedPacket(id uint32, t time.Time, data []byte) error {
+	// timestamps are in microseconds, which is the default resolution when the
+	// interface description does not include the if_tsresol option.
+	ts := uint64(t.UnixNano() / int64(time.Microsecond))
+
+	var body []byte
+	body = appendUint32(body, id)
+	body = appendUint32(body, uint32(ts>>32))
+	body = appendUint32(body, uint32(ts))
+	body = appendUint32(body, uint32(len(data))) // captured length
+	body = appendUint32(body, uint32(len(data))) // original length
+	body = append(body, data...)
+	body = pad(body)
+
+	return w.writeBlock(blockTypeEnhancedPacket, body)
+}
+
+// writeBlock writes a block of the given type. The length of body must be a
+// multiple of 4.
+func (w *Writer) writeBlock(blockType uint32, body []byte) error {
+	n := uint32(len(body) + 12)
+
+	var buf []byte
+	buf = appendUint32(buf, blockType)
+	buf = appendUint32(buf, n)
+	buf = append(buf, body...)
+	buf = appendUint32(buf, n)
+
+	_, err := w.w.Write(buf)
+	return err
+}
+
+// appendOption appends an option with the given code and value to b.
+func appendOption(b []byte, code uint16, value []byte) []byte {
+	b = appendUint16(b, code)
+	b = appendUint16(b, uint16(len(value)))
+	b = append(b, value...)
+	return pad(b)
+}
+
+// pad appends zero bytes to b until its length is a multiple of 4.
+func pad(b []byte) []byte {
+	for len(b)%4 != 0 {
+		b = append(b, 0)
+	}
+
+	return b
+}
+
+// All blocks are written in little-endian byte order, as indicated by the
+// byte-order magic in the section header.
+
+func appendUint16(b []byte, v uint16) []byte {
+	var x [2]byte
+	binary.LittleEndian.PutUint16(x[:], v)
+	return append(b, x[:]...)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	var x [4]byte
+	binary.LittleEndian.PutUint32(x[:], v)
+	return append(b, x[:]...)
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	var x [8]byte
+	binary.LittleEndian.PutUint64(x[:], v)
+	return append(b, x[:]...)
+}
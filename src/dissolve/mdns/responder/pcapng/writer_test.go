@@ -0,0 +1,231 @@
+package pcapng_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder/pcapng"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Writer", func() {
+	var (
+		buf    *bytes.Buffer
+		writer *Writer
+		event  responder.PacketEvent
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		writer = NewWriter(buf)
+
+		event = responder.PacketEvent{
+			Time:          time.Unix(1514764800, 123456000),
+			Direction:     responder.Inbound,
+			Interface:     2,
+			InterfaceName: "eth0",
+			Transport:     "ipv4",
+			Source:        &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 5353},
+			Data:          []byte{1, 2, 3, 4, 5},
+		}
+	})
+
+	It("writes a section header, then an interface description, then the packet", func() {
+		writer.TracePacket(event)
+		Expect(writer.Err()).ShouldNot(HaveOccurred())
+
+		b := blocks(buf.Bytes())
+		Expect(b).To(HaveLen(3))
+
+		Expect(b[0].Type).To(BeEquivalentTo(0x0A0D0D0A))
+		Expect(binary.LittleEndian.Uint32(b[0].Body)).To(BeEquivalentTo(0x1A2B3C4D))
+
+		Expect(b[1].Type).To(BeEquivalentTo(1))
+		Expect(binary.LittleEndian.Uint16(b[1].Body)).To(BeEquivalentTo(101)) // raw IP
+		Expect(string(b[1].Body)).To(ContainSubstring("eth0"))
+
+		Expect(b[2].Type).To(BeEquivalentTo(6))
+		Expect(binary.LittleEndian.Uint32(b[2].Body)).To(BeZero()) // interface ID
+	})
+
+	It("writes each interface description once", func() {
+		writer.TracePacket(event)
+		writer.TracePacket(event)
+
+		event.Interface = 3
+		event.InterfaceName = "eth1"
+		writer.TracePacket(event)
+
+		var types []uint32
+		for _, b := range blocks(buf.Bytes()) {
+			types = append(types, b.Type)
+		}
+		Expect(types).To(Equal([]uint32{0x0A0D0D0A, 1, 6, 6, 1, 6}))
+
+		p := packet(blocks(buf.Bytes())[5])
+		Expect(p.InterfaceID).To(BeEquivalentTo(1))
+	})
+
+	It("records the time of the packet in microseconds", func() {
+		writer.TracePacket(event)
+
+		p := packet(blocks(buf.Bytes())[2])
+		Expect(p.Timestamp).To(BeEquivalentTo(1514764800123456))
+	})
+
+	It("wraps IPv4 packets in IPv4 and UDP headers with valid checksums", func() {
+		writer.TracePacket(event)
+
+		d := packet(blocks(buf.Bytes())[2]).Data
+		Expect(d).To(HaveLen(20 + 8 + 5))
+
+		ip := d[:20]
+		Expect(ip[0]).To(BeEquivalentTo(0x45))
+		Expect(ip[8]).To(BeEquivalentTo(255))
+		Expect(ip[9]).To(BeEquivalentTo(17))
+		Expect(net.IP(ip[12:16]).Equal(net.ParseIP("192.168.1.20"))).To(BeTrue())
+		Expect(net.IP(ip[16:20]).Equal(transport.IPv4GroupAddress.IP)).To(BeTrue())
+		Expect(checksum(ip)).To(BeEquivalentTo(0xffff))
+
+		udp := d[20:]
+		Expect(binary.BigEndian.Uint16(udp[0:])).To(BeEquivalentTo(5353))
+		Expect(binary.BigEndian.Uint16(udp[2:])).To(BeEquivalentTo(5353))
+		Expect(binary.BigEndian.Uint16(udp[4:])).To(BeEquivalentTo(13))
+		Expect(udp[8:]).To(Equal(event.Data))
+
+		pseudo := append(append([]byte(nil), ip[12:20]...), 0, 17, 0, 13)
+		Expect(checksum(append(pseudo, udp...))).To(BeEquivalentTo(0xffff))
+	})
+
+	It("uses the interface's address as the source of outbound packets", func() {
+		event.Direction = responder.Outbound
+		event.Source = nil
+		event.Destination = &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: 12345}
+		event.InterfaceAddrs = []net.Addr{
+			&net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)},
+		}
+		writer.TracePacket(event)
+
+		d := packet(blocks(buf.Bytes())[2]).Data
+		Expect(net.IP(d[12:16]).Equal(net.ParseIP("192.168.1.10"))).To(BeTrue())
+		Expect(net.IP(d[16:20]).Equal(net.ParseIP("192.168.1.20"))).To(BeTrue())
+		Expect(binary.BigEndian.Uint16(d[20:])).To(BeEquivalentTo(5353))
+		Expect(binary.BigEndian.Uint16(d[22:])).To(BeEquivalentTo(12345))
+	})
+
+	It("wraps IPv6 packets in IPv6 and UDP headers", func() {
+		event.Transport = "ipv6"
+		event.Source = &net.UDPAddr{IP: net.ParseIP("fe80::1"), Port: 5353}
+		writer.TracePacket(event)
+
+		d := packet(blocks(buf.Bytes())[2]).Data
+		Expect(d).To(HaveLen(40 + 8 + 5))
+		Expect(d[0] >> 4).To(BeEquivalentTo(6))
+		Expect(binary.BigEndian.Uint16(d[4:])).To(BeEquivalentTo(13))
+		Expect(d[6]).To(BeEquivalentTo(17))
+		Expect(d[7]).To(BeEquivalentTo(255))
+		Expect(net.IP(d[8:24]).Equal(net.ParseIP("fe80::1"))).To(BeTrue())
+		Expect(net.IP(d[24:40]).Equal(transport.IPv6GroupAddress.IP)).To(BeTrue())
+		Expect(d[48:]).To(Equal(event.Data))
+	})
+
+	It("stops writing after an error", func() {
+		w := &failingWriter{}
+		writer = NewWriter(w)
+
+		writer.TracePacket(event)
+		Expect(writer.Err()).To(MatchError("<error>"))
+
+		writer.TracePacket(event)
+		Expect(w.calls).To(Equal(1))
+	})
+
+	It("ignores query events", func() {
+		writer.TraceQuery(responder.QueryEvent{})
+		Expect(buf.Len()).To(BeZero())
+	})
+})
+
+// block is a pcap-ng block.
+type block struct {
+	Type uint32
+	Body []byte
+}
+
+// blocks splits a little-endian pcap-ng capture into its blocks, checking that
+// the leading and trailing lengths of each block match.
+func blocks(data []byte) []block {
+	var result []block
+
+	for len(data) > 0 {
+		n := binary.LittleEndian.Uint32(data[4:])
+		Expect(n % 4).To(BeZero())
+		Expect(binary.LittleEndian.Uint32(data[n-4:])).To(Equal(n))
+
+		result = append(result, block{
+			Type: binary.LittleEndian.Uint32(data),
+			Body: data[8 : n-4],
+		})
+
+		data = data[n:]
+	}
+
+	return result
+}
+
+// enhancedPacket is the content of an enhanced packet block.
+type enhancedPacket struct {
+	InterfaceID uint32
+	Timestamp   uint64
+	Data        []byte
+}
+
+// packet parses an enhanced packet block.
+func packet(b block) enhancedPacket {
+	Expect(b.Type).To(BeEquivalentTo(6))
+
+	n := binary.LittleEndian.Uint32(b.Body[12:])
+	Expect(binary.LittleEndian.Uint32(b.Body[16:])).To(Equal(n))
+
+	return enhancedPacket{
+		InterfaceID: binary.LittleEndian.Uint32(b.Body),
+		Timestamp: uint64(binary.LittleEndian.Uint32(b.Body[4:]))<<32 |
+			uint64(binary.LittleEndian.Uint32(b.Body[8:])),
+		Data: b.Body[20 : 20+n],
+	}
+}
+
+// checksum returns the one's complement sum of the 16-bit words in b, which is
+// 0xffff if b contains a valid internet checksum.
+func checksum(b []byte) uint16 {
+	var s uint32
+	for i := 0; i < len(b); i += 2 {
+		w := uint32(b[i]) << 8
+		if i+1 < len(b) {
+			w |= uint32(b[i+1])
+		}
+		s += w
+	}
+
+	for s>>16 != 0 {
+		s = s&0xffff + s>>16
+	}
+
+	return uint16(s)
+}
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct {
+	calls int
+}
+
+func (w *failingWriter) Write([]byte) (int, error) {
+	w.calls++
+	return 0, errors.New("<error>")
+}
@@ -0,0 +1,415 @@
+package responder
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// probeCount is the number of probe queries sent for a name before it is
+	// considered to be established.
+	probeCount = 3
+
+	// probeInterval is the time between successive probe queries.
+	probeInterval = 250 * time.Millisecond
+
+	// maxProbeDelay is the upper bound of the random delay before the first
+	// probe for a newly registered name.
+	maxProbeDelay = 250 * time.Millisecond
+
+	// probeDeferral is the time to wait before probing again after losing a
+	// simultaneous probe tiebreak.
+	probeDeferral = 1 * time.Second
+)
+
+// nameState is the state of a name for which the responder provides unique
+// records.
+type nameState int
+
+const (
+	// stateProbing indicates that the responder is probing to verify that no
+	// other responder is using the name.
+	stateProbing nameState = iota
+
+	// stateEstablished indicates that probing completed successfully, and the
+	// responder may answer questions about the name.
+	stateEstablished
+
+	// stateConflicted indicates that some other responder has claimed the
+	// name, and the responder is attempting to rename it.
+	stateConflicted
+)
+
+// uniqueName is a name for which the responder provides unique records.
+type uniqueName struct {
+	// Name is the name, as returned by the answerer.
+	Name string
+
+	// State is the current state of the name.
+	State nameState
+
+	// Records is the set of unique records at this name, as proposed in the
+	// authority section of probe queries.
+	Records []dns.RR
+
+	// Published is true if the name was obtained from the answerer's
+	// Publisher implementation, as opposed to being discovered when answering
+	// a question.
+	Published bool
+
+	// probe is the probe in progress for this name, if any.
+	probe *probe
+}
+
+// canonicalName returns the form of n used to compare names, which are
+// case-insensitive.
+func canonicalName(n string) string {
+	return strings.ToLower(n)
+}
+
+// probe is a command that sends a probe query for a group of names.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.1.
+type probe struct {
+	Iface *ifaceContext
+	Names []*uniqueName
+	Sent  int
+
+	// Shared is a set of shared records that are announced along with the
+	// unique records once probing is complete.
+	Shared []dns.RR
+}
+
+func (c *probe) Execute(ctx context.Context, r *Responder) error {
+	// remove any names that are no longer being probed by this command, either
+	// because a conflict was detected, or because probing was restarted.
+	var active []*uniqueName
+	for _, n := range c.Names {
+		if n.probe == c {
+			active = append(active, n)
+		}
+	}
+
+	c.Names = active
+
+	if len(c.Names) == 0 {
+		return nil
+	}
+
+	// If 250 ms passes after the last probe was sent without any conflicting
+	// response being received, the probing step is complete.
+	if c.Sent == probeCount {
+		for _, n := range c.Names {
+			n.State = stateEstablished
+			n.probe = nil
+			r.logger.Debug("probing for '%s' completed successfully", n.Name)
+		}
+
+		r.announce(ctx, c.Iface, c.Names, c.Shared)
+
+		return nil
+	}
+
+	// All probe queries SHOULD be done using the desired resource record
+	// name and class (usually class 1, "Internet"), and query type "ANY"
+	// (255), to elicit answers for all types of records with that name.
+	//
+	// The first probe query SHOULD be sent with the unicast-response bit
+	// set, so that a defending host can respond directly to the prober.
+	//
+	// A probe query for a name SHOULD include the proposed records in the
+	// Authority Section, so that simultaneous probes can be resolved.
+	m := mdns.NewQuery(false)
+
+	for _, n := range c.Names {
+		q := dns.Question{
+			Name:   n.Name,
+			Qtype:  dns.TypeANY,
+			Qclass: dns.ClassINET,
+		}
+
+		if c.Sent == 0 {
+			q = mdns.SetUnicastResponse(q)
+		}
+
+		m.Question = append(m.Question, q)
+		m.Ns = append(m.Ns, n.Records...)
+	}
+
+	if err := r.multicast(c.Iface, m); err != nil {
+		r.logger.Log("error sending mDNS probe on %s: %s", c.Iface.Interface.Name, err)
+	} else {
+		r.stats.add(&r.stats.probes, 1)
+	}
+
+	c.Sent++
+	r.schedule(ctx, probeInterval, c)
+
+	return nil
+}
+
+// beginProbing starts probing the given names on ifc after a delay of d, or
+// longer if the responder must back off after repeated conflicts.
+//
+// Any probe already in progress for these names is abandoned.
+func (r *Responder) beginProbing(
+	ctx context.Context,
+	ifc *ifaceContext,
+	d time.Duration,
+	names []*uniqueName,
+) *probe {
+	if b := r.probeBackOff(); d < b {
+		d = b
+	}
+
+	c := &probe{Iface: ifc, Names: names}
+
+	for _, n := range names {
+		n.State = stateProbing
+		n.probe = c
+	}
+
+	r.schedule(ctx, d, c)
+
+	return c
+}
+
+// probeDelay returns a random delay to wait before probing for newly
+// registered names.
+//
+// https://tools.ietf.org/html/rfc6762#section-8.1
+//
+// When ready to send its Multicast DNS probe packet(s) the host should
+// first wait for a short random delay time, uniformly distributed in
+// the range 0-250 ms.  This random delay is to guard against the case
+// where several devices are powered on simultaneously, or several
+// devices are connected to an Ethernet hub, which is then powered on,
+// or some other external event happens that might cause a group of
+// hosts to all send synchronized probes.
+func (r *Responder) probeDelay() time.Duration {
+	return r.randT(maxProbeDelay)
+}
+
+// discover begins discovering the unique records at each of the given names
+// that are not already known to the responder on ifc.
+//
+// The records are fetched by the worker pool, after which probing begins.
+func (r *Responder) discover(ctx context.Context, ifc *ifaceContext, names []string) {
+	var unknown []string
+
+	for _, n := range names {
+		if _, ok := ifc.Names[canonicalName(n)]; !ok {
+			unknown = append(unknown, n)
+		}
+	}
+
+	if len(unknown) != 0 {
+		r.submit(ctx, &discoverJob{ifc.Interface, unknown})
+	}
+}
+
+// discoverJob is a job that fetches the unique records at a set of names.
+type discoverJob struct {
+	Interface net.Interface
+	Names     []string
+}
+
+// Run fetches the records, within the query deadline, and passes them to the
+// main loop to be probed.
+func (j *discoverJob) Run(ctx context.Context, r *Responder) {
+	dctx, cancel := r.withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	c := &probeDiscovered{Interface: j.Interface.Index}
+
+	for _, n := range j.Names {
+		records, _, err := r.records(dctx, j.Interface, n)
+		if err != nil {
+			if ctx.Err() == nil {
+				r.logger.Log("unable to discover the records at '%s' on %s: %s", n, j.Interface.Name, err)
+			}
+
+			break
+		}
+
+		if len(records) != 0 {
+			c.Names = append(c.Names, &uniqueName{
+				Name:    n,
+				Records: records,
+			})
+		}
+	}
+
+	if len(c.Names) != 0 {
+		_ = r.execute(ctx, c) // only fails if the responder is stopping
+	}
+}
+
+// probeDiscovered is a command that begins probing the names found by a
+// discoverJob.
+type probeDiscovered struct {
+	Interface int
+	Names     []*uniqueName
+}
+
+func (c *probeDiscovered) Execute(ctx context.Context, r *Responder) error {
+	ifc, ok := r.interfaces[c.Interface]
+	if !ok {
+		return nil
+	}
+
+	var pending []*uniqueName
+
+	for _, n := range c.Names {
+		// the name may have become known while its records were being
+		// fetched, for example, if it was also discovered by another query
+		k := canonicalName(n.Name)
+		if _, ok := ifc.Names[k]; ok {
+			continue
+		}
+
+		ifc.Names[k] = n
+		pending = append(pending, n)
+	}
+
+	if len(pending) != 0 {
+		r.beginProbing(ctx, ifc, r.probeDelay(), pending)
+	}
+
+	return nil
+}
+
+// records asks the answerer for all of the unique and shared records at the
+// given name, as published on iface.
+//
+// It calls the answerer, so it must only be called by the worker pool.
+func (r *Responder) records(ctx context.Context, iface net.Interface, n string) (unique, shared []dns.RR, err error) {
+	dnsQ := dns.Question{
+		Name:   n,
+		Qtype:  dns.TypeANY,
+		Qclass: dns.ClassINET,
+	}
+
+	var (
+		q = Question{
+			Question:  dnsQ,
+			Query:     mdns.NewQuery(false, dnsQ),
+			Interface: iface,
+		}
+		a = Answer{}
+	)
+
+	if err := r.answerer.Answer(ctx, &q, &a); err != nil {
+		return nil, nil, err
+	}
+
+	k := canonicalName(n)
+
+	for _, rr := range a.Unique.AnswerSection {
+		if canonicalName(rr.Header().Name) == k {
+			unique = append(unique, rr)
+		}
+	}
+
+	for _, rr := range a.Shared.AnswerSection {
+		if canonicalName(rr.Header().Name) == k {
+			shared = append(shared, rr)
+		}
+	}
+
+	return unique, shared, nil
+}
+
+// withholdUnprobed removes any records from rs that belong to a name that has
+// not been successfully probed on ifc.
+//
+// It returns the names of any records that are not yet known to the responder.
+func (r *Responder) withholdUnprobed(ifc *ifaceContext, rs *ResponseSections) []string {
+	var unknown []string
+
+	filter := func(records []dns.RR) []dns.RR {
+		var result []dns.RR
+
+		for _, rr := range records {
+			n, ok := ifc.Names[canonicalName(rr.Header().Name)]
+
+			if !ok {
+				unknown = append(unknown, rr.Header().Name)
+			} else if n.State == stateEstablished {
+				result = append(result, rr)
+			}
+		}
+
+		return result
+	}
+
+	rs.AnswerSection = filter(rs.AnswerSection)
+	rs.AuthoritySection = filter(rs.AuthoritySection)
+	rs.AdditionalSection = filter(rs.AdditionalSection)
+
+	return unknown
+}
+
+// resolveSimultaneousProbes compares the proposed records in the authority
+// section of a probe query from another host with those of any names that the
+// responder is currently probing on ifc.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.2.
+func (r *Responder) resolveSimultaneousProbes(ctx context.Context, ifc *ifaceContext, m *dns.Msg) {
+	if len(m.Ns) == 0 {
+		return
+	}
+
+	for _, q := range m.Question {
+		k := canonicalName(q.Name)
+
+		n, ok := ifc.Names[k]
+		if !ok || n.State != stateProbing {
+			continue
+		}
+
+		var theirs []dns.RR
+		for _, rr := range m.Ns {
+			if canonicalName(rr.Header().Name) == k {
+				theirs = append(theirs, rr)
+			}
+		}
+
+		if len(theirs) == 0 {
+			continue
+		}
+
+		// If the host finds that its own data is lexicographically later, it
+		// simply ignores the other host's probe.  If the host finds that its
+		// own data is lexicographically earlier, then it defers to the winning
+		// host by waiting one second, and then begins probing for this record
+		// again.
+		if mdns.CompareRecordSets(n.Records, theirs) < 0 {
+			r.logger.Debug(
+				"lost simultaneous probe tiebreak for '%s' on %s, probing again in %s",
+				n.Name,
+				ifc.Interface.Name,
+				probeDeferral,
+			)
+
+			r.beginProbing(ctx, ifc, probeDeferral, []*uniqueName{n})
+		}
+	}
+}
+
+// containsRecord returns true if records contains a record with the same
+// class, type and rdata as rr.
+func containsRecord(records []dns.RR, rr dns.RR) bool {
+	for _, x := range records {
+		if mdns.CompareRecords(x, rr) == 0 {
+			return true
+		}
+	}
+
+	return false
+}
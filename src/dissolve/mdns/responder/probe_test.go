@@ -0,0 +1,223 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder probing", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		q        *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		answerer = newTestAnswerer(
+			[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+			nil,
+		)
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// start starts r and returns its first probe.
+	start := func(r *testResponder) *received {
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		m := q.Receive()
+		Expect(m.Response).To(BeFalse())
+
+		return m
+	}
+
+	It("probes for each name using an ANY query with the proposed records in the authority section", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		m := start(r)
+
+		Expect(m.Question).To(HaveLen(1))
+		Expect(m.Question[0].Name).To(Equal("host.local."))
+		Expect(m.Question[0].Qtype).To(Equal(dns.TypeANY))
+		Expect(m.Ns).To(HaveLen(1))
+		Expect(m.Ns).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+	})
+
+	It("does not probe names that only have shared records", func() {
+		answerer.Set(
+			nil,
+			[]dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")},
+		)
+
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		m := q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(haveRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local."))
+	})
+
+	It("does not answer questions about unique records until probing is complete", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		start(r)
+
+		q.Query(question("host.local.", dns.TypeA))
+
+		e := r.HandledQuery()
+		Expect(e.Unicast.Answer).To(BeEmpty())
+		Expect(e.Multicast.Answer).To(BeEmpty())
+		Expect(r.Published()).To(BeEmpty())
+
+		for i := 0; i < 3; i++ {
+			network.Advance(250 * time.Millisecond)
+			q.Receive()
+		}
+
+		Expect(r.Published()).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+
+		// wait for the second announcement, and for the rate limit that
+		// applies after it to elapse
+		network.Advance(1 * time.Second)
+		q.Receive()
+		network.Advance(1 * time.Second)
+
+		q.Query(question("host.local.", dns.TypeA))
+
+		m := q.ReceiveResponse()
+		Expect(m.Answer).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+	})
+
+	It("probes unique records that are discovered when answering a question", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", unpublished{answerer})
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		q.Query(question("host.local.", dns.TypeA))
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		m := q.Receive()
+		Expect(m.Response).To(BeFalse())
+		Expect(m.Question[0].Name).To(Equal("host.local."))
+		Expect(m.Ns).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+
+		for i := 0; i < 3; i++ {
+			network.Advance(250 * time.Millisecond)
+			q.Receive()
+		}
+
+		Expect(r.Published()).To(haveRecord("host.local. 120 IN A 192.168.1.10"))
+	})
+
+	Context("when another host probes for the same name at the same time", func() {
+		// probe returns a probe query for host.local. with the given address
+		// as the proposed record.
+		probe := func(addr string) *dns.Msg {
+			m := mdns.NewQuery(false, question("host.local.", dns.TypeANY))
+			m.Ns = []dns.RR{rr("host.local. 120 IN A " + addr)}
+			return m
+		}
+
+		It("defers to the other host for one second if its records are lexicographically later", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+			start(r)
+
+			q.Send(probe("192.168.1.20"))
+			r.HandledQuery()
+
+			network.Advance(999 * time.Millisecond)
+			q.ExpectNothing()
+			network.Advance(1 * time.Millisecond)
+
+			// probing starts over, so the first probe requests a unicast
+			// response again
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			unicast, _ := mdns.WantsUnicastResponse(m.Question[0])
+			Expect(unicast).To(BeTrue())
+		})
+
+		It("ignores the other host's probe if its records are lexicographically earlier", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+			start(r)
+
+			q.Send(probe("192.168.1.5"))
+			r.HandledQuery()
+
+			network.Advance(250 * time.Millisecond)
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			unicast, _ := mdns.WantsUnicastResponse(m.Question[0])
+			Expect(unicast).To(BeFalse())
+		})
+
+		It("ignores probes with identical records", func() {
+			r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+			start(r)
+
+			q.Send(probe("192.168.1.10"))
+			r.HandledQuery()
+
+			network.Advance(250 * time.Millisecond)
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			unicast, _ := mdns.WantsUnicastResponse(m.Question[0])
+			Expect(unicast).To(BeFalse())
+		})
+
+		It("allows the responder with the lexicographically later records to claim the name", func() {
+			a := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+			b := network.NewResponder(
+				"eth2", "192.168.1.30/24",
+				newTestAnswerer(
+					[]dns.RR{rr("host.local. 120 IN A 192.168.1.30")},
+					nil,
+				),
+			)
+
+			// b starts probing before a's first probe interval elapses, and each
+			// step is awaited, rather than racing the clock
+			start(a)
+			start(b)
+
+			// a defers to b, and probes again after b's probes are sent
+			a.HandledQuery()
+
+			for i := 1; i < 3; i++ {
+				network.Advance(250 * time.Millisecond)
+
+				m := q.Receive()
+				Expect(m.Response).To(BeFalse())
+				Expect(m.Source.IP.String()).To(Equal("192.168.1.30"))
+
+				a.HandledQuery()
+			}
+
+			network.Advance(250 * time.Millisecond)
+
+			m := q.ReceiveResponse()
+			Expect(m.Source.IP.String()).To(Equal("192.168.1.30"))
+
+			Expect(b.Published()).To(haveRecord("host.local. 120 IN A 192.168.1.30"))
+			Expect(a.Published()).To(BeEmpty())
+		})
+	})
+})
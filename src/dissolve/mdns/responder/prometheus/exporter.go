@@ -0,0 +1,144 @@
+// Package prometheus exports mDNS responder statistics in the Prometheus text
+// exposition format.
+//
+// See https://prometheus.io/docs/instrumenting/exposition_formats/.
+package prometheus
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+)
+
+// contentType is the content type of the text exposition format.
+const contentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Source is an interface for obtaining responder statistics. It is implemented
+// by *responder.Responder.
+type Source interface {
+	Stats() responder.Stats
+}
+
+// Handler returns an HTTP handler that serves the statistics from s.
+func Handler(s Source) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		_ = Write(w, s.Stats()) // nothing useful can be done with a write error
+	})
+}
+
+// Write writes st to w in the Prometheus text exposition format.
+func Write(w io.Writer, st responder.Stats) error {
+	b := bufio.NewWriter(w)
+
+	packets(b, "dissolve_mdns_packets_received_total", "Number of mDNS packets received.", st.PacketsReceived)
+	packets(b, "dissolve_mdns_packets_sent_total", "Number of mDNS packets sent.", st.PacketsSent)
+
+	labelled(b, "dissolve_mdns_queries_total", "Number of mDNS questions received.", "qtype", st.Queries)
+	labelled(b, "dissolve_mdns_answers_total", "Number of records produced by each answerer.", "answerer", st.Answers)
+
+	counter(b, "dissolve_mdns_suppressed_answers_total", "Number of records omitted from responses as known answers.", st.SuppressedAnswers)
+	counter(b, "dissolve_mdns_parse_errors_total", "Number of mDNS packets that could not be parsed.", st.ParseErrors)
+	counter(b, "dissolve_mdns_dropped_packets_total", "Number of mDNS packets ignored because they were not received on a served interface, or were not from the local link.", st.DroppedPackets)
+	counter(b, "dissolve_mdns_probes_total", "Number of mDNS probe queries sent.", st.Probes)
+	counter(b, "dissolve_mdns_conflicts_total", "Number of name conflicts detected.", st.Conflicts)
+	counter(b, "dissolve_mdns_goodbyes_total", "Number of records withdrawn using goodbye packets.", st.Goodbyes)
+
+	histograms(b, "dissolve_mdns_answer_duration_seconds", "Time taken by each answerer to answer a question.", st.AnswerLatency)
+
+	return b.Flush()
+}
+
+// header writes the HELP and TYPE lines for a metric.
+func header(w *bufio.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// counter writes a counter without labels.
+func counter(w *bufio.Writer, name, help string, v uint64) {
+	header(w, name, help, "counter")
+	fmt.Fprintf(w, "%s %d\n", name, v)
+}
+
+// labelled writes a counter with a single label.
+func labelled(w *bufio.Writer, name, help, label string, values map[string]uint64) {
+	header(w, name, help, "counter")
+
+	for _, k := range sortedKeys(values) {
+		fmt.Fprintf(w, "%s{%s=%s} %d\n", name, label, quote(k), values[k])
+	}
+}
+
+// packets writes a packet counter, labelled by transport and interface.
+func packets(w *bufio.Writer, name, help string, counts []responder.PacketCount) {
+	header(w, name, help, "counter")
+
+	for _, c := range counts {
+		fmt.Fprintf(
+			w,
+			"%s{transport=%s,interface=%s} %d\n",
+			name,
+			quote(c.Transport),
+			quote(c.Interface),
+			c.Count,
+		)
+	}
+}
+
+// histograms writes a histogram for each answerer.
+func histograms(w *bufio.Writer, name, help string, values map[string]responder.Histogram) {
+	header(w, name, help, "histogram")
+
+	keys := make([]string, 0, len(values))
+	for k := range values {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		h := values[k]
+		a := quote(k)
+
+		for _, b := range h.Buckets {
+			fmt.Fprintf(
+				w,
+				"%s_bucket{answerer=%s,le=%s} %d\n",
+				name,
+				a,
+				quote(strconv.FormatFloat(b.UpperBound.Seconds(), 'g', -1, 64)),
+				b.Count,
+			)
+		}
+
+		fmt.Fprintf(w, "%s_bucket{answerer=%s,le=\"+Inf\"} %d\n", name, a, h.Count)
+		fmt.Fprintf(w, "%s_sum{answerer=%s} %s\n", name, a, strconv.FormatFloat(h.Sum.Seconds(), 'g', -1, 64))
+		fmt.Fprintf(w, "%s_count{answerer=%s} %d\n", name, a, h.Count)
+	}
+}
+
+// sortedKeys returns the keys of m in sorted order.
+func sortedKeys(m map[string]uint64) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// labelEscaper escapes label values as required by the exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+// quote returns v as a quoted label value.
+func quote(v string) string {
+	return `"` + labelEscaper.Replace(v) + `"`
+}
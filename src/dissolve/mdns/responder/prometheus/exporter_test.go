@@ -0,0 +1,120 @@
+package prometheus_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder/prometheus"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Write", func() {
+	var stats responder.Stats
+
+	BeforeEach(func() {
+		stats = responder.Stats{
+			PacketsReceived: []responder.PacketCount{
+				{Transport: "ipv4", Interface: "eth0", Count: 3},
+			},
+			PacketsSent: []responder.PacketCount{
+				{Transport: "ipv4", Interface: "eth0", Count: 5},
+				{Transport: "ipv6", Interface: "eth0", Count: 4},
+			},
+			Queries: map[string]uint64{"PTR": 2, "A": 1},
+			Answers: map[string]uint64{`*bonjour."Answerer"`: 7},
+			AnswerLatency: map[string]responder.Histogram{
+				"host": {
+					Buckets: []responder.Bucket{
+						{UpperBound: 1 * time.Millisecond, Count: 1},
+						{UpperBound: 500 * time.Millisecond, Count: 2},
+					},
+					Count: 3,
+					Sum:   1500 * time.Millisecond,
+				},
+			},
+			SuppressedAnswers: 6,
+			ParseErrors:       1,
+			DroppedPackets:    3,
+			Probes:            9,
+			Conflicts:         2,
+			Goodbyes:          8,
+		}
+	})
+
+	// write returns the statistics in the exposition format.
+	write := func() string {
+		var b bytes.Buffer
+		Expect(Write(&b, stats)).To(Succeed())
+		return b.String()
+	}
+
+	It("writes the packet counters, labelled by transport and interface", func() {
+		Expect(write()).To(ContainSubstring(
+			"# HELP dissolve_mdns_packets_sent_total Number of mDNS packets sent.\n" +
+				"# TYPE dissolve_mdns_packets_sent_total counter\n" +
+				`dissolve_mdns_packets_sent_total{transport="ipv4",interface="eth0"} 5` + "\n" +
+				`dissolve_mdns_packets_sent_total{transport="ipv6",interface="eth0"} 4` + "\n",
+		))
+		Expect(write()).To(ContainSubstring(
+			`dissolve_mdns_packets_received_total{transport="ipv4",interface="eth0"} 3` + "\n",
+		))
+	})
+
+	It("writes the labelled counters in order of their labels", func() {
+		Expect(write()).To(ContainSubstring(
+			`dissolve_mdns_queries_total{qtype="A"} 1` + "\n" +
+				`dissolve_mdns_queries_total{qtype="PTR"} 2` + "\n",
+		))
+	})
+
+	It("escapes label values", func() {
+		Expect(write()).To(ContainSubstring(
+			`dissolve_mdns_answers_total{answerer="*bonjour.\"Answerer\""} 7` + "\n",
+		))
+	})
+
+	It("writes the counters without labels", func() {
+		s := write()
+		Expect(s).To(ContainSubstring("dissolve_mdns_suppressed_answers_total 6\n"))
+		Expect(s).To(ContainSubstring("dissolve_mdns_parse_errors_total 1\n"))
+		Expect(s).To(ContainSubstring("dissolve_mdns_dropped_packets_total 3\n"))
+		Expect(s).To(ContainSubstring("dissolve_mdns_probes_total 9\n"))
+		Expect(s).To(ContainSubstring("dissolve_mdns_conflicts_total 2\n"))
+		Expect(s).To(ContainSubstring("dissolve_mdns_goodbyes_total 8\n"))
+	})
+
+	It("writes the latency histograms, in seconds", func() {
+		Expect(write()).To(ContainSubstring(
+			"# TYPE dissolve_mdns_answer_duration_seconds histogram\n" +
+				`dissolve_mdns_answer_duration_seconds_bucket{answerer="host",le="0.001"} 1` + "\n" +
+				`dissolve_mdns_answer_duration_seconds_bucket{answerer="host",le="0.5"} 2` + "\n" +
+				`dissolve_mdns_answer_duration_seconds_bucket{answerer="host",le="+Inf"} 3` + "\n" +
+				`dissolve_mdns_answer_duration_seconds_sum{answerer="host"} 1.5` + "\n" +
+				`dissolve_mdns_answer_duration_seconds_count{answerer="host"} 3` + "\n",
+		))
+	})
+})
+
+var _ = Describe("Handler", func() {
+	It("serves the statistics from the source", func() {
+		h := Handler(source{Probes: 4})
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+		Expect(w.Code).To(Equal(http.StatusOK))
+		Expect(w.Header().Get("Content-Type")).To(Equal("text/plain; version=0.0.4; charset=utf-8"))
+		Expect(w.Body.String()).To(ContainSubstring("dissolve_mdns_probes_total 4\n"))
+	})
+})
+
+// source is a Source that returns fixed statistics.
+type source responder.Stats
+
+func (s source) Stats() responder.Stats {
+	return responder.Stats(s)
+}
@@ -0,0 +1,327 @@
+package responder
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+)
+
+const (
+	// announceCount is the number of unsolicited responses sent to announce
+	// new or updated records.
+	announceCount = 2
+
+	// announceInterval is the time between successive announcements.
+	announceInterval = 1 * time.Second
+)
+
+// notify is registered with answerers that implement Notifier. It causes the
+// responder to re-publish the answerer's records.
+//
+// It does not block, multiple notifications that occur before the responder
+// re-publishes its records are coalesced.
+func (r *Responder) notify() {
+	select {
+	case r.changed <- struct{}{}:
+	default:
+	}
+}
+
+// publish begins re-publishing the answerer's records on ifc, if it is a
+// Publisher.
+//
+// The records are fetched by the worker pool, then compared to the records
+// that were published previously on ifc by the main loop.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.
+func (r *Responder) publish(ctx context.Context, ifc *ifaceContext) {
+	p, ok := r.answerer.(Publisher)
+	if !ok {
+		return
+	}
+
+	r.generation++
+	ifc.Generation = r.generation
+
+	r.submit(ctx, &publishJob{p, ifc.Interface, ifc.Generation})
+}
+
+// publishJob is a job that fetches the records published by a Publisher on a
+// specific interface.
+type publishJob struct {
+	Publisher  Publisher
+	Interface  net.Interface
+	Generation uint64
+}
+
+// Run fetches the records, within the query deadline, and passes them to the
+// main loop to be published.
+//
+// If the records can not be fetched in full, nothing is published, as the
+// missing records would otherwise be withdrawn.
+func (j *publishJob) Run(ctx context.Context, r *Responder) {
+	pctx, cancel := r.withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	c, err := j.fetch(pctx, r)
+	if err != nil {
+		if ctx.Err() == nil {
+			r.logger.Log("error publishing mDNS records on %s: %s", j.Interface.Name, err)
+		}
+
+		return
+	}
+
+	_ = r.execute(ctx, c) // only fails if the responder is stopping
+}
+
+// fetch queries the publisher for the names that it publishes, and the records
+// at each of those names.
+func (j *publishJob) fetch(ctx context.Context, r *Responder) (*applyPublished, error) {
+	names, err := j.Publisher.Names(ctx, j.Interface)
+	if err != nil {
+		return nil, err
+	}
+
+	c := &applyPublished{
+		Interface:  j.Interface.Index,
+		Generation: j.Generation,
+	}
+
+	for _, name := range names {
+		n := name.String()
+
+		u, s, err := r.records(ctx, j.Interface, n)
+		if err != nil {
+			return nil, err
+		}
+
+		c.Names = append(c.Names, publishedName{n, u, s})
+	}
+
+	return c, nil
+}
+
+// publishedName is a name published by a Publisher, and its records.
+type publishedName struct {
+	Name   string
+	Unique []dns.RR
+	Shared []dns.RR
+}
+
+// applyPublished is a command that compares the records fetched by a
+// publishJob to the records that were published previously on an interface.
+//
+// Probing begins for any new unique names. New shared records, and unique
+// records that have changed are announced.
+type applyPublished struct {
+	Interface  int
+	Generation uint64
+	Names      []publishedName
+}
+
+func (c *applyPublished) Execute(ctx context.Context, r *Responder) error {
+	// the interface may have been removed, or its records fetched again,
+	// while these records were being fetched
+	ifc, ok := r.interfaces[c.Interface]
+	if !ok || ifc.Generation != c.Generation {
+		return nil
+	}
+
+	var (
+		seen      = map[string]struct{}{}
+		pending   []*uniqueName
+		changed   []*uniqueName
+		shared    []dns.RR
+		withdrawn []dns.RR
+	)
+
+	for _, name := range c.Names {
+		var (
+			n = name.Name
+			k = canonicalName(n)
+			u = name.Unique
+			s = name.Shared
+		)
+
+		seen[k] = struct{}{}
+
+		for _, rr := range s {
+			if !containsRecord(ifc.Shared[k], rr) {
+				shared = append(shared, rr)
+			}
+		}
+
+		for _, rr := range ifc.Shared[k] {
+			if !containsRecord(s, rr) {
+				withdrawn = append(withdrawn, rr)
+			}
+		}
+
+		if len(s) == 0 {
+			delete(ifc.Shared, k)
+		} else {
+			ifc.Shared[k] = s
+		}
+
+		x, ok := ifc.Names[k]
+
+		if !ok {
+			if len(u) != 0 {
+				x = &uniqueName{
+					Name:      n,
+					Records:   u,
+					Published: true,
+				}
+
+				ifc.Names[k] = x
+				pending = append(pending, x)
+			}
+
+			continue
+		}
+
+		x.Published = true
+
+		if len(u) == 0 {
+			withdrawn = append(withdrawn, r.unpublish(ifc, x)...)
+		} else if mdns.CompareRecordSets(x.Records, u) != 0 {
+			// https://tools.ietf.org/html/rfc6762#section-8.4
+			//
+			// At any time, if the rdata of any of a host's Multicast DNS
+			// records changes, the host MUST repeat the Announcing step to
+			// update neighboring caches.
+			//
+			// https://tools.ietf.org/html/rfc6762#section-10.2
+			//
+			// [...] if a host's IP address changes, the host SHOULD send
+			// goodbye packets for the old address records, and announce the
+			// new address records with the cache-flush bit set.
+			if x.State == stateEstablished {
+				for _, rr := range x.Records {
+					if !containsRecord(u, rr) {
+						withdrawn = append(withdrawn, rr)
+					}
+				}
+
+				changed = append(changed, x)
+			}
+
+			x.Records = u
+		}
+	}
+
+	for k, x := range ifc.Names {
+		if _, ok := seen[k]; !ok && x.Published {
+			withdrawn = append(withdrawn, r.unpublish(ifc, x)...)
+		}
+	}
+
+	for k, s := range ifc.Shared {
+		if _, ok := seen[k]; !ok {
+			withdrawn = append(withdrawn, s...)
+			delete(ifc.Shared, k)
+		}
+	}
+
+	r.goodbye(ifc, withdrawn)
+
+	// new shared records are announced along with any new unique records once
+	// they have been probed, so that they are not announced before the
+	// records they refer to can be queried
+	if len(pending) != 0 {
+		c := r.beginProbing(ctx, ifc, r.probeDelay(), pending)
+		c.Shared = shared
+		shared = nil
+	}
+
+	r.announce(ctx, ifc, changed, shared)
+
+	return nil
+}
+
+// unpublish removes a unique name from ifc.
+//
+// It returns the records that need to be withdrawn from the network, which is
+// empty unless the name had already been established.
+func (r *Responder) unpublish(ifc *ifaceContext, n *uniqueName) []dns.RR {
+	delete(ifc.Names, canonicalName(n.Name))
+	n.probe = nil
+
+	if n.State == stateEstablished {
+		return n.Records
+	}
+
+	return nil
+}
+
+// announce begins announcing the records at the given unique names, along with
+// the given shared records, on ifc.
+func (r *Responder) announce(
+	ctx context.Context,
+	ifc *ifaceContext,
+	names []*uniqueName,
+	shared []dns.RR,
+) {
+	if len(names) == 0 && len(shared) == 0 {
+		return
+	}
+
+	c := &announcement{
+		Iface:  ifc,
+		Names:  names,
+		Shared: shared,
+	}
+
+	_ = c.Execute(ctx, r) // always nil, send errors are logged
+}
+
+// announcement is a command that sends unsolicited multicast responses
+// containing newly established or updated records.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.3.
+type announcement struct {
+	Iface  *ifaceContext
+	Names  []*uniqueName
+	Shared []dns.RR
+	Sent   int
+}
+
+func (c *announcement) Execute(ctx context.Context, r *Responder) error {
+	m := mdns.NewUnsolicitedResponse()
+
+	for _, n := range c.Names {
+		// only announce names that are still established, and have not been
+		// lost to a conflict or removed by the answerer in the meantime.
+		if n.State == stateEstablished && c.Iface.Names[canonicalName(n.Name)] == n {
+			m.Answer = appendUnique(m.Answer, n.Records)
+		}
+	}
+
+	for _, rr := range c.Shared {
+		if containsRecord(c.Iface.Shared[canonicalName(rr.Header().Name)], rr) {
+			m.Answer = append(m.Answer, rr)
+		}
+	}
+
+	if len(m.Answer) == 0 {
+		return nil
+	}
+
+	// The Multicast DNS responder MUST send at least two unsolicited
+	// responses, one second apart.
+	if err := r.multicast(c.Iface, m); err != nil {
+		r.logger.Log("error announcing mDNS records on %s: %s", c.Iface.Interface.Name, err)
+	}
+
+	c.Sent++
+
+	if c.Sent < announceCount {
+		r.schedule(ctx, announceInterval, c)
+	}
+
+	return nil
+}
@@ -0,0 +1,164 @@
+package responder_test
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder announcements", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		q        *querier
+		unique   []dns.RR
+		shared   []dns.RR
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		unique = []dns.RR{
+			rr("web._http._tcp.local. 120 IN SRV 0 0 80 host.local."),
+			rr("web._http._tcp.local. 4500 IN TXT \"v=1\""),
+		}
+		shared = []dns.RR{
+			rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+		}
+		answerer = newTestAnswerer(unique, shared)
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// expectAnnouncedTwice expects the next message received by q to be an
+	// announcement of exactly the given records, and the same announcement to
+	// be sent again one second later.
+	expectAnnouncedTwice := func(records ...string) {
+		for i := 0; i < 2; i++ {
+			if i > 0 {
+				network.Advance(999 * time.Millisecond)
+				q.ExpectNothing()
+				network.Advance(1 * time.Millisecond)
+			}
+
+			m := q.Receive()
+			Expect(m.Response).To(BeTrue())
+			Expect(m.Answer).To(HaveLen(len(records)))
+
+			for _, s := range records {
+				Expect(m.Answer).To(haveRecord(s))
+			}
+		}
+
+		network.Advance(10 * time.Second)
+		q.ExpectNothing()
+	}
+
+	It("announces unique records with the cache-flush bit set, and shared records without it", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		for i := 0; i < 3; i++ {
+			Expect(q.Receive().Response).To(BeFalse())
+			network.Advance(250 * time.Millisecond)
+		}
+
+		m := q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(HaveLen(3))
+
+		for _, x := range m.Answer {
+			u, _ := mdns.IsUniqueRecord(x)
+			Expect(u).To(Equal(x.Header().Rrtype != dns.TypePTR))
+		}
+	})
+
+	It("re-announces unique records when their data changes", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		answerer.Set(
+			[]dns.RR{
+				unique[0],
+				rr("web._http._tcp.local. 4500 IN TXT \"v=2\""),
+			},
+			shared,
+		)
+
+		// the old TXT record is withdrawn, as it would otherwise remain in
+		// caches that do not honour the cache-flush bit
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("web._http._tcp.local. 0 IN TXT \"v=1\"")))
+		Expect(m.Answer[0].Header().Ttl).To(BeZero())
+
+		expectAnnouncedTwice(
+			"web._http._tcp.local. 120 IN SRV 0 0 80 host.local.",
+			"web._http._tcp.local. 4500 IN TXT \"v=2\"",
+		)
+	})
+
+	It("announces new shared records without probing", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		answerer.Set(
+			unique,
+			append(
+				shared,
+				rr("_services._dns-sd._udp.local. 4500 IN PTR _http._tcp.local."),
+			),
+		)
+
+		expectAnnouncedTwice(
+			"_services._dns-sd._udp.local. 4500 IN PTR _http._tcp.local.",
+		)
+	})
+
+	It("probes new unique names before announcing them", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		answerer.Set(
+			append(unique, rr("host.local. 120 IN A 192.168.1.10")),
+			shared,
+		)
+
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				network.Advance(250 * time.Millisecond)
+			}
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Question[0].Name).To(Equal("host.local."))
+		}
+
+		network.Advance(250 * time.Millisecond)
+
+		expectAnnouncedTwice(
+			"host.local. 120 IN A 192.168.1.10",
+		)
+	})
+
+	It("re-announces all published records when Reannounce() is called", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		Expect(r.Reannounce(context.Background())).To(Succeed())
+
+		expectAnnouncedTwice(
+			"web._http._tcp.local. 120 IN SRV 0 0 80 host.local.",
+			"web._http._tcp.local. 4500 IN TXT \"v=1\"",
+			"_http._tcp.local. 4500 IN PTR web._http._tcp.local.",
+		)
+	})
+})
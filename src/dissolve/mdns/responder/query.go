@@ -2,6 +2,7 @@ package responder
 
 import (
 	"context"
+	"net"
 
 	"github.com/jmalloc/dissolve/src/dissolve/mdns"
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
@@ -15,6 +16,10 @@ type handleQuery struct {
 }
 
 func (c *handleQuery) Execute(ctx context.Context, r *Responder) error {
+	if r.hold(ctx, c) {
+		return nil
+	}
+
 	if err := c.query(ctx, r); err != nil {
 		r.logger.Log("error handling mDNS query: %s", err)
 	}
@@ -22,59 +27,270 @@ func (c *handleQuery) Execute(ctx context.Context, r *Responder) error {
 	return nil
 }
 
+// query dispatches c to the worker pool to be answered.
+//
+// Answering is performed outside of the main loop, as answerers may be slow,
+// for example, if they perform unicast DNS lookups. The answers are then
+// returned to the main loop to be sent.
 func (c *handleQuery) query(ctx context.Context, r *Responder) error {
-	defer c.Packet.Close()
+	ifc, ok := r.lookupInterface(c.Packet)
+	if !ok {
+		c.Packet.Close()
+		return nil
+	}
 
-	err := mdns.ValidateQuery(c.Message)
-	if err != nil {
+	if err := mdns.ValidateQuery(c.Message); err != nil {
+		c.Packet.Close()
 		return err
 	}
 
+	r.resolveSimultaneousProbes(ctx, ifc, c.Message)
+
+	if !r.dispatch(&queryJob{c, ifc.Interface}) {
+		r.logger.Debug(
+			"ignoring mDNS query from %s on %s, too many queries are already being answered",
+			c.Packet.Source.Address,
+			ifc.Interface.Name,
+		)
+		c.Packet.Close()
+	}
+
+	return nil
+}
+
+// queryJob is a job that answers a query.
+type queryJob struct {
+	Query     *handleQuery
+	Interface net.Interface
+}
+
+// Run answers the questions in the query, within the query deadline, and
+// passes the answers to the main loop to be sent.
+func (j *queryJob) Run(ctx context.Context, r *Responder) {
+	qctx, cancel := r.withTimeout(ctx, r.queryTimeout)
+	defer cancel()
+
+	answers, err := j.answer(qctx, r)
+	if err != nil {
+		if ctx.Err() != nil {
+			j.Query.Packet.Close()
+			return
+		}
+
+		if qctx.Err() == nil {
+			r.logger.Log("error handling mDNS query: %s", err)
+			j.Query.Packet.Close()
+			return
+		}
+
+		// send whatever was answered before the deadline, the querier may
+		// still find the partial answer useful.
+		r.logger.Log(
+			"timed out answering mDNS query from %s on %s after %s",
+			j.Query.Packet.Source.Address,
+			j.Interface.Name,
+			r.queryTimeout,
+		)
+	}
+
+	c := &respondToQuery{j.Query, answers}
+	if err := r.execute(ctx, c); err != nil {
+		j.Query.Packet.Close()
+	}
+}
+
+// answeredQuestion is a single question within a query, and its answer.
+type answeredQuestion struct {
+	Question Question
+	Answer   Answer
+	Unicast  bool
+}
+
+// answer produces answers to each of the questions in j.
+//
+// If ctx is canceled, for example, because the deadline for answering the
+// query has passed, the questions answered so far are returned along with the
+// error.
+func (j *queryJob) answer(ctx context.Context, r *Responder) ([]answeredQuestion, error) {
+	m := j.Query.Message
+	answers := make([]answeredQuestion, 0, len(m.Question))
+
+	for _, rawQ := range m.Question {
+		unicast, dnsQ := mdns.WantsUnicastResponse(rawQ)
+
+		x := answeredQuestion{
+			Question: Question{
+				Question:     dnsQ,
+				Query:        m,
+				Interface:    j.Interface,
+				KnownAnswers: m.Answer,
+			},
+			Unicast: unicast,
+		}
+
+		r.stats.query(dnsQ)
+
+		if err := r.answer(ctx, &x.Question, &x.Answer); err != nil {
+			return answers, err
+		}
+
+		x.Answer.addNegativeResponse(&x.Question)
+		answers = append(answers, x)
+	}
+
+	return answers, nil
+}
+
+// respondToQuery is a command that sends the responses to a query once its
+// questions have been answered by the worker pool.
+type respondToQuery struct {
+	Query   *handleQuery
+	Answers []answeredQuestion
+}
+
+func (c *respondToQuery) Execute(ctx context.Context, r *Responder) error {
+	defer c.Query.Packet.Close()
+
+	if err := c.respond(ctx, r); err != nil {
+		r.logger.Log("error handling mDNS query: %s", err)
+	}
+
+	return nil
+}
+
+func (c *respondToQuery) respond(ctx context.Context, r *Responder) error {
+	// the interface may have been removed while the query was being answered
+	ifc, ok := r.interfaces[c.Query.Packet.Source.InterfaceIndex]
+	if !ok {
+		return nil
+	}
+
 	var (
-		legacy = c.Packet.Source.IsLegacy()
-		uRes   = mdns.NewResponse(c.Message, true)
-		mRes   = mdns.NewResponse(c.Message, false)
+		in     = c.Query.Packet
+		query  = c.Query.Message
+		legacy = in.Source.IsLegacy()
+		uRes   = mdns.NewResponse(query, true)
+		mRes   = mdns.NewResponse(query, false)
+		shared = false
 	)
 
-	for _, rawQ := range c.Message.Question {
-		unicast, dnsQ := mdns.WantsUnicastResponse(rawQ)
+	if legacy {
+		uRes = mdns.NewLegacyResponse(query)
+	}
 
+	for i := range c.Answers {
 		var (
-			q = Question{
-				Question:  dnsQ,
-				Query:     c.Message,
-				Interface: *r.iface,
-			}
-			a = Answer{}
+			q       = &c.Answers[i].Question
+			a       = &c.Answers[i].Answer
+			unicast = c.Answers[i].Unicast
 		)
 
-		err = r.answerer.Answer(ctx, &q, &a)
-		if err != nil {
-			return err
-		}
+		// unique records are not used in responses until they have been
+		// probed, if they are not already known to the responder then they
+		// are discovered, and probing begins.
+		unknown := r.withholdUnprobed(ifc, &a.Unique)
+		r.discover(ctx, ifc, unknown)
+
+		before := a.count()
+		q.suppressKnownAnswers(&a.Unique)
+		q.suppressKnownAnswers(&a.Shared)
+		r.stats.add(&r.stats.suppressed, before-a.count())
 
-		// TODO(jmalloc): probe/announce uniquely-scoped records before
-		// providing answers to them.
+		// https://tools.ietf.org/html/rfc6762#section-5.4
+		//
+		// When receiving a question with the unicast-response bit set, a
+		// responder SHOULD usually respond with a unicast packet directed back
+		// to the querier. However, if the responder has not multicast that
+		// record recently (within one quarter of its TTL), then the responder
+		// SHOULD instead multicast the response so as to keep all the peer
+		// caches up to date, and to permit passive conflict detection.
+		if unicast && !legacy && !ifc.History.allRecent(a, r.now()) {
+			unicast = false
+		}
 
 		if unicast || legacy {
 			a.appendToMessage(uRes, legacy)
 		} else {
 			a.appendToMessage(mRes, false)
+			shared = shared || !a.Shared.IsEmpty()
 		}
 	}
 
-	_, err = transport.SendUnicastResponse(c.Packet, uRes)
-	if err != nil {
+	if _, err := transport.SendUnicastResponse(in, uRes); err != nil {
 		return err
 	}
 
-	_, err = transport.SendMulticastResponse(c.Packet, mRes)
-	if err != nil {
-		return err
+	// https://tools.ietf.org/html/rfc6762#section-6.7
+	//
+	// If the source UDP port in a received Multicast DNS query is not port
+	// 5353, this indicates that the querier originating the query is a
+	// simple resolver [...]. In this case, the Multicast DNS responder MUST
+	// send a UDP response directly back to the querier, via unicast, to the
+	// query packet's source IP address and port.
+	//
+	// Legacy queriers do not listen on the mDNS port, so there is no point
+	// sending a multicast copy of the response.
+	if legacy {
+		r.traceQuery(in, query, uRes, mRes)
+		return nil
+	}
+
+	// https://tools.ietf.org/html/rfc6762#section-6.2
+	//
+	// A Multicast DNS responder MUST NOT multicast a record on a given
+	// interface until at least one second has elapsed since the last time
+	// that record was multicast on that particular interface. [...] The one
+	// exception is that a responder MUST respond quickly to probes. In the
+	// case of a probe response, the 1-second limit is reduced to 250 ms.
+	limit := multicastLimit
+	if isProbe(query) {
+		limit = probeMulticastLimit
+	}
+
+	ifc.History.RateLimit(mRes, limit, r.now())
+
+	// https://tools.ietf.org/html/rfc6762#section-6
+	//
+	// In any case where there may be multiple responses, such as queries
+	// where the answer is a member of a shared resource record set, each
+	// responder SHOULD delay its response. Otherwise, if all of the records
+	// are unique, the responder SHOULD send its response immediately.
+	if shared {
+		r.deferMulticast(ctx, in, mRes)
+	} else {
+		sent, err := transport.SendMulticastResponse(in, mRes)
+		if err != nil {
+			return err
+		}
+
+		if sent {
+			ifc.History.Add(mRes, r.now())
+		}
+	}
+
+	r.traceQuery(in, query, uRes, mRes)
+
+	return nil
+}
+
+// answer populates an answer to a single DNS question using the responder's
+// answerer, recording statistics about each of the answerers involved.
+func (r *Responder) answer(ctx context.Context, q *Question, a *Answer) error {
+	answerers, ok := r.answerer.(UnionAnswerer)
+	if !ok {
+		answerers = UnionAnswerer{r.answerer}
 	}
 
-	// this is a no-op unless compiled with the 'debug' build tag
-	dumpRequestResponse(c.Packet, c.Message, uRes, mRes)
+	for _, x := range answerers {
+		start := r.now()
+		before := a.count()
+
+		if err := x.Answer(ctx, q, a); err != nil {
+			return err
+		}
+
+		r.stats.answered(answererName(x), a.count()-before, r.now().Sub(start))
+	}
 
 	return nil
 }
@@ -0,0 +1,93 @@
+package responder
+
+import (
+	"context"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// Records returns the records that the responder has published on the given
+// interface, such that they can be handed over to a sleep proxy.
+//
+// Unique records are returned with the "unique record bit" set. Records at
+// names that have not been successfully probed are not included.
+func (r *Responder) Records(ctx context.Context, iface net.Interface) ([]dns.RR, error) {
+	c := &getRecords{
+		Interface: iface.Index,
+		Result:    make(chan []dns.RR, 1),
+	}
+
+	if err := r.execute(ctx, c); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case records := <-c.Result:
+		return records, nil
+	}
+}
+
+// Reannounce announces all of the responder's published records on every
+// interface, for example, after waking from sleep.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.3.
+func (r *Responder) Reannounce(ctx context.Context) error {
+	return r.execute(ctx, reannounce{})
+}
+
+// getRecords is a command that fetches the records published on an interface.
+type getRecords struct {
+	Interface int
+	Result    chan []dns.RR
+}
+
+func (c *getRecords) Execute(ctx context.Context, r *Responder) error {
+	var records []dns.RR
+
+	if ifc, ok := r.interfaces[c.Interface]; ok {
+		for _, n := range ifc.Names {
+			if n.State == stateEstablished {
+				records = appendUnique(records, n.Records)
+			}
+		}
+
+		for _, s := range ifc.Shared {
+			for _, rr := range s {
+				records = append(records, dns.Copy(rr))
+			}
+		}
+	}
+
+	c.Result <- records
+
+	return nil
+}
+
+// reannounce is a command that announces all published records.
+type reannounce struct{}
+
+func (reannounce) Execute(ctx context.Context, r *Responder) error {
+	for _, ifc := range r.interfaces {
+		var (
+			names  []*uniqueName
+			shared []dns.RR
+		)
+
+		for _, n := range ifc.Names {
+			if n.State == stateEstablished {
+				names = append(names, n)
+			}
+		}
+
+		for _, s := range ifc.Shared {
+			shared = append(shared, s...)
+		}
+
+		r.announce(ctx, ifc, names, shared)
+	}
+
+	return nil
+}
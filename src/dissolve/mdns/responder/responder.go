@@ -3,10 +3,15 @@ package responder
 import (
 	"context"
 	"errors"
+	"math/rand"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
 
 	"github.com/jmalloc/twelf/src/twelf"
 	"golang.org/x/sync/errgroup"
@@ -17,16 +22,38 @@ type command interface {
 	Execute(ctx context.Context, r *Responder) error
 }
 
-// Responder is an implementation of a multicast DNS responder for a single network interface.
+// Responder is an implementation of a multicast DNS responder.
 type Responder struct {
-	answerer    Answerer
-	iface       *net.Interface
-	disableIPv4 bool
-	disableIPv6 bool
-	logger      twelf.Logger
-
-	done     chan struct{}
-	commands chan command
+	answerer     Answerer
+	network      transport.Network
+	custom       []transport.Transport
+	allowed      map[string]struct{}
+	disableIPv4  bool
+	disableIPv6  bool
+	autoRename   bool
+	host         *Host
+	onConflict   ConflictHandler
+	logger       twelf.Logger
+	stats        *statsCollector
+	directory    *interfaceDirectory
+	clock        clock.Clock
+	rand         *rand.Rand
+	randM        sync.Mutex
+	trace        atomic.Value // *Tracer
+	workers      int
+	queryTimeout time.Duration
+
+	done           chan struct{}
+	commands       chan command
+	jobs           chan job
+	transports     []transport.Transport
+	changed        chan struct{}
+	addressChanged chan struct{}
+	interfaces     map[int]*ifaceContext
+	held           map[string]*heldQuery
+	pending        map[pendingKey]*pendingResponse
+	conflicts      []time.Time
+	generation     uint64
 }
 
 // New returns a new mDNS server.
@@ -35,9 +62,19 @@ func New(
 	options ...Option,
 ) (*Responder, error) {
 	r := &Responder{
-		answerer: answerer,
-		done:     make(chan struct{}),
-		commands: make(chan command),
+		answerer:       answerer,
+		done:           make(chan struct{}),
+		commands:       make(chan command),
+		jobs:           make(chan job, jobQueueSize),
+		workers:        defaultQueryWorkers,
+		queryTimeout:   defaultQueryTimeout,
+		changed:        make(chan struct{}, 1),
+		addressChanged: make(chan struct{}, 1),
+		interfaces:     map[int]*ifaceContext{},
+		held:           map[string]*heldQuery{},
+		pending:        map[pendingKey]*pendingResponse{},
+		stats:          newStatsCollector(),
+		directory:      &interfaceDirectory{},
 	}
 
 	for _, opt := range options {
@@ -46,18 +83,32 @@ func New(
 		}
 	}
 
-	if r.iface == nil {
-		iface, err := internetInterface()
-		if err != nil {
-			return nil, err
-		}
-		r.iface = &iface
-	}
-
 	if r.logger == nil {
 		r.logger = twelf.DefaultLogger
 	}
 
+	if r.network == nil {
+		r.network = transport.SystemNetwork{}
+	}
+
+	if r.clock == nil {
+		r.clock = clock.System{}
+	}
+
+	if r.rand == nil {
+		r.rand = rand.New(rand.NewSource(r.clock.Now().UnixNano()))
+	}
+
+	if r.host != nil {
+		// the host's addresses are those of the responder's interfaces
+		r.host.network = r.network
+		r.answerer = UnionAnswerer{r.host, r.answerer}
+	}
+
+	if n, ok := r.answerer.(Notifier); ok {
+		n.Notify(r.notify)
+	}
+
 	return r, nil
 }
 
@@ -74,47 +125,92 @@ func (r *Responder) execute(ctx context.Context, c command) error {
 }
 
 // schedule executes a server command at some point in the future.
+//
+// The timer is started before schedule() returns, rather than by the goroutine
+// that waits for it, so that a fake clock can be advanced as soon as the
+// command that scheduled c is complete.
 func (r *Responder) schedule(ctx context.Context, d time.Duration, c command) {
+	t := r.clock.NewTimer(d)
+
 	go func() {
-		if err := sleep(ctx, d); err == nil {
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-t.C():
 			r.execute(ctx, c)
 		}
 	}()
 }
 
 // Run response to mDNS messages until ctx is canceled or an error occurs.
+//
+// When ctx is canceled, the responder sends "goodbye" packets for all of its
+// published records before Run returns.
 func (r *Responder) Run(ctx context.Context) error {
-	if r.disableIPv4 && r.disableIPv6 {
+	if r.disableIPv4 && r.disableIPv6 && len(r.custom) == 0 {
 		return errors.New("both IPv4 and IPv6 are disabled")
 	}
 
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
+	custom := r.custom
+	if len(custom) == 0 {
+		if !r.disableIPv4 {
+			custom = append(custom, &transport.IPv4Transport{
+				Logger: r.logger,
+				Clock:  r.clock,
+			})
+		}
+
+		if !r.disableIPv6 {
+			custom = append(custom, &transport.IPv6Transport{
+				Logger: r.logger,
+				Clock:  r.clock,
+			})
+		}
+	}
+
+	for _, t := range custom {
+		r.transports = append(r.transports, &instrumentedTransport{t, r})
+	}
 
-	g, ctx := errgroup.WithContext(ctx)
+	// The transports and the main loop use their own context, which is not
+	// canceled until the main loop has shutdown gracefully after ctx is
+	// canceled.
+	g, gctx := errgroup.WithContext(context.Background())
 
-	if !r.disableIPv4 {
-		t := &transport.IPv4Transport{
-			Logger: r.logger,
+	for _, t := range r.transports {
+		if err := t.Listen(); err != nil {
+			return err
 		}
+		defer t.Close()
 
+		t := t // capture loop variable
 		g.Go(func() error {
-			return r.receive(ctx, t)
+			return r.receive(gctx, t)
 		})
 	}
 
-	if !r.disableIPv6 {
-		t := &transport.IPv6Transport{
-			Logger: r.logger,
-		}
+	for i := 0; i < r.workers; i++ {
+		g.Go(func() error {
+			return r.work(gctx)
+		})
+	}
 
+	// the kernel only notifies the responder of changes to the host's real
+	// interfaces, which are irrelevant to any other network
+	if _, ok := r.network.(transport.SystemNetwork); ok {
 		g.Go(func() error {
-			return r.receive(ctx, t)
+			if err := watchAddresses(gctx, r.notifyAddressChange); err != nil && gctx.Err() == nil {
+				// address changes are still detected by polling
+				r.logger.Log("unable to watch for network address changes: %s", err)
+			}
+
+			return nil
 		})
 	}
 
 	g.Go(func() error {
-		return r.run(ctx)
+		return r.run(gctx, ctx)
 	})
 
 	err := g.Wait()
@@ -127,39 +223,62 @@ func (r *Responder) Run(ctx context.Context) error {
 }
 
 // run is the server's main loop.
-func (r *Responder) run(ctx context.Context) error {
+//
+// Commands are executed using ctx. When parent is canceled the responder sends
+// goodbye packets for its records before returning parent's error.
+func (r *Responder) run(ctx, parent context.Context) error {
 	defer close(r.done)
 
-	// When ready to send its Multicast DNS probe packet(s) the host should
-	// first wait for a short random delay time, uniformly distributed in
-	// the range 0-250 ms.  This random delay is to guard against the case
-	// where several devices are powered on simultaneously, or several
-	// devices are connected to an Ethernet hub, which is then powered on,
-	// or some other external event happens that might cause a group of
-	// hosts to all send synchronized probes.
-	if err := sleep(ctx, randT(250*time.Millisecond)); err != nil {
-		return err
-	}
+	r.refreshInterfaces(ctx)
+
+	ticker := r.clock.NewTicker(interfacePollInterval)
+	defer ticker.Stop()
 
 	for {
 		select {
+		case <-parent.Done():
+			r.shutdown()
+			return parent.Err()
 		case <-ctx.Done():
 			return ctx.Err()
 		case c := <-r.commands:
 			if err := c.Execute(ctx, r); err != nil {
 				return err
 			}
+		case <-ticker.C():
+			r.refreshInterfaces(ctx)
+		case <-r.addressChanged:
+			r.refreshInterfaces(ctx)
+		case <-r.changed:
+			for _, ifc := range r.interfaces {
+				r.publish(ctx, ifc)
+			}
 		}
 	}
 }
 
-// receive pipes packets received from t to s.packets
-func (r *Responder) receive(ctx context.Context, t transport.Transport) error {
-	if err := t.Listen(r.iface); err != nil {
-		return err
+// multicast sends m to the multicast group of each transport on ifc.
+//
+// It attempts to send via every transport, even if an earlier transport fails,
+// and returns the first error that occurred.
+func (r *Responder) multicast(ifc *ifaceContext, m *dns.Msg) error {
+	var firstErr error
+
+	for _, t := range ifc.Transports {
+		if _, err := transport.SendMulticast(t, &ifc.Interface, m); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	if m.Response {
+		ifc.History.Add(m, r.now())
 	}
-	defer t.Close()
 
+	return firstErr
+}
+
+// receive pipes packets received from t to s.packets
+func (r *Responder) receive(ctx context.Context, t transport.Transport) error {
 	go func() {
 		<-ctx.Done()
 		_ = t.Close() // break out of t.Read() when the context is canceled
@@ -182,42 +301,15 @@ func (r *Responder) receive(ctx context.Context, t transport.Transport) error {
 		m, err := in.Message()
 		if err != nil {
 			r.logger.Log("error parsing mDNS message: %s", err)
+			r.stats.add(&r.stats.parseErrors, 1)
+			in.Close()
 			continue
 		}
 
-		if m.Truncated {
-			// https://tools.ietf.org/html/rfc6762#section-18.5
-			//
-			// In query messages, if the TC bit is set, it means that additional
-			// Known-Answer records may be following shortly. A responder SHOULD
-			// record this fact, and wait for those additional Known-Answer
-			// records, before deciding whether to respond. If the TC bit is
-			// clear, it means that the querying host has no additional Known
-			// Answers.
-			//
-			// We attempt to serve the request anyway, without many guarantees
-			// as to the validity of the message. We also do not currently
-			// support the behavior specified above.
-			//
-			// Because our DNS responder will not be the only multicast
-			// responder on the machine (ie the host OS provides its own) this
-			// may not even be possible to implement correctly. See
-			// https://tools.ietf.org/html/rfc6762#section-15.2 for more
-			// information.
-			r.logger.DebugString("received mDNS message with non-zero TC flag")
-		}
-
-		var c command
-		if m.Response {
-			c = &handleResponse{in, m}
-		} else {
-			c = &handleQuery{in, m}
-		}
-
 		select {
 		case <-ctx.Done():
 			return ctx.Err()
-		case r.commands <- c:
+		case r.commands <- &handlePacket{in, m}:
 		}
 	}
 }
@@ -2,7 +2,9 @@ package responder
 
 import (
 	"context"
+	"net"
 
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
 	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
 	"github.com/miekg/dns"
 )
@@ -15,7 +17,145 @@ type handleResponse struct {
 
 func (c *handleResponse) Execute(ctx context.Context, r *Responder) error {
 	defer c.Packet.Close()
-	// TODO(jmalloc): we need to "defend" our records here
-	// https://tools.ietf.org/html/rfc6762#section-9
+
+	ifc, ok := r.lookupInterface(c.Packet)
+	if !ok {
+		return nil
+	}
+
+	for k, theirs := range recordsByName(responseRecords(c.Message)) {
+		n, ok := ifc.Names[k]
+		if !ok {
+			continue
+		}
+
+		switch n.State {
+		case stateProbing:
+			// https://tools.ietf.org/html/rfc6762#section-8.1
+			//
+			// If, at any time during probing, a Multicast DNS response is
+			// received containing a record with the same name as one being
+			// probed, then there is a conflict. Responses containing records
+			// that are identical to those being probed are not considered
+			// conflicting.
+			for _, rr := range theirs {
+				if !containsRecord(n.Records, rr) {
+					r.conflict(ctx, ifc, n, c.Packet.Source.Address)
+					break
+				}
+			}
+
+		case stateEstablished:
+			r.defend(ctx, ifc, n, theirs, c.Packet.Source.Address)
+		}
+	}
+
 	return nil
 }
+
+// defend checks the records of an established name against records with the
+// same name received on ifc in a response from another responder.
+//
+// If the other responder's records win the lexicographical comparison, the
+// name is considered conflicted; otherwise, the responder "defends" its name
+// by immediately multicasting its own records.
+//
+// See https://tools.ietf.org/html/rfc6762#section-9.
+func (r *Responder) defend(
+	ctx context.Context,
+	ifc *ifaceContext,
+	n *uniqueName,
+	theirs []dns.RR,
+	src *net.UDPAddr,
+) {
+	for t, records := range recordsByType(theirs) {
+		ours := recordsOfType(n.Records, t)
+		if len(ours) == 0 {
+			continue
+		}
+
+		conflicting := false
+		for _, rr := range records {
+			// records with a zero TTL are "goodbye" records, they do not
+			// conflict because the other responder is withdrawing them.
+			if rr.Header().Ttl != 0 && !containsRecord(ours, rr) {
+				conflicting = true
+				break
+			}
+		}
+
+		if !conflicting {
+			continue
+		}
+
+		if mdns.CompareRecordSets(ours, records) <= 0 {
+			r.conflict(ctx, ifc, n, src)
+			return
+		}
+
+		r.logger.Debug(
+			"defending '%s' on %s against conflicting mDNS response from %s",
+			n.Name,
+			ifc.Interface.Name,
+			src,
+		)
+
+		m := mdns.NewUnsolicitedResponse()
+		m.Answer = appendUnique(m.Answer, n.Records)
+
+		if err := r.multicast(ifc, m); err != nil {
+			r.logger.Log("error defending '%s': %s", n.Name, err)
+		}
+
+		return
+	}
+}
+
+// recordsByName returns a map of canonical name to the records in records with
+// that name.
+func recordsByName(records []dns.RR) map[string][]dns.RR {
+	result := map[string][]dns.RR{}
+
+	for _, rr := range records {
+		k := canonicalName(rr.Header().Name)
+		result[k] = append(result[k], rr)
+	}
+
+	return result
+}
+
+// recordsByType returns a map of record type to the records in records with
+// that type.
+func recordsByType(records []dns.RR) map[uint16][]dns.RR {
+	result := map[uint16][]dns.RR{}
+
+	for _, rr := range records {
+		t := rr.Header().Rrtype
+		result[t] = append(result[t], rr)
+	}
+
+	return result
+}
+
+// recordsOfType returns the records in records with the type t.
+func recordsOfType(records []dns.RR, t uint16) []dns.RR {
+	var result []dns.RR
+
+	for _, rr := range records {
+		if rr.Header().Rrtype == t {
+			result = append(result, rr)
+		}
+	}
+
+	return result
+}
+
+// responseRecords returns all of the records in the answer, authority and
+// additional sections of m.
+func responseRecords(m *dns.Msg) []dns.RR {
+	records := make([]dns.RR, 0, len(m.Answer)+len(m.Ns)+len(m.Extra))
+	records = append(records, m.Answer...)
+	records = append(records, m.Ns...)
+	records = append(records, m.Extra...)
+	return records
+}
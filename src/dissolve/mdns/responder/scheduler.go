@@ -0,0 +1,157 @@
+package responder
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+)
+
+const (
+	// minSharedDelay and maxSharedDelay are the bounds of the random time that
+	// the responder waits before sending a multicast response that contains
+	// shared records.
+	minSharedDelay = 20 * time.Millisecond
+	maxSharedDelay = 120 * time.Millisecond
+)
+
+// pendingResponse is a multicast response that is waiting to be sent.
+//
+// Answers to several queries received on the same interface and transport
+// before the response is sent are aggregated into a single message.
+type pendingResponse struct {
+	Transport transport.Transport
+	Interface int
+	Message   *dns.Msg
+}
+
+// pendingKey identifies the pending response for a transport and interface.
+type pendingKey struct {
+	Transport transport.Transport
+	Interface int
+}
+
+// sendPending is a command that sends a pending multicast response.
+type sendPending struct {
+	Key     pendingKey
+	Pending *pendingResponse
+}
+
+func (c *sendPending) Execute(ctx context.Context, r *Responder) error {
+	if p, ok := r.pending[c.Key]; ok && p == c.Pending {
+		delete(r.pending, c.Key)
+		r.sendPending(p)
+	}
+
+	return nil
+}
+
+// deferMulticast schedules m to be sent to the multicast group of the
+// transport that received in, after a random delay.
+//
+// If there is already a response pending for the same interface and
+// transport, the records in m are merged into that response instead.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.
+func (r *Responder) deferMulticast(ctx context.Context, in *transport.InboundPacket, m *dns.Msg) {
+	k := pendingKey{in.Transport, in.Source.InterfaceIndex}
+
+	if p, ok := r.pending[k]; ok {
+		mergeResponse(p.Message, m)
+		return
+	}
+
+	p := &pendingResponse{
+		Transport: in.Transport,
+		Interface: in.Source.InterfaceIndex,
+		Message:   mdns.NewUnsolicitedResponse(),
+	}
+
+	mergeResponse(p.Message, m)
+	r.pending[k] = p
+
+	// In any case where there may be multiple responses, such as queries
+	// where the answer is a member of a shared resource record set, each
+	// responder SHOULD delay its response by a random amount of time
+	// selected with uniform random distribution in the range 20-120 ms.
+	r.schedule(
+		ctx,
+		r.randTBetween(minSharedDelay, maxSharedDelay),
+		&sendPending{k, p},
+	)
+}
+
+// flushPending sends all pending multicast responses immediately.
+func (r *Responder) flushPending() {
+	for k, p := range r.pending {
+		delete(r.pending, k)
+		r.sendPending(p)
+	}
+}
+
+// sendPending sends a pending multicast response.
+func (r *Responder) sendPending(p *pendingResponse) {
+	ifc, ok := r.interfaces[p.Interface]
+	if !ok {
+		return // the interface has been removed in the meantime
+	}
+
+	sent, err := transport.Send(
+		p.Transport,
+		transport.Endpoint{
+			InterfaceIndex: p.Interface,
+			Address:        p.Transport.Group(),
+		},
+		p.Message,
+	)
+	if err != nil {
+		r.logger.Log("error sending mDNS response: %s", err)
+	} else if sent {
+		ifc.History.Add(p.Message, r.now())
+	}
+}
+
+// mergeResponse adds the records from m to target, excluding any records that
+// are already present.
+func mergeResponse(target, m *dns.Msg) {
+	target.Answer = mergeRecords(target.Answer, m.Answer)
+	target.Ns = mergeRecords(target.Ns, m.Ns)
+	target.Extra = mergeRecords(target.Extra, m.Extra)
+
+	// any record that has been added to the answer section need not also
+	// appear in the additional section
+	var extra []dns.RR
+	for _, rr := range target.Extra {
+		if !containsSameRecord(target.Answer, rr) {
+			extra = append(extra, rr)
+		}
+	}
+
+	target.Extra = extra
+}
+
+// mergeRecords appends each record in source to target, unless target already
+// contains the same record.
+func mergeRecords(target, source []dns.RR) []dns.RR {
+	for _, rr := range source {
+		if !containsSameRecord(target, rr) {
+			target = append(target, rr)
+		}
+	}
+
+	return target
+}
+
+// containsSameRecord returns true if records contains a record with the same
+// name, class, type and rdata as rr.
+func containsSameRecord(records []dns.RR, rr dns.RR) bool {
+	for _, x := range records {
+		if isSameRecord(x, rr) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,90 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder aggregation of shared responses", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+				[]dns.RR{
+					rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+					rr("_services._dns-sd._udp.local. 4500 IN PTR _http._tcp.local."),
+				},
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("merges the answers to each query received before the response is sent", func() {
+		q.Query(question("_http._tcp.local.", dns.TypePTR))
+		r.HandledQuery()
+
+		q.Query(question("_services._dns-sd._udp.local.", dns.TypePTR))
+		r.HandledQuery()
+
+		network.Advance(19 * time.Millisecond)
+		q.ExpectNothing()
+		network.Advance(1 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+			sameRecord("_services._dns-sd._udp.local. 4500 IN PTR _http._tcp.local."),
+		))
+
+		network.Advance(1 * time.Second)
+		q.ExpectNothing()
+	})
+
+	It("includes each record only once", func() {
+		q.Query(question("_http._tcp.local.", dns.TypePTR))
+		r.HandledQuery()
+
+		q.Query(question("_http._tcp.local.", dns.TypePTR))
+		r.HandledQuery()
+
+		network.Advance(20 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+		))
+	})
+
+	It("delays unique records that are sent in the same response as shared records", func() {
+		q.Query(
+			question("host.local.", dns.TypeA),
+			question("_http._tcp.local.", dns.TypePTR),
+		)
+		r.HandledQuery()
+		q.ExpectNothing()
+
+		network.Advance(20 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(
+			sameRecord("host.local. 120 IN A 192.168.1.10"),
+			sameRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local."),
+		))
+	})
+})
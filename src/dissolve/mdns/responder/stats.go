@@ -0,0 +1,281 @@
+package responder
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+)
+
+// latencyBuckets are the upper bounds of the buckets in answerer latency
+// histograms.
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	1 * time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	1 * time.Second,
+}
+
+// Stats is a point-in-time snapshot of the responder's statistics.
+type Stats struct {
+	// PacketsReceived is the number of packets received, per transport and
+	// interface.
+	PacketsReceived []PacketCount
+
+	// PacketsSent is the number of packets sent, per transport and interface.
+	PacketsSent []PacketCount
+
+	// Queries is the number of questions received, keyed by the question
+	// type, such as "A" or "PTR".
+	Queries map[string]uint64
+
+	// Answers is the number of records produced by each answerer, keyed by
+	// the answerer's name.
+	Answers map[string]uint64
+
+	// AnswerLatency is a histogram of the time taken by each answerer to
+	// answer a question, keyed by the answerer's name.
+	AnswerLatency map[string]Histogram
+
+	// SuppressedAnswers is the number of records that were omitted from
+	// responses because the querier already knew them.
+	SuppressedAnswers uint64
+
+	// ParseErrors is the number of packets that could not be parsed as DNS
+	// messages.
+	ParseErrors uint64
+
+	// DroppedPackets is the number of packets that were ignored because they
+	// were received on an interface that the responder does not serve, or did
+	// not originate on the local link.
+	DroppedPackets uint64
+
+	// Probes is the number of probe queries sent.
+	Probes uint64
+
+	// Conflicts is the number of conflicts detected.
+	Conflicts uint64
+
+	// Goodbyes is the number of records withdrawn using goodbye packets.
+	Goodbyes uint64
+}
+
+// PacketCount is the number of packets sent or received via a specific
+// transport and interface.
+type PacketCount struct {
+	// Transport is the name of the transport, either "ipv4" or "ipv6".
+	Transport string
+
+	// Interface is the name of the network interface.
+	Interface string
+
+	// Count is the number of packets.
+	Count uint64
+}
+
+// Histogram is a cumulative histogram of durations.
+type Histogram struct {
+	// Buckets is the cumulative number of observations that are less than or
+	// equal to each upper bound, in ascending order of upper bound.
+	Buckets []Bucket
+
+	// Count is the total number of observations.
+	Count uint64
+
+	// Sum is the sum of all observations.
+	Sum time.Duration
+}
+
+// Bucket is a single bucket within a Histogram.
+type Bucket struct {
+	UpperBound time.Duration
+	Count      uint64
+}
+
+// Stats returns a snapshot of the responder's statistics.
+//
+// It may be called at any time, from any goroutine.
+func (r *Responder) Stats() Stats {
+	return r.stats.snapshot(r.directory)
+}
+
+// packetKey identifies a transport and interface.
+type packetKey struct {
+	Transport string
+	Interface int
+}
+
+// statsCollector accumulates the responder's statistics.
+type statsCollector struct {
+	m sync.Mutex
+
+	received    map[packetKey]uint64
+	sent        map[packetKey]uint64
+	queries     map[uint16]uint64
+	answers     map[string]uint64
+	latency     map[string]*Histogram
+	suppressed  uint64
+	parseErrors uint64
+	dropped     uint64
+	probes      uint64
+	conflicts   uint64
+	goodbyes    uint64
+}
+
+// newStatsCollector returns a new, empty statistics collector.
+func newStatsCollector() *statsCollector {
+	return &statsCollector{
+		received: map[packetKey]uint64{},
+		sent:     map[packetKey]uint64{},
+		queries:  map[uint16]uint64{},
+		answers:  map[string]uint64{},
+		latency:  map[string]*Histogram{},
+	}
+}
+
+// add increments a counter.
+func (s *statsCollector) add(counter *uint64, n int) {
+	s.m.Lock()
+	*counter += uint64(n)
+	s.m.Unlock()
+}
+
+// packet increments the packet count in m for the given transport and
+// interface.
+func (s *statsCollector) packet(m map[packetKey]uint64, t transport.Transport, iface int) {
+	k := packetKey{transportName(t), iface}
+
+	s.m.Lock()
+	m[k]++
+	s.m.Unlock()
+}
+
+// query records the receipt of a question.
+func (s *statsCollector) query(q dns.Question) {
+	s.m.Lock()
+	s.queries[q.Qtype]++
+	s.m.Unlock()
+}
+
+// answered records the number of records produced by an answerer, and the time
+// that it took to produce them.
+func (s *statsCollector) answered(answerer string, n int, d time.Duration) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.answers[answerer] += uint64(n)
+
+	h, ok := s.latency[answerer]
+	if !ok {
+		h = &Histogram{
+			Buckets: make([]Bucket, len(latencyBuckets)),
+		}
+
+		for i, b := range latencyBuckets {
+			h.Buckets[i].UpperBound = b
+		}
+
+		s.latency[answerer] = h
+	}
+
+	h.Count++
+	h.Sum += d
+
+	for i := range h.Buckets {
+		if d <= h.Buckets[i].UpperBound {
+			h.Buckets[i].Count++
+		}
+	}
+}
+
+// snapshot returns a copy of the current statistics, using d to label the
+// interfaces.
+func (s *statsCollector) snapshot(d *interfaceDirectory) Stats {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	st := Stats{
+		PacketsReceived:   packetCounts(s.received, d),
+		PacketsSent:       packetCounts(s.sent, d),
+		Queries:           map[string]uint64{},
+		Answers:           map[string]uint64{},
+		AnswerLatency:     map[string]Histogram{},
+		SuppressedAnswers: s.suppressed,
+		ParseErrors:       s.parseErrors,
+		DroppedPackets:    s.dropped,
+		Probes:            s.probes,
+		Conflicts:         s.conflicts,
+		Goodbyes:          s.goodbyes,
+	}
+
+	for t, n := range s.queries {
+		st.Queries[dns.Type(t).String()] = n
+	}
+
+	for a, n := range s.answers {
+		st.Answers[a] = n
+	}
+
+	for a, h := range s.latency {
+		x := *h
+		x.Buckets = append([]Bucket(nil), h.Buckets...)
+		st.AnswerLatency[a] = x
+	}
+
+	return st
+}
+
+// packetCounts converts a map of packet counts to a sorted slice, using d to
+// label the interfaces.
+func packetCounts(m map[packetKey]uint64, d *interfaceDirectory) []PacketCount {
+	result := make([]PacketCount, 0, len(m))
+
+	for k, n := range m {
+		name := d.lookup(k.Interface).Name
+		if name == "" {
+			name = strconv.Itoa(k.Interface)
+		}
+
+		result = append(result, PacketCount{k.Transport, name, n})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Transport != result[j].Transport {
+			return result[i].Transport < result[j].Transport
+		}
+
+		return result[i].Interface < result[j].Interface
+	})
+
+	return result
+}
+
+// transportName returns a short name for t, for use in statistics.
+func transportName(t transport.Transport) string {
+	if t.Group().IP.To4() != nil {
+		return "ipv4"
+	}
+
+	return "ipv6"
+}
+
+// answererName returns the name used to identify an answerer in statistics.
+//
+// Answerers that implement fmt.Stringer are identified by their string
+// representation, others are identified by their type.
+func answererName(an Answerer) string {
+	if s, ok := an.(fmt.Stringer); ok {
+		return s.String()
+	}
+
+	return fmt.Sprintf("%T", an)
+}
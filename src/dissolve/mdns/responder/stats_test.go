@@ -0,0 +1,118 @@
+package responder_test
+
+import (
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder statistics", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		r        *testResponder
+		q        *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		answerer = newTestAnswerer(
+			[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+			[]dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")},
+		)
+		r = network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("counts the probes and packets sent while publishing", func() {
+		st := r.Stats()
+		Expect(st.Probes).To(BeEquivalentTo(3))
+
+		// three probes and two announcements
+		Expect(st.PacketsSent).To(ConsistOf(
+			PacketCount{Transport: "ipv4", Interface: "eth0", Count: 5},
+		))
+	})
+
+	It("counts the packets received, and the questions in them by type", func() {
+		q.Query(
+			question("host.local.", dns.TypeA),
+			question("_http._tcp.local.", dns.TypePTR),
+		)
+		r.HandledQuery()
+
+		st := r.Stats()
+		Expect(st.PacketsReceived).To(ConsistOf(
+			PacketCount{Transport: "ipv4", Interface: "eth0", Count: 1},
+		))
+		Expect(st.Queries).To(Equal(map[string]uint64{"A": 1, "PTR": 1}))
+	})
+
+	It("counts the records produced by each answerer, and the time taken to produce them", func() {
+		q.Query(question("host.local.", dns.TypeA))
+		r.HandledQuery()
+
+		st := r.Stats()
+		Expect(st.Answers).To(HaveKeyWithValue("*responder_test.testAnswerer", BeEquivalentTo(1)))
+		Expect(st.AnswerLatency).To(HaveKey("*responder_test.testAnswerer"))
+
+		h := st.AnswerLatency["*responder_test.testAnswerer"]
+		Expect(h.Count).To(BeEquivalentTo(1))
+		Expect(h.Buckets).NotTo(BeEmpty())
+		Expect(h.Buckets[len(h.Buckets)-1].Count).To(BeEquivalentTo(1))
+	})
+
+	It("counts the answers that are suppressed because the querier already knows them", func() {
+		m := mdns.NewQuery(false, question("_http._tcp.local.", dns.TypePTR))
+		m.Answer = append(m.Answer, rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local."))
+		q.Send(m)
+		r.HandledQuery()
+
+		Expect(r.Stats().SuppressedAnswers).To(BeEquivalentTo(1))
+	})
+
+	It("counts the packets that can not be parsed", func() {
+		iface := q.Interface.Interface()
+		err := q.Transport.Write(&transport.OutboundPacket{
+			Destination: transport.Endpoint{
+				InterfaceIndex: iface.Index,
+				Address:        q.Transport.Group(),
+			},
+			Data: []byte{1, 2, 3},
+		})
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Eventually(func() uint64 {
+			return r.Stats().ParseErrors
+		}).Should(BeEquivalentTo(1))
+	})
+
+	It("counts conflicts", func() {
+		m := mdns.NewUnsolicitedResponse()
+		m.Answer = append(m.Answer, rr("host.local. 120 IN A 192.168.1.20"))
+		q.Send(m)
+
+		Eventually(func() uint64 {
+			return r.Stats().Conflicts
+		}).Should(BeEquivalentTo(1))
+	})
+
+	It("counts the records withdrawn using goodbye packets", func() {
+		answerer.Set(nil, nil)
+
+		m := q.Receive()
+		Expect(m.Answer).To(HaveLen(2))
+
+		Eventually(func() uint64 {
+			return r.Stats().Goodbyes
+		}).Should(BeEquivalentTo(2))
+	})
+})
@@ -2,34 +2,49 @@ package responder
 
 import (
 	"context"
-	"math/rand"
 	"time"
 )
 
+// now returns the current time, according to the responder's clock.
+func (r *Responder) now() time.Time {
+	return r.clock.Now()
+}
+
 // randT returns a random duraction between 0 and d, inclusive.
-func randT(d time.Duration) time.Duration {
-	return randTBetween(0, d)
+func (r *Responder) randT(d time.Duration) time.Duration {
+	return r.randTBetween(0, d)
 }
 
 // randTBetween returns a random duraction between min and max, inclusive.
-func randTBetween(min, max time.Duration) time.Duration {
+func (r *Responder) randTBetween(min, max time.Duration) time.Duration {
+	r.randM.Lock()
+	defer r.randM.Unlock()
+
 	return time.Duration(
-		rand.Int63n(
-			int64(max-min),
-		) + int64(max),
+		r.rand.Int63n(
+			int64(max-min)+1,
+		) + int64(min),
 	)
 }
 
-// sleep sleeps for a duration of d, or until ctx is canceled.
-// It runs nil if the sleep duration passes before ctx is canceled.
-func sleep(ctx context.Context, d time.Duration) error {
-	t := time.NewTimer(d)
-	defer t.Stop()
-
-	select {
-	case <-ctx.Done():
-		return ctx.Err()
-	case <-t.C:
-		return nil
-	}
+// withTimeout returns a context that is canceled when ctx is canceled, or when
+// d has elapsed according to the responder's clock, whichever comes first.
+func (r *Responder) withTimeout(
+	ctx context.Context,
+	d time.Duration,
+) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(ctx)
+	t := r.clock.NewTimer(d)
+
+	go func() {
+		defer t.Stop()
+
+		select {
+		case <-ctx.Done():
+		case <-t.C():
+			cancel()
+		}
+	}()
+
+	return ctx, cancel
 }
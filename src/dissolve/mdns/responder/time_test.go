@@ -0,0 +1,197 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder timing", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		q        *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		answerer = newTestAnswerer(
+			[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+			[]dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")},
+		)
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	It("waits for a random delay of up to 250ms before probing", func() {
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseRandSource(constantSource(100*time.Millisecond)),
+		)
+		r.Start()
+
+		Eventually(network.Clock.Next).Should(Equal(epoch.Add(100 * time.Millisecond)))
+		network.Clock.Advance(99 * time.Millisecond)
+		q.ExpectNothing()
+
+		network.Clock.Advance(1 * time.Millisecond)
+		m := q.Receive()
+		Expect(m.Response).To(BeFalse())
+	})
+
+	It("waits for a random delay of up to 250ms before probing names that are published later", func() {
+		shared := []dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")}
+		answerer.Set(nil, shared)
+
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseRandSource(constantSource(100*time.Millisecond)),
+		)
+		network.Establish(r, q)
+
+		now := network.Clock.Now()
+		answerer.Set([]dns.RR{rr("host.local. 120 IN A 192.168.1.10")}, shared)
+		Eventually(network.Clock.Next).Should(Equal(now.Add(100 * time.Millisecond)))
+
+		network.Advance(99 * time.Millisecond)
+		q.ExpectNothing()
+
+		network.Advance(1 * time.Millisecond)
+		m := q.Receive()
+		Expect(m.Response).To(BeFalse())
+		Expect(m.Question[0].Name).To(Equal("host.local."))
+	})
+
+	It("sends three probes 250ms apart, then announces the records twice, one second apart", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		for i := 0; i < 3; i++ {
+			if i > 0 {
+				network.Advance(249 * time.Millisecond)
+				q.ExpectNothing()
+				network.Advance(1 * time.Millisecond)
+			}
+
+			m := q.Receive()
+			Expect(m.Response).To(BeFalse())
+			Expect(m.Question).To(HaveLen(1))
+			Expect(m.Question[0].Name).To(Equal("host.local."))
+			Expect(m.Ns).To(HaveLen(1))
+		}
+
+		network.Advance(249 * time.Millisecond)
+		q.ExpectNothing()
+		network.Advance(1 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(HaveLen(2))
+
+		network.Advance(999 * time.Millisecond)
+		q.ExpectNothing()
+		network.Advance(1 * time.Millisecond)
+
+		m = q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(HaveLen(2))
+
+		network.Advance(10 * time.Second)
+		q.ExpectNothing()
+	})
+
+	It("only requests a unicast response in the first probe", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		r.Start()
+
+		network.Clock.BlockUntil(1)
+		network.Clock.Advance(0)
+
+		m := q.Receive()
+		unicast, _ := mdns.WantsUnicastResponse(m.Question[0])
+		Expect(unicast).To(BeTrue())
+
+		network.Advance(250 * time.Millisecond)
+
+		m = q.Receive()
+		unicast, _ = mdns.WantsUnicastResponse(m.Question[0])
+		Expect(unicast).To(BeFalse())
+	})
+
+	It("delays responses containing shared records by a random delay between 20ms and 120ms", func() {
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseRandSource(constantSource(50*time.Millisecond)),
+		)
+		network.Establish(r, q)
+
+		q.Query(question("_http._tcp.local.", dns.TypePTR))
+		r.HandledQuery()
+
+		network.Advance(69 * time.Millisecond)
+		q.ExpectNothing()
+		network.Advance(1 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(HaveLen(1))
+		Expect(m.Answer[0].Header().Rrtype).To(Equal(dns.TypePTR))
+	})
+
+	It("responds immediately if the response only contains unique records", func() {
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseRandSource(constantSource(50*time.Millisecond)),
+		)
+		network.Establish(r, q)
+
+		// the response is received without advancing the clock
+		q.Query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(HaveLen(1))
+	})
+
+	It("waits for a random delay between 400ms and 500ms for more known answers when the TC bit is set", func() {
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseRandSource(constantSource(50*time.Millisecond)),
+		)
+		network.Establish(r, q)
+
+		m := mdns.NewQuery(false, question("_http._tcp.local.", dns.TypePTR))
+		m.Truncated = true
+		q.Send(m)
+
+		// the query is held by the responder's main loop, so there is no
+		// event to wait for, instead wait for the timer that releases it to
+		// join the responder's interface polling ticker.
+		Eventually(network.Clock.Timers).Should(Equal(2))
+
+		network.Advance(449 * time.Millisecond)
+		q.ExpectNothing()
+		network.Advance(1 * time.Millisecond)
+
+		r.HandledQuery()
+
+		// the response contains a shared record, so is delayed further
+		network.Advance(70 * time.Millisecond)
+		Expect(q.Receive().Answer).To(HaveLen(1))
+	})
+})
@@ -0,0 +1,199 @@
+package responder
+
+import (
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+)
+
+// Tracer is an interface for observing the packets sent and received by a
+// responder, and the responses produced for each query.
+//
+// The events passed to a tracer must not be modified. The methods are called
+// synchronously, from any goroutine, and so must not block.
+type Tracer interface {
+	// TracePacket is called for each packet sent or received.
+	TracePacket(PacketEvent)
+
+	// TraceQuery is called after each query is handled, including those that
+	// produced no response.
+	TraceQuery(QueryEvent)
+}
+
+// Direction is the direction in which a packet travelled.
+type Direction int
+
+const (
+	// Inbound indicates a packet that was received by the responder.
+	Inbound Direction = iota
+
+	// Outbound indicates a packet that was sent by the responder.
+	Outbound
+)
+
+// String returns a human-readable representation of the direction.
+func (d Direction) String() string {
+	if d == Inbound {
+		return "inbound"
+	}
+
+	return "outbound"
+}
+
+// PacketEvent describes a packet sent or received by the responder.
+type PacketEvent struct {
+	// Time is the time at which the packet was sent or received.
+	Time time.Time
+
+	// Direction is the direction in which the packet travelled.
+	Direction Direction
+
+	// Interface is the index of the network interface on which the packet was
+	// sent or received. It is zero if the transport could not determine the
+	// interface on which an inbound packet was received.
+	Interface int
+
+	// InterfaceName is the name of the network interface. It is empty if the
+	// interface is not known to the responder.
+	InterfaceName string
+
+	// InterfaceAddrs is the set of unicast addresses assigned to the network
+	// interface, as of the last time the responder checked them.
+	InterfaceAddrs []net.Addr
+
+	// Transport is the name of the transport, either "ipv4" or "ipv6".
+	Transport string
+
+	// Source is the address of the host that sent an inbound packet. It is nil
+	// for outbound packets.
+	Source *net.UDPAddr
+
+	// Destination is the address to which the packet was sent. For inbound
+	// packets it is nil if the destination address is not known.
+	Destination *net.UDPAddr
+
+	// Legacy is true if the packet was sent by, or to, a legacy querier.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-6.7.
+	Legacy bool
+
+	// Data is the UDP payload of the packet.
+	Data []byte
+}
+
+// QueryEvent describes a query handled by the responder, and the responses
+// that were produced.
+type QueryEvent struct {
+	// Time is the time at which the query was handled.
+	Time time.Time
+
+	// Interface is the index of the network interface on which the query was
+	// received.
+	Interface int
+
+	// InterfaceName is the name of the network interface. It is empty if the
+	// interface is not known to the responder.
+	InterfaceName string
+
+	// Transport is the name of the transport, either "ipv4" or "ipv6".
+	Transport string
+
+	// Source is the address of the querier.
+	Source *net.UDPAddr
+
+	// Legacy is true if the querier is a legacy querier.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-6.7.
+	Legacy bool
+
+	// Query is the query message.
+	Query *dns.Msg
+
+	// Unicast is the response sent directly to the querier. It may be empty.
+	Unicast *dns.Msg
+
+	// Multicast is the response sent to the multicast group. It may be empty.
+	// Multicast responses that contain shared records are sent after a short
+	// delay, and may be merged with other responses before they are sent.
+	Multicast *dns.Msg
+}
+
+// SetTracer sets the tracer used to observe the responder's packets and
+// responses. A nil tracer disables tracing.
+//
+// It may be called at any time, from any goroutine.
+func (r *Responder) SetTracer(t Tracer) {
+	r.trace.Store(&t)
+}
+
+// tracer returns the current tracer, or nil if tracing is disabled.
+func (r *Responder) tracer() Tracer {
+	if t, ok := r.trace.Load().(*Tracer); ok {
+		return *t
+	}
+
+	return nil
+}
+
+// traceQuery sends a query event to the current tracer, if any.
+func (r *Responder) traceQuery(in *transport.InboundPacket, query, unicast, multicast *dns.Msg) {
+	t := r.tracer()
+	if t == nil {
+		return
+	}
+
+	t.TraceQuery(QueryEvent{
+		Time:          r.now(),
+		Interface:     in.Source.InterfaceIndex,
+		InterfaceName: r.directory.lookup(in.Source.InterfaceIndex).Name,
+		Transport:     transportName(in.Transport),
+		Source:        in.Source.Address,
+		Legacy:        in.Source.IsLegacy(),
+		Query:         query,
+		Unicast:       unicast,
+		Multicast:     multicast,
+	})
+}
+
+// newInboundPacketEvent returns an event describing an inbound packet received
+// at time t, on the interface described by d.
+func newInboundPacketEvent(in *transport.InboundPacket, t time.Time, d interfaceDescription) PacketEvent {
+	e := PacketEvent{
+		Time:           t,
+		Direction:      Inbound,
+		Interface:      in.Source.InterfaceIndex,
+		InterfaceName:  d.Name,
+		InterfaceAddrs: d.Addrs,
+		Transport:      transportName(in.Transport),
+		Source:         in.Source.Address,
+		Legacy:         in.Source.IsLegacy(),
+		Data:           append([]byte(nil), in.Data...),
+	}
+
+	if in.Destination != nil {
+		e.Destination = &net.UDPAddr{
+			IP:   in.Destination,
+			Port: transport.Port,
+		}
+	}
+
+	return e
+}
+
+// newOutboundPacketEvent returns an event describing a packet sent via tr at
+// time t, on the interface described by d.
+func newOutboundPacketEvent(tr transport.Transport, p *transport.OutboundPacket, t time.Time, d interfaceDescription) PacketEvent {
+	return PacketEvent{
+		Time:           t,
+		Direction:      Outbound,
+		Interface:      p.Destination.InterfaceIndex,
+		InterfaceName:  d.Name,
+		InterfaceAddrs: d.Addrs,
+		Transport:      transportName(tr),
+		Destination:    p.Destination.Address,
+		Legacy:         p.Destination.IsLegacy(),
+		Data:           append([]byte(nil), p.Data...),
+	}
+}
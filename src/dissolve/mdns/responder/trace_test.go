@@ -0,0 +1,199 @@
+package responder_test
+
+import (
+	"bytes"
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder tracing", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+				nil,
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// packets returns the packet events traced in the given direction.
+	packets := func(d Direction) []PacketEvent {
+		var result []PacketEvent
+
+		for _, e := range r.Tracer.Packets() {
+			if e.Direction == d {
+				result = append(result, e)
+			}
+		}
+
+		return result
+	}
+
+	It("traces each packet sent", func() {
+		events := packets(Outbound)
+
+		// three probes and two announcements
+		Expect(events).To(HaveLen(5))
+
+		e := events[0]
+		Expect(e.Time).To(BeTemporally("~", epoch, 250*time.Millisecond))
+		Expect(e.Interface).To(Equal(r.Interface.Interface().Index))
+		Expect(e.InterfaceName).To(Equal("eth0"))
+		Expect(e.InterfaceAddrs).To(ConsistOf(cidr("192.168.1.10/24")))
+		Expect(e.Transport).To(Equal("ipv4"))
+		Expect(e.Source).To(BeNil())
+		Expect(e.Destination).To(Equal(transport.IPv4GroupAddress))
+		Expect(e.Legacy).To(BeFalse())
+
+		m := &dns.Msg{}
+		Expect(m.Unpack(e.Data)).To(Succeed())
+		Expect(m.Question[0].Name).To(Equal("host.local."))
+	})
+
+	It("traces each packet received", func() {
+		query := mdns.NewQuery(false, question("host.local.", dns.TypeA))
+		q.Send(query)
+		r.HandledQuery()
+
+		events := packets(Inbound)
+		Expect(events).To(HaveLen(1))
+
+		e := events[0]
+		Expect(e.InterfaceName).To(Equal("eth0"))
+		Expect(e.Transport).To(Equal("ipv4"))
+		Expect(e.Source.IP.Equal(net.ParseIP("192.168.1.20"))).To(BeTrue())
+		Expect(e.Source.Port).To(Equal(transport.Port))
+		Expect(e.Legacy).To(BeFalse())
+
+		data, err := query.Pack()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(e.Data).To(Equal(data))
+	})
+
+	It("traces each query, along with its responses", func() {
+		q.Query(question("host.local.", dns.TypeA))
+
+		e := r.HandledQuery()
+		Expect(e.Interface).To(Equal(r.Interface.Interface().Index))
+		Expect(e.InterfaceName).To(Equal("eth0"))
+		Expect(e.Transport).To(Equal("ipv4"))
+		Expect(e.Source.IP.Equal(net.ParseIP("192.168.1.20"))).To(BeTrue())
+		Expect(e.Legacy).To(BeFalse())
+		Expect(e.Query.Question).To(ConsistOf(question("host.local.", dns.TypeA)))
+		Expect(e.Unicast.Answer).To(BeEmpty())
+		Expect(e.Multicast.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+
+	It("traces queries that produce no response", func() {
+		q.Query(question("other.local.", dns.TypeA))
+
+		e := r.HandledQuery()
+		Expect(e.Unicast.Answer).To(BeEmpty())
+		Expect(e.Multicast.Answer).To(BeEmpty())
+	})
+
+	It("marks the packets and queries of legacy queriers", func() {
+		legacy := network.NewQuerier("eth2", "192.168.1.30/24", 12345)
+		legacy.Query(question("host.local.", dns.TypeA))
+
+		Expect(r.HandledQuery().Legacy).To(BeTrue())
+		legacy.Receive()
+
+		for _, e := range r.Tracer.Packets()[5:] {
+			Expect(e.Legacy).To(BeTrue())
+		}
+	})
+
+	It("stops tracing when the tracer is removed", func() {
+		r.SetTracer(nil)
+
+		q.Query(question("host.local.", dns.TypeA))
+		q.Receive()
+
+		Expect(r.Tracer.Packets()).To(HaveLen(5))
+		Consistently(r.Tracer.Queries).ShouldNot(Receive())
+	})
+})
+
+var _ = Describe("TextTracer", func() {
+	var (
+		buf    *bytes.Buffer
+		tracer *TextTracer
+		event  QueryEvent
+	)
+
+	BeforeEach(func() {
+		buf = &bytes.Buffer{}
+		tracer = NewTextTracer(buf)
+
+		event = QueryEvent{
+			Time:      epoch,
+			Transport: "ipv4",
+			Source:    &net.UDPAddr{IP: net.ParseIP("192.168.1.20"), Port: transport.Port},
+			Query:     mdns.NewQuery(false, question("host.local.", dns.TypeA)),
+			Unicast:   &dns.Msg{},
+			Multicast: &dns.Msg{},
+		}
+	})
+
+	It("describes the query", func() {
+		tracer.TraceQuery(event)
+
+		Expect(buf.String()).To(ContainSubstring("QUERY FROM 192.168.1.20:5353 VIA ipv4\n"))
+		Expect(buf.String()).To(ContainSubstring(";host.local.\tIN\t A"))
+		Expect(buf.String()).NotTo(ContainSubstring("RESPONSE"))
+	})
+
+	It("describes the interface on which the query was received", func() {
+		event.InterfaceName = "eth0"
+		event.Legacy = true
+		tracer.TraceQuery(event)
+
+		Expect(buf.String()).To(ContainSubstring("QUERY FROM 192.168.1.20:5353 VIA ipv4 ON eth0 (legacy)\n"))
+	})
+
+	It("describes legacy queries", func() {
+		event.Legacy = true
+		tracer.TraceQuery(event)
+
+		Expect(buf.String()).To(ContainSubstring("VIA ipv4 (legacy)\n"))
+	})
+
+	It("describes the unicast and multicast responses", func() {
+		event.Unicast.Answer = []dns.RR{rr("host.local. 120 IN A 192.168.1.10")}
+		event.Multicast.Answer = []dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")}
+		tracer.TraceQuery(event)
+
+		s := buf.String()
+		Expect(s).To(ContainSubstring("UNICAST RESPONSE"))
+		Expect(s).To(ContainSubstring("MULTICAST RESPONSE"))
+		Expect(s).To(ContainSubstring("192.168.1.10"))
+		Expect(s).To(ContainSubstring("web._http._tcp.local."))
+	})
+
+	It("does not describe individual packets", func() {
+		tracer.TracePacket(PacketEvent{Data: []byte{1, 2, 3}})
+		Expect(buf.Len()).To(BeZero())
+	})
+})
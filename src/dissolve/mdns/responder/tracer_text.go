@@ -0,0 +1,62 @@
+package responder
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+)
+
+// TextTracer is a tracer that writes a human-readable description of each
+// query and its responses to a writer.
+//
+// It does not describe individual packets.
+type TextTracer struct {
+	m sync.Mutex
+	w io.Writer
+}
+
+// NewTextTracer returns a tracer that writes to w.
+func NewTextTracer(w io.Writer) *TextTracer {
+	return &TextTracer{w: w}
+}
+
+// TracePacket does nothing.
+func (t *TextTracer) TracePacket(PacketEvent) {}
+
+// TraceQuery writes a description of e to the writer.
+func (t *TextTracer) TraceQuery(e QueryEvent) {
+	var b strings.Builder
+
+	fmt.Fprintln(&b, strings.Repeat("-", 80))
+	fmt.Fprintln(&b, "")
+
+	fmt.Fprintf(&b, "QUERY FROM %s VIA %s", e.Source, e.Transport)
+	if e.InterfaceName != "" {
+		fmt.Fprintf(&b, " ON %s", e.InterfaceName)
+	}
+	if e.Legacy {
+		fmt.Fprintf(&b, " (legacy)")
+	}
+	fmt.Fprint(&b, "\n\n")
+	fmt.Fprintln(&b, indent(e.Query.String()))
+
+	if e.Unicast != nil && len(e.Unicast.Answer) > 0 {
+		fmt.Fprint(&b, "UNICAST RESPONSE\n\n")
+		fmt.Fprintln(&b, indent(e.Unicast.String()))
+	}
+
+	if e.Multicast != nil && len(e.Multicast.Answer) > 0 {
+		fmt.Fprint(&b, "MULTICAST RESPONSE\n\n")
+		fmt.Fprintln(&b, indent(e.Multicast.String()))
+	}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	io.WriteString(t.w, b.String())
+}
+
+func indent(s string) string {
+	return "\t" + strings.Replace(s, "\n", "\n\t", -1)
+}
@@ -0,0 +1,124 @@
+package responder
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+)
+
+const (
+	// minTruncatedDelay and maxTruncatedDelay are the bounds of the random
+	// time that the responder waits for additional known-answer packets after
+	// receiving a query with the TC bit set.
+	minTruncatedDelay = 400 * time.Millisecond
+	maxTruncatedDelay = 500 * time.Millisecond
+)
+
+// heldQuery is a query with the TC bit set that is being held while the
+// responder waits for additional known-answer packets from the same querier.
+//
+// See https://tools.ietf.org/html/rfc6762#section-7.2.
+type heldQuery struct {
+	Query   *handleQuery
+	release *releaseQuery
+}
+
+// releaseQuery is a command that answers a held query once the responder has
+// finished waiting for additional known-answer packets.
+type releaseQuery struct {
+	Key  string
+	Held *heldQuery
+}
+
+func (c *releaseQuery) Execute(ctx context.Context, r *Responder) error {
+	if h, ok := r.held[c.Key]; ok && h == c.Held && h.release == c {
+		r.release(ctx, c.Key, h)
+	}
+
+	return nil
+}
+
+// holdKey returns the key used to identify queries held on behalf of the
+// querier that sent p.
+func holdKey(p *transport.InboundPacket) string {
+	return fmt.Sprintf(
+		"%d/%s",
+		p.Source.InterfaceIndex,
+		p.Source.Address,
+	)
+}
+
+// hold handles queries that span multiple packets.
+//
+// If c has the TC bit set, it is held until all of the known-answer packets
+// that follow it have been received. If c is itself a continuation of a held
+// query, its known-answers are merged into the held query.
+//
+// It returns true if c has been handled, in which case it must not be answered
+// immediately.
+func (r *Responder) hold(ctx context.Context, c *handleQuery) bool {
+	k := holdKey(c.Packet)
+
+	if h, ok := r.held[k]; ok {
+		// In the case of a query with the TC bit set, the querier sends the
+		// remaining known-answer records in subsequent packets that contain
+		// no questions.
+		if len(c.Message.Question) == 0 {
+			h.Query.Message.Answer = append(
+				h.Query.Message.Answer,
+				c.Message.Answer...,
+			)
+			c.Packet.Close()
+
+			// if the TC bit is set on this packet too, there are still more
+			// known-answers to come
+			if c.Message.Truncated {
+				r.scheduleRelease(ctx, k, h)
+			}
+
+			return true
+		}
+
+		// the querier has moved on to a new query, answer the held one
+		// without waiting any further
+		r.release(ctx, k, h)
+	}
+
+	if !c.Message.Truncated || len(c.Message.Question) == 0 {
+		return false
+	}
+
+	// https://tools.ietf.org/html/rfc6762#section-7.2
+	//
+	// If the TC bit is set, then the responder SHOULD delay its response
+	// by a random amount in the range 400-500 ms, to allow time for the
+	// subsequent known-answer packets to arrive.
+	h := &heldQuery{Query: c}
+	r.held[k] = h
+	r.scheduleRelease(ctx, k, h)
+
+	return true
+}
+
+// scheduleRelease schedules the held query h to be answered after a random
+// delay, replacing any release that is already scheduled.
+func (r *Responder) scheduleRelease(ctx context.Context, k string, h *heldQuery) {
+	h.release = &releaseQuery{k, h}
+	r.schedule(
+		ctx,
+		r.randTBetween(minTruncatedDelay, maxTruncatedDelay),
+		h.release,
+	)
+}
+
+// release stops holding h and answers it.
+func (r *Responder) release(ctx context.Context, k string, h *heldQuery) {
+	delete(r.held, k)
+	h.release = nil
+
+	if err := h.Query.query(ctx, r); err != nil {
+		r.logger.Log("error handling mDNS query: %s", err)
+	}
+}
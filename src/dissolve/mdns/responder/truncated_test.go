@@ -0,0 +1,115 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder handling of truncated queries", func() {
+	var (
+		network *testNetwork
+		r       *testResponder
+		q       *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		r = network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			newTestAnswerer(
+				[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+				[]dns.RR{
+					rr("_http._tcp.local. 4500 IN PTR a._http._tcp.local."),
+					rr("_http._tcp.local. 4500 IN PTR b._http._tcp.local."),
+				},
+			),
+		)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// send sends a query with the given questions and known answers, and the TC
+	// bit set to tc.
+	send := func(tc bool, questions []dns.Question, known ...string) {
+		m := mdns.NewQuery(false, questions...)
+		m.Truncated = tc
+
+		for _, s := range known {
+			m.Answer = append(m.Answer, rr(s))
+		}
+
+		q.Send(m)
+	}
+
+	// browse is the question sent by a querier browsing for HTTP services.
+	browse := []dns.Question{question("_http._tcp.local.", dns.TypePTR)}
+
+	It("merges the known answers from the packets that follow a truncated query", func() {
+		send(true, browse, "_http._tcp.local. 4500 IN PTR a._http._tcp.local.")
+
+		// the interface polling ticker, and the timer that releases the held
+		// query
+		Eventually(network.Clock.Timers).Should(Equal(2))
+		network.Advance(100 * time.Millisecond)
+
+		// the continuation has the TC bit set too, so the responder waits for
+		// another 400ms from this point
+		send(true, nil, "_http._tcp.local. 4500 IN PTR b._http._tcp.local.")
+		Eventually(network.Clock.Timers).Should(Equal(3))
+
+		network.Advance(399 * time.Millisecond)
+		Consistently(r.Tracer.Queries).ShouldNot(Receive())
+		network.Advance(1 * time.Millisecond)
+
+		e := r.HandledQuery()
+		Expect(e.Query.Answer).To(HaveLen(2))
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		network.Advance(1 * time.Second)
+		q.ExpectNothing()
+	})
+
+	It("answers the held query without the continuation if it does not arrive in time", func() {
+		send(true, browse, "_http._tcp.local. 4500 IN PTR a._http._tcp.local.")
+		Eventually(network.Clock.Timers).Should(Equal(2))
+
+		network.Advance(400 * time.Millisecond)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(ConsistOf(
+			sameRecord("_http._tcp.local. 4500 IN PTR b._http._tcp.local."),
+		))
+	})
+
+	It("answers the held query immediately if the querier sends a new query", func() {
+		send(true, browse, "_http._tcp.local. 4500 IN PTR a._http._tcp.local.")
+		Eventually(network.Clock.Timers).Should(Equal(2))
+
+		send(false, []dns.Question{question("host.local.", dns.TypeA)})
+
+		// the queries are answered concurrently, so the events may occur in
+		// either order
+		var answered []string
+		for i := 0; i < 2; i++ {
+			e := r.HandledQuery()
+			answered = append(answered, e.Query.Question[0].Name)
+		}
+
+		Expect(answered).To(ConsistOf("_http._tcp.local.", "host.local."))
+	})
+
+	It("does not hold queries without the TC bit", func() {
+		send(false, browse)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(HaveLen(2))
+	})
+})
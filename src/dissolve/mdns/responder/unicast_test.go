@@ -0,0 +1,110 @@
+package responder_test
+
+import (
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder handling of unicast-response questions", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		r        *testResponder
+		q        *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		answerer = newTestAnswerer(
+			[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+			[]dns.RR{rr("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")},
+		)
+		r = network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// query sends a query with the unicast-response bit set on each question.
+	query := func(questions ...dns.Question) {
+		for i := range questions {
+			questions[i] = mdns.SetUnicastResponse(questions[i])
+		}
+
+		q.Query(questions...)
+	}
+
+	It("responds via unicast if the records were multicast within a quarter of their TTL", func() {
+		// the records were last multicast one second before Establish()
+		// returned
+		network.Advance(29 * time.Second)
+
+		query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Multicast).To(BeFalse())
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(BeEmpty())
+
+		network.Advance(1 * time.Second)
+		q.ExpectNothing()
+	})
+
+	It("responds via multicast if the records have not been multicast within a quarter of their TTL", func() {
+		network.Advance(29*time.Second + 1*time.Millisecond)
+
+		query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Multicast).To(BeTrue())
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+
+		e := r.HandledQuery()
+		Expect(e.Unicast.Answer).To(BeEmpty())
+	})
+
+	It("chooses how to respond to each question separately", func() {
+		// a quarter of the TTL of the A record has passed, but not of the PTR
+		// record
+		network.Advance(30 * time.Second)
+
+		query(
+			question("host.local.", dns.TypeA),
+			question("_http._tcp.local.", dns.TypePTR),
+		)
+
+		e := r.HandledQuery()
+		Expect(e.Multicast.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+		Expect(e.Unicast.Answer).To(ConsistOf(sameRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")))
+
+		// one response is sent via unicast, and the other via multicast
+		for i := 0; i < 2; i++ {
+			m := q.Receive()
+
+			if m.Multicast {
+				Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+			} else {
+				Expect(m.Answer).To(ConsistOf(sameRecord("_http._tcp.local. 4500 IN PTR web._http._tcp.local.")))
+			}
+		}
+	})
+
+	It("responds via unicast after the records have been multicast again", func() {
+		network.Advance(30 * time.Second)
+
+		query(question("host.local.", dns.TypeA))
+		Expect(q.Receive().Multicast).To(BeTrue())
+
+		query(question("host.local.", dns.TypeA))
+		Expect(q.Receive().Multicast).To(BeFalse())
+	})
+})
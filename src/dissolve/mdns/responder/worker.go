@@ -0,0 +1,80 @@
+package responder
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	// defaultQueryWorkers is the default number of queries that may be
+	// answered concurrently.
+	defaultQueryWorkers = 8
+
+	// jobQueueSize is the number of jobs that may be waiting for a worker
+	// before further queries are dropped. Dropped queries are not answered, but
+	// the querier retransmits its query if it does not receive an answer.
+	jobQueueSize = 64
+
+	// defaultQueryTimeout is the default time allowed for the answerers to
+	// answer the questions in a query.
+	//
+	// Queriers send their second query one second after the first, so an
+	// answer that takes longer than this is likely to be superseded.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-5.2.
+	defaultQueryTimeout = 1 * time.Second
+)
+
+// job is a unit of work that calls the answerer, and is therefore performed by
+// the worker pool rather than the main loop.
+type job interface {
+	// Run performs the work. Any resulting change to the responder's state is
+	// made by executing a command on the main loop.
+	Run(ctx context.Context, r *Responder)
+}
+
+// dispatch queues j to be performed by the worker pool.
+//
+// It does not block. It returns false if the queue is full, in which case j is
+// not performed.
+func (r *Responder) dispatch(j job) bool {
+	select {
+	case r.jobs <- j:
+		return true
+	default:
+		return false
+	}
+}
+
+// submit queues j to be performed by the worker pool.
+//
+// Unlike dispatch(), j is never dropped. It does not block, if the queue is
+// full j is queued in the background.
+func (r *Responder) submit(ctx context.Context, j job) {
+	if r.dispatch(j) {
+		return
+	}
+
+	go func() {
+		select {
+		case <-ctx.Done():
+		case r.jobs <- j:
+		}
+	}()
+}
+
+// work performs queued jobs until ctx is canceled, then returns nil.
+//
+// Answerers are called outside of the main loop, so that a slow answerer does
+// not prevent other queries from being answered. The results are applied via
+// the main loop, which serializes all changes to the responder's state.
+func (r *Responder) work(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case j := <-r.jobs:
+			j.Run(ctx, r)
+		}
+	}
+}
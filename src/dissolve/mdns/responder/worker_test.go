@@ -0,0 +1,101 @@
+package responder_test
+
+import (
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/responder"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Responder query workers", func() {
+	var (
+		network  *testNetwork
+		answerer *testAnswerer
+		q        *querier
+	)
+
+	BeforeEach(func() {
+		network = newTestNetwork()
+		q = network.NewQuerier("eth1", "192.168.1.20/24", 0)
+		answerer = newTestAnswerer(
+			[]dns.RR{rr("host.local. 120 IN A 192.168.1.10")},
+			nil,
+		)
+		answerer.Slow = "slow.local."
+	})
+
+	AfterEach(func() {
+		network.Close()
+	})
+
+	// startQuery sends a query, and waits until the responder has started the
+	// timer that limits the time taken to answer it.
+	startQuery := func(questions ...dns.Question) {
+		n := network.Clock.Timers()
+		q.Query(questions...)
+		Eventually(network.Clock.Timers).Should(BeNumerically(">", n))
+	}
+
+	It("answers other queries while a slow answerer is busy", func() {
+		r := network.NewResponder("eth0", "192.168.1.10/24", answerer)
+		network.Establish(r, q)
+
+		startQuery(question("slow.local.", dns.TypeA))
+		q.Query(question("host.local.", dns.TypeA))
+
+		m := q.Receive()
+		Expect(m.Response).To(BeTrue())
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+
+	It("sends the answers produced before the query timeout elapses", func() {
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseQueryTimeout(500*time.Millisecond),
+		)
+		network.Establish(r, q)
+
+		startQuery(
+			question("host.local.", dns.TypeA),
+			question("slow.local.", dns.TypeA),
+		)
+
+		network.Advance(499 * time.Millisecond)
+		q.ExpectNothing()
+
+		network.Advance(1 * time.Millisecond)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+
+	It("limits the number of queries that are answered concurrently", func() {
+		r := network.NewResponder(
+			"eth0", "192.168.1.10/24",
+			answerer,
+			UseQueryWorkers(1),
+		)
+		network.Establish(r, q)
+
+		startQuery(question("slow.local.", dns.TypeA))
+		q.Query(question("host.local.", dns.TypeA))
+		q.ExpectNothing()
+
+		// the only worker is freed once the slow query times out
+		network.Advance(1 * time.Second)
+
+		m := q.Receive()
+		Expect(m.Answer).To(ConsistOf(sameRecord("host.local. 120 IN A 192.168.1.10")))
+	})
+
+	It("rejects invalid options", func() {
+		_, err := New(answerer, UseQueryWorkers(0))
+		Expect(err).To(MatchError("the number of query workers must be at least 1, got 0"))
+
+		_, err = New(answerer, UseQueryTimeout(0))
+		Expect(err).To(MatchError("the query timeout must be positive, got 0s"))
+	})
+})
@@ -75,6 +75,30 @@ func NewResponse(query *dns.Msg, unicast bool) *dns.Msg {
 	return m
 }
 
+// NewLegacyResponse returns a new (empty) unicast response to a query from a
+// "legacy" querier, that is, one that does not fully implement mDNS.
+//
+// See https://tools.ietf.org/html/rfc6762#section-6.7.
+func NewLegacyResponse(query *dns.Msg) *dns.Msg {
+	m := NewResponse(query, true)
+
+	// This unicast response MUST be a conventional unicast response as would
+	// be generated by a conventional Unicast DNS server; for example, it MUST
+	// repeat the query ID and the question given in the query message.
+	m.Question = make([]dns.Question, len(query.Question))
+	copy(m.Question, query.Question)
+
+	return m
+}
+
+// NewUnsolicitedResponse returns a new (empty) multicast response that is not
+// sent in reply to any particular query, such as an announcement.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.3.
+func NewUnsolicitedResponse() *dns.Msg {
+	return NewResponse(&dns.Msg{}, false)
+}
+
 // UniqueRecordBit is a bit flag that is used to indicate that a DNS RR
 // is a "unique" record.
 //
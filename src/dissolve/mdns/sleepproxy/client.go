@@ -0,0 +1,230 @@
+package sleepproxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+const (
+	// DefaultLease is the lease requested from the sleep proxy if Client.Lease
+	// is zero.
+	DefaultLease = 2 * time.Hour
+
+	// zone is the name placed in the zone section of update messages. The
+	// records handed to a sleep proxy are Multicast DNS records.
+	zone = "local."
+)
+
+// RecordSource is an interface for obtaining the records that are handed over
+// to a sleep proxy. It is implemented by *responder.Responder.
+type RecordSource interface {
+	// Records returns the records published on the given interface.
+	Records(ctx context.Context, iface net.Interface) ([]dns.RR, error)
+
+	// Reannounce announces all of the published records, so that the host
+	// reclaims them from the sleep proxy.
+	Reannounce(ctx context.Context) error
+}
+
+// Client registers a host's records with a sleep proxy before the host goes
+// to sleep, and reclaims them when it wakes.
+type Client struct {
+	// Source provides the records to hand over to the sleep proxy.
+	Source RecordSource
+
+	// Interface is the network interface on which the sleep proxy is used.
+	// Its MAC address identifies the host to the sleep proxy.
+	Interface net.Interface
+
+	// Server is the address of the sleep proxy. If it is nil, the sleep proxies
+	// are discovered via Discover() each time the host goes to sleep, and the
+	// records are registered with the first one that accepts them.
+	Server *net.UDPAddr
+
+	// Lease is the time for which the sleep proxy is asked to hold the records.
+	// If it is zero, DefaultLease is used.
+	Lease time.Duration
+
+	// Password is the optional password included in the "magic packets" that
+	// the sleep proxy uses to wake the host.
+	Password []byte
+
+	m        sync.Mutex
+	sequence uint8
+	server   *net.UDPAddr
+	records  []dns.RR
+}
+
+// Sleep hands the records published on the client's interface over to a sleep
+// proxy. It must be called before the host goes to sleep.
+//
+// It returns the lease granted by the sleep proxy.
+func (c *Client) Sleep(ctx context.Context) (time.Duration, error) {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	records, err := c.Source.Records(ctx, c.Interface)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(records) == 0 {
+		return 0, errors.New("there are no records to register with the sleep proxy")
+	}
+
+	servers := []*net.UDPAddr{c.Server}
+	if c.Server == nil {
+		servers, err = Discover(ctx, &c.Interface)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	lease := c.Lease
+	if lease == 0 {
+		lease = DefaultLease
+	}
+
+	var (
+		server *net.UDPAddr
+		res    *dns.Msg
+	)
+
+	for _, server = range servers {
+		m := newUpdate()
+		m.Ns = records
+
+		res, err = c.exchange(ctx, server, m, lease)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	c.server = server
+	c.records = records
+
+	// the server may grant a shorter lease than requested
+	for _, o := range optionsOf(res) {
+		if ul, ok := o.(*dns.EDNS0_UL); ok {
+			lease = time.Duration(ul.Lease) * time.Second
+		}
+	}
+
+	return lease, nil
+}
+
+// Wake reclaims the records from the sleep proxy that they were handed to by
+// Sleep(). It must be called after the host wakes from sleep.
+//
+// The records are deregistered from the sleep proxy, and then announced on the
+// network by the host.
+func (c *Client) Wake(ctx context.Context) error {
+	c.m.Lock()
+	defer c.m.Unlock()
+
+	// the sequence number is incremented each time the host wakes, so that
+	// the sleep proxy knows that any previous registrations are stale.
+	c.sequence++
+
+	if c.server != nil {
+		m := newUpdate()
+		m.Remove(c.records)
+
+		if _, err := c.exchange(ctx, c.server, m, 0); err != nil {
+			return err
+		}
+
+		c.server = nil
+		c.records = nil
+	}
+
+	return c.Source.Reannounce(ctx)
+}
+
+// newUpdate returns a new DNS update message for the mDNS zone.
+//
+// See https://tools.ietf.org/html/rfc2136#section-2.3.
+func newUpdate() *dns.Msg {
+	m := &dns.Msg{}
+	m.SetUpdate(zone)
+
+	return m
+}
+
+// exchange sends an update message to the sleep proxy and waits for its
+// response.
+func (c *Client) exchange(
+	ctx context.Context,
+	server *net.UDPAddr,
+	m *dns.Msg,
+	lease time.Duration,
+) (*dns.Msg, error) {
+	owner := &Owner{
+		Sequence:   c.sequence,
+		PrimaryMAC: c.Interface.HardwareAddr,
+		Password:   c.Password,
+	}
+
+	o, err := owner.Option()
+	if err != nil {
+		return nil, err
+	}
+
+	opt := &dns.OPT{
+		Hdr: dns.RR_Header{
+			Name:   ".",
+			Rrtype: dns.TypeOPT,
+		},
+	}
+	opt.SetUDPSize(dns.DefaultMsgSize)
+	opt.Option = append(
+		opt.Option,
+		&dns.EDNS0_UL{
+			Code:  dns.EDNS0UL,
+			Lease: uint32(lease / time.Second),
+		},
+		o,
+	)
+
+	m.Extra = append(m.Extra, opt)
+
+	cli := &dns.Client{Net: "udp"}
+
+	res, _, err := cli.ExchangeContext(ctx, m, server.String())
+	if err != nil {
+		return nil, err
+	}
+
+	if res.Rcode != dns.RcodeSuccess {
+		return nil, fmt.Errorf(
+			"sleep proxy at %s rejected the update: %s",
+			server,
+			dns.RcodeToString[res.Rcode],
+		)
+	}
+
+	return res, nil
+}
+
+// optionsOf returns the EDNS0 options in m.
+func optionsOf(m *dns.Msg) []dns.EDNS0 {
+	if opt := m.IsEdns0(); opt != nil {
+		return opt.Option
+	}
+
+	return nil
+}
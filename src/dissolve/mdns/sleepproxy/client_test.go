@@ -0,0 +1,142 @@
+package sleepproxy_test
+
+import (
+	"context"
+	"net"
+	"time"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/sleepproxy"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+// recordSource is a RecordSource that provides a fixed set of records.
+type recordSource struct {
+	Published   []dns.RR
+	Reannounced int
+}
+
+func (s *recordSource) Records(context.Context, net.Interface) ([]dns.RR, error) {
+	records := make([]dns.RR, len(s.Published))
+	for i, rr := range s.Published {
+		records[i] = dns.Copy(rr)
+	}
+
+	return records, nil
+}
+
+func (s *recordSource) Reannounce(context.Context) error {
+	s.Reannounced++
+	return nil
+}
+
+var _ = Describe("Client", func() {
+	var (
+		ctx    context.Context
+		cancel context.CancelFunc
+		server *standInServer
+		source *recordSource
+		client *Client
+		mac    net.HardwareAddr
+	)
+
+	BeforeEach(func() {
+		ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+
+		var err error
+		server, err = startStandInServer()
+		Expect(err).ShouldNot(HaveOccurred())
+
+		a, err := dns.NewRR("host.local. 120 IN A 192.168.1.10")
+		Expect(err).ShouldNot(HaveOccurred())
+
+		mac = net.HardwareAddr{0, 1, 2, 3, 4, 5}
+		source = &recordSource{Published: []dns.RR{a}}
+		client = &Client{
+			Source:    source,
+			Interface: net.Interface{Name: "en0", HardwareAddr: mac},
+			Server:    server.Addr(),
+			Lease:     2 * time.Hour,
+		}
+	})
+
+	AfterEach(func() {
+		server.Stop()
+		cancel()
+	})
+
+	Describe("Sleep", func() {
+		It("registers the records with the sleep proxy", func() {
+			_, err := client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			records := server.Records(mac)
+			Expect(records).To(HaveLen(1))
+			Expect(records[0].String()).To(Equal(source.Published[0].String()))
+		})
+
+		It("returns the lease granted by the sleep proxy", func() {
+			server.LimitLease(600)
+
+			lease, err := client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+			Expect(lease).To(Equal(10 * time.Minute))
+		})
+
+		It("sends an update message with a zone section", func() {
+			_, err := client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			updates := server.Updates()
+			Expect(updates).To(HaveLen(1))
+			Expect(updates[0].Opcode).To(Equal(dns.OpcodeUpdate))
+			Expect(updates[0].Question).To(ConsistOf(
+				dns.Question{Name: "local.", Qtype: dns.TypeSOA, Qclass: dns.ClassINET},
+			))
+		})
+
+		It("returns an error if the sleep proxy rejects the update", func() {
+			server.RefuseUpdates()
+
+			_, err := client.Sleep(ctx)
+			Expect(err).To(MatchError(ContainSubstring("REFUSED")))
+		})
+	})
+
+	Describe("Wake", func() {
+		It("reclaims the records from the sleep proxy", func() {
+			_, err := client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = client.Wake(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(server.Records(mac)).To(BeEmpty())
+			Expect(server.Updates()).To(HaveLen(2))
+		})
+
+		It("reannounces the records", func() {
+			_, err := client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = client.Wake(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(source.Reannounced).To(Equal(1))
+		})
+
+		It("increments the sequence number in the Owner option", func() {
+			_, err := client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			err = client.Wake(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			_, err = client.Sleep(ctx)
+			Expect(err).ShouldNot(HaveOccurred())
+
+			Expect(server.Sequences()).To(Equal([]uint8{0, 1, 1}))
+		})
+	})
+})
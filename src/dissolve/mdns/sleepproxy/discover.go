@@ -0,0 +1,220 @@
+package sleepproxy
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	"golang.org/x/net/ipv4"
+)
+
+const (
+	// ServiceName is the DNS-SD service enumeration name of sleep proxy
+	// servers.
+	ServiceName = "_sleep-proxy._udp.local."
+
+	// discoveryWindow is the time spent collecting responses to each
+	// discovery query.
+	discoveryWindow = 1 * time.Second
+
+	// discoveryRounds is the maximum number of queries sent when resolving the
+	// SRV and address records of the sleep proxies.
+	discoveryRounds = 3
+)
+
+// Discover finds the sleep proxy servers on the network attached to iface,
+// using one-shot multicast DNS queries over IPv4.
+//
+// The servers are returned in order of preference.
+//
+// See https://tools.ietf.org/html/rfc6762#section-5.1.
+func Discover(ctx context.Context, iface *net.Interface) ([]*net.UDPAddr, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{})
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	pc := ipv4.NewPacketConn(conn)
+	if err := pc.SetMulticastInterface(iface); err != nil {
+		return nil, err
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	c := cache{}
+	q := []dns.Question{
+		{Name: ServiceName, Qtype: dns.TypePTR, Qclass: dns.ClassINET},
+	}
+
+	for i := 0; i < discoveryRounds && len(q) != 0; i++ {
+		if err := c.query(conn, q); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+
+			return nil, err
+		}
+
+		q = c.unresolved()
+	}
+
+	servers := c.servers()
+	if len(servers) == 0 {
+		return nil, errors.New("no sleep proxy servers were found")
+	}
+
+	return servers, nil
+}
+
+// cache holds the records received in response to discovery queries, keyed by
+// their lowercase name.
+type cache map[string][]dns.RR
+
+// query sends a one-shot query containing the given questions and adds the
+// records in any responses received within the discovery window to the cache.
+func (c cache) query(conn *net.UDPConn, questions []dns.Question) error {
+	m := mdns.NewQuery(false, questions...)
+
+	data, err := m.Pack()
+	if err != nil {
+		return err
+	}
+
+	if _, err := conn.WriteTo(data, transport.IPv4GroupAddress); err != nil {
+		return err
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(discoveryWindow)); err != nil {
+		return err
+	}
+
+	buf := make([]byte, 65536)
+
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			if e, ok := err.(net.Error); ok && e.Timeout() {
+				return nil
+			}
+
+			return err
+		}
+
+		res := &dns.Msg{}
+		if err := res.Unpack(buf[:n]); err != nil || !res.Response {
+			continue
+		}
+
+		for _, rr := range append(append(res.Answer, res.Ns...), res.Extra...) {
+			k := strings.ToLower(rr.Header().Name)
+			c[k] = append(c[k], rr)
+		}
+	}
+}
+
+// unresolved returns questions for the SRV and address records that are
+// needed to contact each of the sleep proxy instances in the cache.
+func (c cache) unresolved() []dns.Question {
+	var questions []dns.Question
+
+	for _, name := range c.instances() {
+		srv, ok := c.srv(name)
+		if !ok {
+			questions = append(questions, dns.Question{
+				Name:   name,
+				Qtype:  dns.TypeSRV,
+				Qclass: dns.ClassINET,
+			})
+		} else if _, ok := c.address(srv.Target); !ok {
+			questions = append(questions, dns.Question{
+				Name:   srv.Target,
+				Qtype:  dns.TypeA,
+				Qclass: dns.ClassINET,
+			})
+		}
+	}
+
+	return questions
+}
+
+// servers returns the addresses of the sleep proxies in the cache, in order of
+// preference.
+func (c cache) servers() []*net.UDPAddr {
+	var result []*net.UDPAddr
+
+	for _, name := range c.instances() {
+		if srv, ok := c.srv(name); ok {
+			if ip, ok := c.address(srv.Target); ok {
+				result = append(result, &net.UDPAddr{
+					IP:   ip,
+					Port: int(srv.Port),
+				})
+			}
+		}
+	}
+
+	return result
+}
+
+// instances returns the names of the sleep proxy instances in the cache, in
+// order of preference.
+//
+// Sleep proxy instance names begin with a series of numbers that describe the
+// capabilities of the proxy, such as "10-34-10-70 Name", where a lower value
+// is more preferable.
+func (c cache) instances() []string {
+	seen := map[string]struct{}{}
+	var result []string
+
+	for _, rr := range c[strings.ToLower(ServiceName)] {
+		if ptr, ok := rr.(*dns.PTR); ok && ptr.Hdr.Ttl != 0 {
+			k := strings.ToLower(ptr.Ptr)
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				result = append(result, ptr.Ptr)
+			}
+		}
+	}
+
+	sort.Strings(result)
+
+	return result
+}
+
+// srv returns the SRV record for the given instance name.
+func (c cache) srv(name string) (*dns.SRV, bool) {
+	for _, rr := range c[strings.ToLower(name)] {
+		if srv, ok := rr.(*dns.SRV); ok {
+			return srv, true
+		}
+	}
+
+	return nil, false
+}
+
+// address returns the IPv4 address of the given host name.
+func (c cache) address(name string) (net.IP, bool) {
+	for _, rr := range c[strings.ToLower(name)] {
+		if a, ok := rr.(*dns.A); ok {
+			return a.A, true
+		}
+	}
+
+	return nil, false
+}
@@ -0,0 +1,76 @@
+package sleepproxy
+
+import (
+	"errors"
+	"net"
+
+	"github.com/miekg/dns"
+)
+
+// ownerOptionCode is the EDNS0 option code of the Owner option.
+const ownerOptionCode = 4
+
+// Owner is the EDNS0 Owner option, which identifies the host on whose behalf a
+// sleep proxy holds records.
+//
+// See https://tools.ietf.org/html/draft-cheshire-edns0-owner-option-01.
+type Owner struct {
+	// Sequence is incremented each time the host wakes from sleep, so that the
+	// sleep proxy can discard stale registrations.
+	Sequence uint8
+
+	// PrimaryMAC is the MAC address of the host's primary network interface,
+	// which identifies the host.
+	PrimaryMAC net.HardwareAddr
+
+	// WakeupMAC is the MAC address to which the sleep proxy sends "magic
+	// packets" to wake the host. If it is empty, PrimaryMAC is used.
+	WakeupMAC net.HardwareAddr
+
+	// Password is the optional 4 or 6 byte password included in magic packets.
+	Password []byte
+}
+
+// Option returns the Owner option as a generic EDNS0 option.
+func (o *Owner) Option() (dns.EDNS0, error) {
+	if len(o.PrimaryMAC) != 6 {
+		return nil, errors.New("the primary MAC address must be a 6-byte EUI-48 address")
+	}
+
+	if len(o.WakeupMAC) != 0 && len(o.WakeupMAC) != 6 {
+		return nil, errors.New("the wake-up MAC address must be a 6-byte EUI-48 address")
+	}
+
+	if len(o.Password) != 0 && len(o.Password) != 4 && len(o.Password) != 6 {
+		return nil, errors.New("the password must be 4 or 6 bytes")
+	}
+
+	// 0                   1                   2                   3
+	// 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	// |  Ver (8 bit)  |  Seq (8 bit)  |                               |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+                               |
+	// |               Primary MAC Address (48 bit)                    |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	// |          Wakeup MAC Address (48 bit, optional)                |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	// |          Password (32 or 48 bit, optional)                    |
+	// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+	data := []byte{0, o.Sequence}
+	data = append(data, o.PrimaryMAC...)
+
+	if len(o.WakeupMAC) != 0 || len(o.Password) != 0 {
+		wakeup := o.WakeupMAC
+		if len(wakeup) == 0 {
+			wakeup = o.PrimaryMAC
+		}
+
+		data = append(data, wakeup...)
+		data = append(data, o.Password...)
+	}
+
+	return &dns.EDNS0_LOCAL{
+		Code: ownerOptionCode,
+		Data: data,
+	}, nil
+}
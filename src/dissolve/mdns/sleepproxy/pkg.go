@@ -0,0 +1,5 @@
+// Package sleepproxy provides a client for Bonjour Sleep Proxy servers, which
+// answer mDNS queries on behalf of a host while it is asleep.
+//
+// See https://tools.ietf.org/html/draft-cheshire-edns0-owner-option.
+package sleepproxy
@@ -0,0 +1,232 @@
+package sleepproxy_test
+
+import (
+	"encoding/binary"
+	"net"
+	"strings"
+	"sync"
+
+	"github.com/miekg/dns"
+)
+
+// standInServer is a minimal sleep proxy server that accepts registrations on
+// the loopback interface, so that the client can be tested without a real
+// sleep proxy on the network.
+//
+// It holds the registered records but does not answer queries on their behalf.
+type standInServer struct {
+	conn      *net.UDPConn
+	m         sync.Mutex
+	maxLease  uint32
+	refuse    bool
+	records   map[string][]dns.RR // keyed by the MAC address in the Owner option
+	updates   []*dns.Msg
+	sequences []uint8
+}
+
+// startStandInServer starts a new stand-in server on a random port.
+func startStandInServer() (*standInServer, error) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		return nil, err
+	}
+
+	s := &standInServer{
+		maxLease: 3600,
+		conn:     conn,
+		records:  map[string][]dns.RR{},
+	}
+
+	go s.serve()
+
+	return s, nil
+}
+
+// serve handles update messages until the server is stopped.
+func (s *standInServer) serve() {
+	buf := make([]byte, 65536)
+
+	for {
+		n, addr, err := s.conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+
+		req := &dns.Msg{}
+		if err := req.Unpack(buf[:n]); err != nil {
+			continue
+		}
+
+		if data, err := s.handle(req, buf[:n]).Pack(); err == nil {
+			_, _ = s.conn.WriteToUDP(data, addr)
+		}
+	}
+}
+
+// Addr returns the address of the server.
+func (s *standInServer) Addr() *net.UDPAddr {
+	return s.conn.LocalAddr().(*net.UDPAddr)
+}
+
+// Stop stops the server.
+func (s *standInServer) Stop() {
+	s.conn.Close()
+}
+
+// LimitLease sets the longest lease, in seconds, that the server grants.
+func (s *standInServer) LimitLease(n uint32) {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.maxLease = n
+}
+
+// RefuseUpdates causes the server to reject every update.
+func (s *standInServer) RefuseUpdates() {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.refuse = true
+}
+
+// Records returns the records held on behalf of the host with the given MAC
+// address.
+func (s *standInServer) Records(mac net.HardwareAddr) []dns.RR {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.records[mac.String()]
+}
+
+// Updates returns the update messages received by the server.
+func (s *standInServer) Updates() []*dns.Msg {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.updates
+}
+
+// Sequences returns the sequence numbers from the Owner option of each update
+// message received by the server.
+func (s *standInServer) Sequences() []uint8 {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	return s.sequences
+}
+
+// handle returns the response to an update message from a sleep proxy client.
+// data is the message in wire format.
+func (s *standInServer) handle(req *dns.Msg, data []byte) *dns.Msg {
+	s.m.Lock()
+	defer s.m.Unlock()
+
+	s.updates = append(s.updates, req)
+
+	res := &dns.Msg{}
+	res.SetReply(req)
+
+	owner, lease := options(req, data)
+
+	var mac string
+	if len(owner) >= 8 {
+		mac = net.HardwareAddr(owner[2:8]).String()
+		s.sequences = append(s.sequences, owner[1])
+	}
+
+	switch {
+	case req.Opcode != dns.OpcodeUpdate,
+		len(req.Question) != 1,
+		req.Question[0].Qtype != dns.TypeSOA,
+		mac == "":
+		res.Rcode = dns.RcodeFormatError
+	case s.refuse:
+		res.Rcode = dns.RcodeRefused
+	default:
+		for _, rr := range req.Ns {
+			if rr.Header().Class == dns.ClassNONE {
+				s.remove(mac, rr)
+			} else {
+				s.records[mac] = append(s.records[mac], rr)
+			}
+		}
+
+		if lease > s.maxLease {
+			lease = s.maxLease
+		}
+
+		res.SetEdns0(dns.DefaultMsgSize, false)
+		opt := res.IsEdns0()
+		opt.Option = append(opt.Option, &dns.EDNS0_UL{
+			Code:  dns.EDNS0UL,
+			Lease: lease,
+		})
+	}
+
+	return res
+}
+
+// options returns the content of the Owner option and the requested lease from
+// the Update Lease option of req.
+//
+// The options are read from data, the wire format of req, as versions of the
+// dns package differ in how they decode option code 4.
+func options(req *dns.Msg, data []byte) ([]byte, uint32) {
+	opt := req.IsEdns0()
+	if opt == nil {
+		return nil, 0
+	}
+
+	// the OPT record is the last record in the message, so its data is at the
+	// end of the packet.
+	rdata := data[len(data)-int(opt.Hdr.Rdlength):]
+
+	var (
+		owner []byte
+		lease uint32
+	)
+
+	for len(rdata) >= 4 {
+		code := binary.BigEndian.Uint16(rdata)
+		size := int(binary.BigEndian.Uint16(rdata[2:]))
+		if len(rdata) < 4+size {
+			break
+		}
+
+		value := rdata[4 : 4+size]
+		rdata = rdata[4+size:]
+
+		switch code {
+		case dns.EDNS0UL:
+			if size >= 4 {
+				lease = binary.BigEndian.Uint32(value)
+			}
+		case 4: // Owner
+			owner = value
+		}
+	}
+
+	return owner, lease
+}
+
+// remove removes the record matching the name, type and data of rr from those
+// held on behalf of the host with the given MAC address.
+// It assumes s.m is already locked.
+func (s *standInServer) remove(mac string, rr dns.RR) {
+	records := s.records[mac]
+
+	for i, x := range records {
+		if strings.EqualFold(x.Header().Name, rr.Header().Name) &&
+			x.Header().Rrtype == rr.Header().Rrtype &&
+			dnsData(x) == dnsData(rr) {
+			s.records[mac] = append(records[:i:i], records[i+1:]...)
+			return
+		}
+	}
+}
+
+// dnsData returns the textual representation of the data of rr, without its
+// header.
+func dnsData(rr dns.RR) string {
+	return strings.TrimPrefix(rr.String(), rr.Header().String())
+}
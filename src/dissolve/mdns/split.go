@@ -0,0 +1,144 @@
+package mdns
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// MaxPacketSize is the maximum size of a multicast DNS packet, including IP and
+// UDP headers.
+//
+// See https://tools.ietf.org/html/rfc6762#section-17.
+const MaxPacketSize = 9000
+
+// SplitResponse splits the response m into as many messages as are necessary
+// for each message to be no larger than size bytes.
+//
+// Each unique RRSet in the answer and authority sections is kept in a single
+// message. Records in the additional section are placed in the first message
+// with enough space remaining, and are dropped if there is no such message.
+//
+// A single RRSet that is larger than size on its own is placed in a message by
+// itself, which will exceed size.
+//
+// See https://tools.ietf.org/html/rfc6762#section-17.
+func SplitResponse(m *dns.Msg, size int) []*dns.Msg {
+	if m.Len() <= size {
+		return []*dns.Msg{m}
+	}
+
+	// In the case of a single Multicast DNS resource record that is too
+	// large to fit in a single MTU-sized multicast response packet, a
+	// Multicast DNS responder SHOULD send the resource record alone, in a
+	// single IP datagram, using multiple IP fragments.
+	//
+	// [...] a Multicast DNS responder with many records to send MAY split
+	// them across multiple packets, as long as each unique RRSet is kept
+	// together within a single packet.
+	current := emptyCopy(m)
+	result := []*dns.Msg{current}
+
+	add := func(section func(*dns.Msg) *[]dns.RR, set []dns.RR) {
+		s := section(current)
+		n := len(*s)
+		*s = append(*s, set...)
+
+		if current.Len() <= size || isEmpty(current, set) {
+			return
+		}
+
+		*s = (*s)[:n]
+
+		current = emptyCopy(m)
+		result = append(result, current)
+
+		s = section(current)
+		*s = append(*s, set...)
+	}
+
+	for _, set := range recordSets(m.Answer) {
+		add(answerSection, set)
+	}
+
+	for _, set := range recordSets(m.Ns) {
+		add(authoritySection, set)
+	}
+
+	// Additional records are only hints that save the querier from sending
+	// further queries, so they are the first to be dropped when there is not
+	// enough space.
+	for _, set := range recordSets(m.Extra) {
+		for _, x := range result {
+			n := len(x.Extra)
+			x.Extra = append(x.Extra, set...)
+
+			if x.Len() <= size {
+				break
+			}
+
+			x.Extra = x.Extra[:n]
+		}
+	}
+
+	return result
+}
+
+// answerSection returns a pointer to the answer section of m.
+func answerSection(m *dns.Msg) *[]dns.RR { return &m.Answer }
+
+// authoritySection returns a pointer to the authority section of m.
+func authoritySection(m *dns.Msg) *[]dns.RR { return &m.Ns }
+
+// emptyCopy returns a copy of m with the same header and questions, but no
+// records.
+func emptyCopy(m *dns.Msg) *dns.Msg {
+	return &dns.Msg{
+		MsgHdr:   m.MsgHdr,
+		Compress: m.Compress,
+		Question: m.Question,
+	}
+}
+
+// isEmpty returns true if m contains no records other than those in set.
+func isEmpty(m *dns.Msg, set []dns.RR) bool {
+	return len(m.Answer)+len(m.Ns)+len(m.Extra) == len(set)
+}
+
+// recordSets groups records into sets that must be sent in the same message.
+//
+// Records with the unique record bit set are grouped with the other unique
+// records of the same name, type and class. Shared records each form a set of
+// their own. The order of the records is otherwise preserved.
+func recordSets(records []dns.RR) [][]dns.RR {
+	var (
+		sets  [][]dns.RR
+		index = map[string]int{}
+	)
+
+	for _, rr := range records {
+		h := rr.Header()
+
+		if h.Class&UniqueRecordBit == 0 {
+			sets = append(sets, []dns.RR{rr})
+			continue
+		}
+
+		k := fmt.Sprintf(
+			"%s/%d/%d",
+			strings.ToLower(h.Name),
+			h.Rrtype,
+			h.Class&^UniqueRecordBit,
+		)
+
+		if i, ok := index[k]; ok {
+			sets[i] = append(sets[i], rr)
+		} else {
+			index[k] = len(sets)
+			sets = append(sets, []dns.RR{rr})
+		}
+	}
+
+	return sets
+}
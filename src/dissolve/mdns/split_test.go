@@ -0,0 +1,144 @@
+package mdns_test
+
+import (
+	"fmt"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("SplitResponse", func() {
+	var m *dns.Msg
+
+	BeforeEach(func() {
+		m = NewResponse(
+			NewQuery(false, dns.Question{
+				Name:   "_http._tcp.local.",
+				Qtype:  dns.TypePTR,
+				Qclass: dns.ClassINET,
+			}),
+			false,
+		)
+
+		for i := 0; i < 10; i++ {
+			m.Answer = append(m.Answer, rr(fmt.Sprintf(
+				"_http._tcp.local. 4500 IN PTR instance-%d._http._tcp.local.",
+				i,
+			)))
+		}
+	})
+
+	// records returns all of the records in the given section of each
+	// message, in order.
+	records := func(messages []*dns.Msg, section func(*dns.Msg) []dns.RR) []dns.RR {
+		var result []dns.RR
+		for _, x := range messages {
+			result = append(result, section(x)...)
+		}
+		return result
+	}
+
+	answers := func(x *dns.Msg) []dns.RR { return x.Answer }
+	additional := func(x *dns.Msg) []dns.RR { return x.Extra }
+
+	It("returns the original message if it fits", func() {
+		messages := SplitResponse(m, m.Len())
+		Expect(messages).To(HaveLen(1))
+		Expect(messages[0]).To(BeIdenticalTo(m))
+	})
+
+	It("splits the records across as many messages as necessary", func() {
+		size := m.Len() / 3
+
+		messages := SplitResponse(m, size)
+		Expect(len(messages)).To(BeNumerically(">=", 3))
+
+		for _, x := range messages {
+			Expect(x.Len()).To(BeNumerically("<=", size))
+			Expect(x.MsgHdr).To(Equal(m.MsgHdr))
+			Expect(x.Question).To(Equal(m.Question))
+		}
+
+		Expect(records(messages, answers)).To(Equal(m.Answer))
+	})
+
+	It("keeps each unique record set within a single message", func() {
+		var set []dns.RR
+		for i := 0; i < 4; i++ {
+			set = append(set, SetUniqueRecord(rr(fmt.Sprintf(
+				"host.local. 120 IN A 192.168.1.%d",
+				i,
+			))))
+		}
+
+		m.Answer = append(m.Answer[:1], set...)
+
+		// the second message has enough space for the PTR record and half
+		// of the A records
+		size := emptyLen(m) + (m.Len()-emptyLen(m))/2
+
+		messages := SplitResponse(m, size)
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].Answer).To(Equal(m.Answer[:1]))
+		Expect(messages[1].Answer).To(Equal(set))
+	})
+
+	It("places a record set that is larger than the size limit in a message of its own", func() {
+		size := emptyLen(m) + 1
+
+		messages := SplitResponse(m, size)
+		Expect(messages).To(HaveLen(len(m.Answer)))
+
+		for i, x := range messages {
+			Expect(x.Answer).To(Equal(m.Answer[i : i+1]))
+		}
+	})
+
+	It("places additional records in the first message with enough space", func() {
+		// the first message has space for six and a half PTR records, leaving
+		// room for the additional record in the second message only
+		n := (m.Len() - emptyLen(m)) / len(m.Answer)
+		size := emptyLen(m) + 6*n + n/2
+
+		extra := rr(fmt.Sprintf("instance-0._http._tcp.local. 4500 IN TXT \"%0*d\"", n, 0))
+		m.Extra = []dns.RR{extra}
+
+		messages := SplitResponse(m, size)
+		Expect(messages).To(HaveLen(2))
+		Expect(messages[0].Answer).To(HaveLen(6))
+		Expect(messages[0].Extra).To(BeEmpty())
+		Expect(messages[1].Answer).To(HaveLen(4))
+		Expect(messages[1].Extra).To(Equal(m.Extra))
+
+		for _, x := range messages {
+			Expect(x.Len()).To(BeNumerically("<=", size))
+		}
+	})
+
+	It("drops additional records that do not fit in any message", func() {
+		// each message has space for five and a half PTR records
+		n := (m.Len() - emptyLen(m)) / len(m.Answer)
+		size := emptyLen(m) + 5*n + n/2
+
+		m.Extra = []dns.RR{
+			rr(fmt.Sprintf("instance-0._http._tcp.local. 4500 IN TXT \"%0*d\"", n, 0)),
+		}
+
+		messages := SplitResponse(m, size)
+		Expect(messages).To(HaveLen(2))
+		Expect(records(messages, answers)).To(Equal(m.Answer))
+		Expect(records(messages, additional)).To(BeEmpty())
+	})
+})
+
+// emptyLen returns the length of m without any records.
+func emptyLen(m *dns.Msg) int {
+	x := m.Copy()
+	x.Answer = nil
+	x.Ns = nil
+	x.Extra = nil
+
+	return x.Len()
+}
@@ -0,0 +1,100 @@
+package mdns
+
+import (
+	"bytes"
+	"sort"
+
+	"github.com/miekg/dns"
+)
+
+// CompareRecords performs a lexicographical comparison of two resource
+// records, as used to break ties between simultaneous probes.
+//
+// It returns a negative number if a is "earlier" than b, a positive number if
+// a is "later" than b, or zero if the records are equal.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.2.
+func CompareRecords(a, b dns.RR) int {
+	// The determination of "lexicographically later" is performed by first
+	// comparing the record class (excluding the cache-flush bit described
+	// in Section 10.2), then the record type, then raw comparison of the
+	// binary content of the rdata without regard for meaning or structure.
+	ca := a.Header().Class &^ UniqueRecordBit
+	cb := b.Header().Class &^ UniqueRecordBit
+
+	if ca != cb {
+		return int(ca) - int(cb)
+	}
+
+	ta := a.Header().Rrtype
+	tb := b.Header().Rrtype
+
+	if ta != tb {
+		return int(ta) - int(tb)
+	}
+
+	return bytes.Compare(rdata(a), rdata(b))
+}
+
+// CompareRecordSets performs a lexicographical comparison of two sets of
+// resource records, as used to break ties between simultaneous probes.
+//
+// It returns a negative number if a is "earlier" than b, a positive number if
+// a is "later" than b, or zero if the sets are equal.
+//
+// See https://tools.ietf.org/html/rfc6762#section-8.2.
+func CompareRecordSets(a, b []dns.RR) int {
+	// The records are sorted using the same lexicographical order as
+	// described above, that is, if the record classes differ, the record
+	// with the lower class number comes first.  If the classes are the same
+	// but the rrtypes differ, the record with the lower rrtype number comes
+	// first.  If the class and rrtype match, then the rdata is compared
+	// bytewise, and the record with the lower rdata bytes comes first.
+	a = sortRecords(a)
+	b = sortRecords(b)
+
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := CompareRecords(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+
+	// If both lists run out of records at the same time without any
+	// difference being detected, then this indicates that two devices are
+	// advertising identical sets of records, as is sometimes done for fault
+	// tolerance, and there is, in fact, no conflict.  If either list of
+	// records runs out of records before any difference is found, then the
+	// list with records remaining is deemed to have won the tiebreak.
+	return len(a) - len(b)
+}
+
+// sortRecords returns a sorted copy of records.
+func sortRecords(records []dns.RR) []dns.RR {
+	s := make([]dns.RR, len(records))
+	copy(s, records)
+
+	sort.SliceStable(s, func(i, j int) bool {
+		return CompareRecords(s[i], s[j]) < 0
+	})
+
+	return s
+}
+
+// rdata returns the uncompressed binary representation of the rdata of r.
+func rdata(r dns.RR) []byte {
+	buf := make([]byte, dns.Len(r)+1)
+
+	end, err := dns.PackRR(r, buf, 0, nil, false)
+	if err != nil {
+		return nil
+	}
+
+	// the rdata follows the owner name, and the 10-octet fixed-length portion
+	// of the RR header (type, class, TTL and rdlength)
+	start, err := dns.PackDomainName(r.Header().Name, make([]byte, 256), 0, nil, false)
+	if err != nil {
+		return nil
+	}
+
+	return buf[start+10 : end]
+}
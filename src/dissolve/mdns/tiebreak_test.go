@@ -0,0 +1,118 @@
+package mdns_test
+
+import (
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("CompareRecords", func() {
+	It("returns zero for records with the same class, type and rdata", func() {
+		a := rr("host.local. 120 IN A 192.168.1.10")
+		b := rr("HOST.local. 10 IN A 192.168.1.10")
+
+		Expect(CompareRecords(a, b)).To(Equal(0))
+	})
+
+	It("ignores the unique record bit", func() {
+		a := rr("host.local. 120 IN A 192.168.1.10")
+		b := SetUniqueRecord(a)
+
+		Expect(CompareRecords(a, b)).To(Equal(0))
+	})
+
+	It("compares the class first", func() {
+		a := rr("host.local. 120 IN TXT \"z\"")
+		b := rr("host.local. 120 CH A 192.168.1.10")
+
+		Expect(CompareRecords(a, b)).To(BeNumerically("<", 0))
+		Expect(CompareRecords(b, a)).To(BeNumerically(">", 0))
+	})
+
+	It("compares the type if the classes are equal", func() {
+		a := rr("host.local. 120 IN A 192.168.1.20")
+		b := rr("host.local. 120 IN AAAA fe80::1")
+
+		Expect(CompareRecords(a, b)).To(BeNumerically("<", 0))
+		Expect(CompareRecords(b, a)).To(BeNumerically(">", 0))
+	})
+
+	It("compares the binary rdata if the classes and types are equal", func() {
+		a := rr("host.local. 120 IN A 169.254.200.200")
+		b := rr("host.local. 120 IN A 169.254.99.200")
+
+		// 169.254.200.200 is "later" because 200 > 99
+		Expect(CompareRecords(a, b)).To(BeNumerically(">", 0))
+		Expect(CompareRecords(b, a)).To(BeNumerically("<", 0))
+	})
+
+	It("compares names in the rdata without compression or case folding", func() {
+		a := rr("_http._tcp.local. 120 IN PTR a._http._tcp.local.")
+		b := rr("_http._tcp.local. 120 IN PTR B._http._tcp.local.")
+
+		// 'B' (0x42) is "earlier" than 'a' (0x61)
+		Expect(CompareRecords(a, b)).To(BeNumerically(">", 0))
+	})
+})
+
+var _ = Describe("CompareRecordSets", func() {
+	It("returns zero for identical sets, regardless of their order", func() {
+		a := []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.10"),
+			rr("host.local. 120 IN A 192.168.1.20"),
+		}
+		b := []dns.RR{a[1], a[0]}
+
+		Expect(CompareRecordSets(a, b)).To(Equal(0))
+	})
+
+	It("compares the records in sorted order", func() {
+		a := []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.30"),
+			rr("host.local. 120 IN A 192.168.1.10"),
+		}
+		b := []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.20"),
+			rr("host.local. 120 IN A 192.168.1.10"),
+		}
+
+		Expect(CompareRecordSets(a, b)).To(BeNumerically(">", 0))
+		Expect(CompareRecordSets(b, a)).To(BeNumerically("<", 0))
+	})
+
+	It("considers the set with records remaining to be later", func() {
+		a := []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.10"),
+		}
+		b := []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.10"),
+			rr("host.local. 120 IN A 192.168.1.20"),
+		}
+
+		Expect(CompareRecordSets(a, b)).To(BeNumerically("<", 0))
+		Expect(CompareRecordSets(b, a)).To(BeNumerically(">", 0))
+	})
+
+	It("does not modify the order of the sets", func() {
+		a := []dns.RR{
+			rr("host.local. 120 IN A 192.168.1.20"),
+			rr("host.local. 120 IN A 192.168.1.10"),
+		}
+
+		CompareRecordSets(a, nil)
+
+		Expect(a[0].(*dns.A).A.String()).To(Equal("192.168.1.20"))
+	})
+})
+
+// rr parses a record from its text representation, such as
+// "host.local. 120 IN A 192.168.1.10".
+func rr(s string) dns.RR {
+	r, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
@@ -4,8 +4,11 @@ import "net"
 
 // Endpoint is the origin or destination of a packet.
 type Endpoint struct {
+	// InterfaceIndex is the index of the network interface on which the packet
+	// was sent or received, or zero if it is not known.
 	InterfaceIndex int
-	Address        *net.UDPAddr
+
+	Address *net.UDPAddr
 }
 
 // IsLegacy returns true if this endpoint is a "legacy" endpoint.
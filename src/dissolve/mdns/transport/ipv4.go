@@ -3,6 +3,7 @@ package transport
 import (
 	"net"
 
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
 	"github.com/jmalloc/twelf/src/twelf"
 
 	ipvx "golang.org/x/net/ipv4"
@@ -21,21 +22,30 @@ var (
 
 	// IPv4ListenAddress is the address to which the mDNS server binds when using
 	// IPv4. Note that the multicast group address is NOT used in order to control
-	// more precisely which network interfaces join the multicast group.
-	IPv4ListenAddress = &net.UDPAddr{IP: net.ParseIP("224.0.0.0"), Port: Port}
+	// more precisely which network interfaces join the multicast group, and so
+	// that direct unicast queries can be received.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-5.5.
+	IPv4ListenAddress = &net.UDPAddr{IP: net.IPv4zero, Port: Port}
 )
 
 // IPv4Transport is an IPv4-based UDP transport.
 type IPv4Transport struct {
 	Logger twelf.Logger
 
-	pc *ipvx.PacketConn
+	// Clock is used to determine which received packets are looped-back copies
+	// of packets sent by the transport. If it is nil, the system clock is
+	// used.
+	Clock clock.Clock
+
+	pc       *ipvx.PacketConn
+	loopback loopbackFilter
 }
 
-// Listen starts listening for UDP packets on the given interfaces.
-func (t *IPv4Transport) Listen(iface *net.Interface) error {
+// Listen starts listening for UDP packets.
+func (t *IPv4Transport) Listen() error {
 	addr := IPv4ListenAddress
-	conn, err := net.ListenUDP("udp4", addr)
+	conn, err := listenUDP("udp4", addr)
 	if err != nil {
 		logListenError(t.Logger, addr, err)
 		return err
@@ -43,29 +53,76 @@ func (t *IPv4Transport) Listen(iface *net.Interface) error {
 
 	t.pc = ipvx.NewPacketConn(conn)
 
-	err = t.pc.SetControlMessage(ipvx.FlagInterface, true)
+	err = t.pc.SetControlMessage(ipvx.FlagInterface|ipvx.FlagDst|ipvx.FlagTTL, true)
 	if err != nil {
 		t.pc.Close()
 		logListenError(t.Logger, addr, err)
 		return err
 	}
 
-	err = t.pc.JoinGroup(iface, &net.UDPAddr{
-		IP: IPv4Group,
-	})
-	if err != nil {
+	// https://tools.ietf.org/html/rfc6762#section-11
+	//
+	// All Multicast DNS responses (including responses sent via unicast)
+	// SHOULD be sent with IP TTL set to 255.
+	if err := t.setTTL(255); err != nil {
 		t.pc.Close()
 		logListenError(t.Logger, addr, err)
 		return err
 	}
 
-	logListening(t.Logger, addr, iface)
+	logListening(t.Logger, addr)
 
 	return nil
 }
 
-// Read reads the next packet from the transport.
+// Join joins the multicast group on the given interface.
+func (t *IPv4Transport) Join(iface *net.Interface) error {
+	if err := t.pc.JoinGroup(iface, &net.UDPAddr{
+		IP: IPv4Group,
+	}); err != nil {
+		logJoinError(t.Logger, t.Group(), iface, err)
+		return err
+	}
+
+	logJoined(t.Logger, t.Group(), iface)
+
+	return nil
+}
+
+// Leave leaves the multicast group on the given interface.
+func (t *IPv4Transport) Leave(iface *net.Interface) error {
+	if err := t.pc.LeaveGroup(iface, &net.UDPAddr{
+		IP: IPv4Group,
+	}); err != nil {
+		logLeaveError(t.Logger, t.Group(), iface, err)
+		return err
+	}
+
+	logLeft(t.Logger, t.Group(), iface)
+
+	return nil
+}
+
+// Read reads the next packet from the transport, ignoring any multicast packets
+// sent by the transport itself.
 func (t *IPv4Transport) Read() (*InboundPacket, error) {
+	for {
+		p, err := t.read()
+		if err != nil {
+			return nil, err
+		}
+
+		if !t.loopback.IsLoopback(p, now(t.Clock)) {
+			return p, nil
+		}
+
+		p.Close()
+	}
+}
+
+// read reads the next packet from the socket, including packets sent by this
+// transport that have been looped back.
+func (t *IPv4Transport) read() (*InboundPacket, error) {
 	buf := getBuffer()
 
 	n, cm, src, err := t.pc.ReadFrom(buf)
@@ -75,20 +132,30 @@ func (t *IPv4Transport) Read() (*InboundPacket, error) {
 		return nil, err
 	}
 
-	buf = buf[:n]
-
-	return &InboundPacket{
-		t,
-		Endpoint{
-			cm.IfIndex,
-			src.(*net.UDPAddr),
+	p := &InboundPacket{
+		Transport: t,
+		Source: Endpoint{
+			Address: src.(*net.UDPAddr),
 		},
-		buf,
-	}, nil
+		HopLimit: -1,
+		Data:     buf[:n],
+	}
+
+	// the control message may be missing on some platforms, in which case the
+	// responder infers the interface from the source address.
+	if cm != nil {
+		p.Source.InterfaceIndex = cm.IfIndex
+		p.Destination = cm.Dst
+		p.HopLimit = cm.TTL
+	}
+
+	return p, nil
 }
 
 // Write sends a packet via the transport.
 func (t *IPv4Transport) Write(p *OutboundPacket) error {
+	t.loopback.Sent(p, now(t.Clock))
+
 	if _, err := t.pc.WriteTo(
 		p.Data,
 		&ipvx.ControlMessage{
@@ -96,6 +163,7 @@ func (t *IPv4Transport) Write(p *OutboundPacket) error {
 		},
 		p.Destination.Address,
 	); err != nil {
+		t.loopback.Unsent(p)
 		logWriteError(t.Logger, p.Destination.Address, t.Group(), err)
 		return err
 	}
@@ -103,6 +171,16 @@ func (t *IPv4Transport) Write(p *OutboundPacket) error {
 	return nil
 }
 
+// setTTL sets the IP TTL of both unicast and multicast packets sent via the
+// transport.
+func (t *IPv4Transport) setTTL(ttl int) error {
+	if err := t.pc.SetTTL(ttl); err != nil {
+		return err
+	}
+
+	return t.pc.SetMulticastTTL(ttl)
+}
+
 // Group returns the multicast group address for this transport.
 func (t *IPv4Transport) Group() *net.UDPAddr {
 	return IPv4GroupAddress
@@ -0,0 +1,165 @@
+package transport_test
+
+import (
+	"net"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("IPv4Transport", func() {
+	var (
+		a, b      *IPv4Transport
+		listening []*IPv4Transport
+	)
+
+	// listen starts t listening, so that it is closed after the test.
+	listen := func(t *IPv4Transport) error {
+		if err := t.Listen(); err != nil {
+			return err
+		}
+
+		listening = append(listening, t)
+
+		return nil
+	}
+
+	BeforeEach(func() {
+		a = &IPv4Transport{Logger: discardLogger{}}
+		b = &IPv4Transport{Logger: discardLogger{}}
+		listening = nil
+
+		if err := listen(a); err != nil {
+			Skip("unable to listen on the mDNS port: " + err.Error())
+		}
+	})
+
+	AfterEach(func() {
+		for _, t := range listening {
+			t.Close()
+		}
+	})
+
+	It("shares the mDNS port with other sockets", func() {
+		Expect(listen(b)).To(Succeed())
+	})
+
+	Context("when multicast packets are looped back", func() {
+		var (
+			iface  net.Interface
+			query  *dns.Msg
+			aRecv  chan *InboundPacket
+			bRecv  chan *InboundPacket
+			sendTo = func(t Transport) {
+				_, err := SendMulticast(t, &iface, query)
+				Expect(err).ShouldNot(HaveOccurred())
+			}
+		)
+
+		BeforeEach(func() {
+			var ok bool
+			iface, ok = multicastInterface()
+			if !ok {
+				Skip("no IPv4 multicast interface is available")
+			}
+
+			Expect(listen(b)).To(Succeed())
+			Expect(a.Join(&iface)).To(Succeed())
+			Expect(b.Join(&iface)).To(Succeed())
+
+			// a unique ID so that packets from other hosts are not mistaken
+			// for those sent by the test
+			query = mdns.NewQuery(false, dns.Question{
+				Name:   "dissolve-loopback-test.local.",
+				Qtype:  dns.TypeA,
+				Qclass: dns.ClassINET,
+			})
+			query.Id = dns.Id()
+
+			aRecv = receive(a, query)
+			bRecv = receive(b, query)
+		})
+
+		It("ignores its own packets, but delivers them to other sockets", func() {
+			sendTo(a)
+
+			Eventually(bRecv).Should(Receive())
+			Consistently(aRecv, 250*time.Millisecond).ShouldNot(Receive())
+		})
+
+		It("does not ignore identical packets sent by other sockets", func() {
+			sendTo(a)
+			sendTo(b)
+
+			Eventually(aRecv).Should(Receive())
+			Consistently(aRecv, 250*time.Millisecond).ShouldNot(Receive())
+		})
+	})
+})
+
+// multicastInterface returns an interface that is up, supports multicast and
+// has an IPv4 address, other than the loopback interface.
+func multicastInterface() (net.Interface, bool) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return net.Interface{}, false
+	}
+
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 ||
+			iface.Flags&net.FlagMulticast == 0 ||
+			iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+
+		for _, addr := range addrs {
+			if x, ok := addr.(*net.IPNet); ok && x.IP.To4() != nil {
+				return iface, true
+			}
+		}
+	}
+
+	return net.Interface{}, false
+}
+
+// receive reads packets from t until it is closed, and returns a channel of
+// those that contain a message with the same ID as m.
+func receive(t Transport, m *dns.Msg) chan *InboundPacket {
+	c := make(chan *InboundPacket, 10)
+
+	go func() {
+		for {
+			p, err := t.Read()
+			if err != nil {
+				return
+			}
+
+			if x, err := p.Message(); err == nil && x.Id == m.Id {
+				c <- p
+			} else {
+				p.Close()
+			}
+		}
+	}()
+
+	return c
+}
+
+// discardLogger is a logger that discards all messages, including the errors
+// logged when a transport is closed while reading.
+type discardLogger struct{}
+
+func (discardLogger) Log(string, ...interface{})   {}
+func (discardLogger) LogString(string)             {}
+func (discardLogger) Debug(string, ...interface{}) {}
+func (discardLogger) DebugString(string)           {}
+func (discardLogger) IsDebug() bool                { return false }
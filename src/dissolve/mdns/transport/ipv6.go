@@ -1,9 +1,9 @@
 package transport
 
 import (
-	"fmt"
 	"net"
 
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
 	"github.com/jmalloc/twelf/src/twelf"
 
 	ipvx "golang.org/x/net/ipv6"
@@ -22,21 +22,30 @@ var (
 
 	// IPv6ListenAddress is the address to which the mDNS server binds when using
 	// IPv6. Note that the multicast group address is NOT used in order to control
-	// more precisely which network interfaces join the multicast group.
-	IPv6ListenAddress = &net.UDPAddr{IP: net.ParseIP("ff02::"), Port: Port}
+	// more precisely which network interfaces join the multicast group, and so
+	// that direct unicast queries can be received.
+	//
+	// See https://tools.ietf.org/html/rfc6762#section-5.5.
+	IPv6ListenAddress = &net.UDPAddr{IP: net.IPv6unspecified, Port: Port}
 )
 
 // IPv6Transport is an IPv6-based UDP transport.
 type IPv6Transport struct {
 	Logger twelf.Logger
 
-	pc *ipvx.PacketConn
+	// Clock is used to determine which received packets are looped-back copies
+	// of packets sent by the transport. If it is nil, the system clock is
+	// used.
+	Clock clock.Clock
+
+	pc       *ipvx.PacketConn
+	loopback loopbackFilter
 }
 
-// Listen starts listening for UDP packets on the given interfaces.
-func (t *IPv6Transport) Listen(iface *net.Interface) error {
+// Listen starts listening for UDP packets.
+func (t *IPv6Transport) Listen() error {
 	addr := IPv6ListenAddress
-	conn, err := net.ListenUDP("udp6", addr)
+	conn, err := listenUDP("udp6", addr)
 	if err != nil {
 		logListenError(t.Logger, addr, err)
 		return err
@@ -44,29 +53,76 @@ func (t *IPv6Transport) Listen(iface *net.Interface) error {
 
 	t.pc = ipvx.NewPacketConn(conn)
 
-	err = t.pc.SetControlMessage(ipvx.FlagInterface, true)
+	err = t.pc.SetControlMessage(ipvx.FlagInterface|ipvx.FlagDst|ipvx.FlagHopLimit, true)
 	if err != nil {
 		t.pc.Close()
 		logListenError(t.Logger, addr, err)
 		return err
 	}
 
-	err = t.pc.JoinGroup(iface, &net.UDPAddr{
-		IP: IPv6Group,
-	})
-	if err != nil {
+	// https://tools.ietf.org/html/rfc6762#section-11
+	//
+	// All Multicast DNS responses (including responses sent via unicast)
+	// SHOULD be sent with IP TTL set to 255.
+	if err := t.setHopLimit(255); err != nil {
 		t.pc.Close()
 		logListenError(t.Logger, addr, err)
 		return err
 	}
 
-	logListening(t.Logger, addr, iface)
+	logListening(t.Logger, addr)
+
+	return nil
+}
+
+// Join joins the multicast group on the given interface.
+func (t *IPv6Transport) Join(iface *net.Interface) error {
+	if err := t.pc.JoinGroup(iface, &net.UDPAddr{
+		IP: IPv6Group,
+	}); err != nil {
+		logJoinError(t.Logger, t.Group(), iface, err)
+		return err
+	}
+
+	logJoined(t.Logger, t.Group(), iface)
+
+	return nil
+}
+
+// Leave leaves the multicast group on the given interface.
+func (t *IPv6Transport) Leave(iface *net.Interface) error {
+	if err := t.pc.LeaveGroup(iface, &net.UDPAddr{
+		IP: IPv6Group,
+	}); err != nil {
+		logLeaveError(t.Logger, t.Group(), iface, err)
+		return err
+	}
+
+	logLeft(t.Logger, t.Group(), iface)
 
 	return nil
 }
 
-// Read reads the next packet from the transport.
+// Read reads the next packet from the transport, ignoring any multicast packets
+// sent by the transport itself.
 func (t *IPv6Transport) Read() (*InboundPacket, error) {
+	for {
+		p, err := t.read()
+		if err != nil {
+			return nil, err
+		}
+
+		if !t.loopback.IsLoopback(p, now(t.Clock)) {
+			return p, nil
+		}
+
+		p.Close()
+	}
+}
+
+// read reads the next packet from the socket, including packets sent by this
+// transport that have been looped back.
+func (t *IPv6Transport) read() (*InboundPacket, error) {
 	buf := getBuffer()
 
 	n, cm, src, err := t.pc.ReadFrom(buf)
@@ -76,27 +132,30 @@ func (t *IPv6Transport) Read() (*InboundPacket, error) {
 		return nil, err
 	}
 
-	if cm == nil {
-		putBuffer(buf)
-		err := fmt.Errorf("empty control message from %s", src)
-		logReadError(t.Logger, t.Group(), err)
-		return nil, err
+	p := &InboundPacket{
+		Transport: t,
+		Source: Endpoint{
+			Address: src.(*net.UDPAddr),
+		},
+		HopLimit: -1,
+		Data:     buf[:n],
 	}
 
-	buf = buf[:n]
+	// the control message may be missing on some platforms, in which case the
+	// responder infers the interface from the source address.
+	if cm != nil {
+		p.Source.InterfaceIndex = cm.IfIndex
+		p.Destination = cm.Dst
+		p.HopLimit = cm.HopLimit
+	}
 
-	return &InboundPacket{
-		t,
-		Endpoint{
-			cm.IfIndex,
-			src.(*net.UDPAddr),
-		},
-		buf,
-	}, nil
+	return p, nil
 }
 
 // Write sends a packet via the transport.
 func (t *IPv6Transport) Write(p *OutboundPacket) error {
+	t.loopback.Sent(p, now(t.Clock))
+
 	if _, err := t.pc.WriteTo(
 		p.Data,
 		&ipvx.ControlMessage{
@@ -104,6 +163,7 @@ func (t *IPv6Transport) Write(p *OutboundPacket) error {
 		},
 		p.Destination.Address,
 	); err != nil {
+		t.loopback.Unsent(p)
 		logWriteError(t.Logger, p.Destination.Address, t.Group(), err)
 		return err
 	}
@@ -111,6 +171,16 @@ func (t *IPv6Transport) Write(p *OutboundPacket) error {
 	return nil
 }
 
+// setHopLimit sets the hop limit of both unicast and multicast packets sent via
+// the transport.
+func (t *IPv6Transport) setHopLimit(n int) error {
+	if err := t.pc.SetHopLimit(n); err != nil {
+		return err
+	}
+
+	return t.pc.SetMulticastHopLimit(n)
+}
+
 // Group returns the multicast group address for this transport.
 func (t *IPv6Transport) Group() *net.UDPAddr {
 	return IPv6GroupAddress
@@ -0,0 +1,36 @@
+package transport
+
+import (
+	"context"
+	"net"
+)
+
+// listenUDP opens a UDP socket bound to addr that can share its port with
+// other mDNS implementations running on the same host.
+//
+// https://tools.ietf.org/html/rfc6762#section-15.1
+//
+// In most operating systems, incoming *multicast* packets can be delivered
+// to *all* open sockets bound to the right port number, provided that the
+// clients take the appropriate steps to allow this. For this reason, all
+// Multicast DNS implementations SHOULD use the SO_REUSEPORT and/or
+// SO_REUSEADDR options (or equivalent as appropriate for the operating
+// system in question) so they will all be able to bind to UDP port 5353 and
+// receive incoming multicast packets addressed to that port.
+//
+// Note that unicast packets sent to the port are typically delivered to only
+// one of the sockets.
+//
+// The socket options are set via net.ListenConfig, which requires Go 1.11.
+func listenUDP(network string, addr *net.UDPAddr) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: reusePort,
+	}
+
+	conn, err := lc.ListenPacket(context.Background(), network, addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(*net.UDPConn), nil
+}
@@ -6,10 +6,25 @@ import (
 	"github.com/jmalloc/twelf/src/twelf"
 )
 
-func logListening(logger twelf.Logger, addr *net.UDPAddr, iface *net.Interface) {
+func logListening(logger twelf.Logger, addr *net.UDPAddr) {
 	logger.Debug(
-		"listening for mDNS requests on %s (%s)",
+		"listening for mDNS requests on %s",
 		addr,
+	)
+}
+
+func logJoined(logger twelf.Logger, addr *net.UDPAddr, iface *net.Interface) {
+	logger.Debug(
+		"joined mDNS multicast group %s on %s",
+		addr.IP,
+		iface.Name,
+	)
+}
+
+func logLeft(logger twelf.Logger, addr *net.UDPAddr, iface *net.Interface) {
+	logger.Debug(
+		"left mDNS multicast group %s on %s",
+		addr.IP,
 		iface.Name,
 	)
 }
@@ -25,3 +40,11 @@ func logReadError(logger twelf.Logger, addr *net.UDPAddr, err error) {
 func logWriteError(logger twelf.Logger, dest, addr *net.UDPAddr, err error) {
 	logger.Log("unable to send mDNS packet to %s via %s: %s", dest, addr, err)
 }
+
+func logJoinError(logger twelf.Logger, addr *net.UDPAddr, iface *net.Interface, err error) {
+	logger.Log("unable to join mDNS multicast group %s on %s: %s", addr.IP, iface.Name, err)
+}
+
+func logLeaveError(logger twelf.Logger, addr *net.UDPAddr, iface *net.Interface, err error) {
+	logger.Log("unable to leave mDNS multicast group %s on %s: %s", addr.IP, iface.Name, err)
+}
@@ -0,0 +1,146 @@
+package transport
+
+import (
+	"hash/fnv"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+)
+
+// loopbackWindow is the time within which a packet that a transport has sent
+// to its multicast group is expected to be looped back to it.
+const loopbackWindow = 1 * time.Second
+
+// loopbackFilter detects multicast packets that were sent by a transport and
+// have been looped back to it by the host's IP stack.
+//
+// The source address can not be used to identify these packets, as other mDNS
+// implementations on the same host send packets from the same address and
+// port. Instead, the filter remembers the content of each packet sent, and
+// matches it against the packets received on the same interface.
+type loopbackFilter struct {
+	m    sync.Mutex
+	sent map[loopbackKey][]time.Time
+}
+
+// now returns the current time according to c, or the system clock if c is
+// nil.
+func now(c clock.Clock) time.Time {
+	if c == nil {
+		return time.Now()
+	}
+
+	return c.Now()
+}
+
+// loopbackKey identifies the content of a packet and the interface it was sent
+// or received on.
+type loopbackKey struct {
+	Interface int
+	Hash      uint64
+}
+
+// newLoopbackKey returns the key for a packet containing data on the given
+// interface.
+func newLoopbackKey(iface int, data []byte) loopbackKey {
+	h := fnv.New64a()
+	h.Write(data)
+
+	return loopbackKey{iface, h.Sum64()}
+}
+
+// Sent records that p is being sent by the transport, at time t.
+//
+// It must be called before p is written to the socket, otherwise the
+// looped-back copy may be read before it is recorded. If the write fails,
+// Unsent() must be called to remove the record.
+func (f *loopbackFilter) Sent(p *OutboundPacket, t time.Time) {
+	if !p.Destination.Address.IP.IsMulticast() {
+		return
+	}
+
+	k := newLoopbackKey(p.Destination.InterfaceIndex, p.Data)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	if f.sent == nil {
+		f.sent = map[loopbackKey][]time.Time{}
+	}
+
+	f.expire(t)
+	f.sent[k] = append(f.sent[k], t)
+}
+
+// Unsent removes the record made by Sent() for a packet that could not be
+// written.
+func (f *loopbackFilter) Unsent(p *OutboundPacket) {
+	if !p.Destination.Address.IP.IsMulticast() {
+		return
+	}
+
+	k := newLoopbackKey(p.Destination.InterfaceIndex, p.Data)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	times := f.sent[k]
+
+	switch len(times) {
+	case 0:
+	case 1:
+		delete(f.sent, k)
+	default:
+		f.sent[k] = times[:len(times)-1]
+	}
+}
+
+// IsLoopback returns true if p, received at time t, is a looped-back copy of a
+// packet sent by the transport.
+//
+// Each packet sent is only matched once, so that an identical packet sent by
+// another mDNS implementation is not discarded.
+func (f *loopbackFilter) IsLoopback(p *InboundPacket, t time.Time) bool {
+	if !p.IsMulticast() {
+		return false
+	}
+
+	k := newLoopbackKey(p.Source.InterfaceIndex, p.Data)
+
+	f.m.Lock()
+	defer f.m.Unlock()
+
+	f.expire(t)
+
+	times, ok := f.sent[k]
+	if !ok {
+		return false
+	}
+
+	if len(times) == 1 {
+		delete(f.sent, k)
+	} else {
+		f.sent[k] = times[1:]
+	}
+
+	return true
+}
+
+// expire removes records of packets that were sent too long ago to still be
+// looped back.
+// It assumes f.m is already locked.
+func (f *loopbackFilter) expire(t time.Time) {
+	for k, times := range f.sent {
+		i := 0
+		for i < len(times) && t.Sub(times[i]) > loopbackWindow {
+			i++
+		}
+
+		if i == len(times) {
+			delete(f.sent, k)
+		} else {
+			f.sent[k] = times[i:]
+		}
+	}
+}
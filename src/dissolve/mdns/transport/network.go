@@ -0,0 +1,51 @@
+package transport
+
+import "net"
+
+// Network is a source of network interfaces on which transports can join their
+// multicast groups.
+type Network interface {
+	// Interfaces returns the available network interfaces.
+	Interfaces() ([]net.Interface, error)
+
+	// Addrs returns the unicast addresses assigned to iface, which must be one
+	// of the network's interfaces.
+	Addrs(iface net.Interface) ([]net.Addr, error)
+}
+
+// SystemNetwork is a network that provides the host's real network interfaces.
+type SystemNetwork struct{}
+
+// Interfaces returns the available network interfaces.
+func (SystemNetwork) Interfaces() ([]net.Interface, error) {
+	return net.Interfaces()
+}
+
+// Addrs returns the unicast addresses assigned to iface.
+func (SystemNetwork) Addrs(iface net.Interface) ([]net.Addr, error) {
+	return iface.Addrs()
+}
+
+// interfaceMTUs is an optional interface implemented by transports that can
+// report the MTU of the interfaces on which they have joined their multicast
+// group, such as VirtualTransport.
+type interfaceMTUs interface {
+	InterfaceMTU(index int) (int, bool)
+}
+
+// InterfaceMTU returns the MTU of the interface with the given index, as used by
+// t, or false if it can not be determined.
+//
+// Transports that wrap another transport should implement an InterfaceMTU()
+// method that calls this function with the wrapped transport.
+func InterfaceMTU(t Transport, index int) (int, bool) {
+	if x, ok := t.(interfaceMTUs); ok {
+		return x.InterfaceMTU(index)
+	}
+
+	if iface, err := net.InterfaceByIndex(index); err == nil && iface.MTU > 0 {
+		return iface.MTU, true
+	}
+
+	return 0, false
+}
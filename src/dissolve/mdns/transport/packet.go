@@ -1,6 +1,8 @@
 package transport
 
 import (
+	"net"
+
 	"github.com/miekg/dns"
 )
 
@@ -8,7 +10,69 @@ import (
 type InboundPacket struct {
 	Transport Transport
 	Source    Endpoint
-	Data      []byte
+
+	// Destination is the IP address to which the packet was sent, which is
+	// either the transport's multicast group address, or a unicast address of
+	// this host. It is nil if the destination is not known.
+	Destination net.IP
+
+	// HopLimit is the IP TTL (IPv4) or hop limit (IPv6) of the packet as it was
+	// received, or a negative number if it is not known.
+	HopLimit int
+
+	Data []byte
+}
+
+// maxHopLimit is the IP TTL or hop limit with which mDNS packets are sent.
+// A packet received with this hop limit can not have been forwarded by a
+// router.
+const maxHopLimit = 255
+
+// IsMulticast returns true if the packet was sent to a multicast address.
+func (p *InboundPacket) IsMulticast() bool {
+	return p.Destination != nil && p.Destination.IsMulticast()
+}
+
+// IsOnLink returns true if the packet can be shown to have originated on the
+// local link, that is, on the network attached to the interface on which it
+// was received.
+//
+// prefixes is the set of network prefixes assigned to that interface.
+//
+// See https://tools.ietf.org/html/rfc6762#section-11.
+func (p *InboundPacket) IsOnLink(prefixes []*net.IPNet) bool {
+	// All responses received with a destination address in the IP header that
+	// is the mDNS IPv4 link-local multicast address 224.0.0.251 or the mDNS
+	// IPv6 link-local multicast address FF02::FB are necessarily deemed to
+	// have originated on the local link, regardless of source IP address.
+	if p.IsMulticast() {
+		return true
+	}
+
+	// a packet that still has the maximum hop limit has not passed through a
+	// router, whereas one with a lower hop limit has been forwarded, whatever
+	// its source address claims.
+	if p.HopLimit == maxHopLimit {
+		return true
+	} else if p.HopLimit >= 0 {
+		return false
+	}
+
+	ip := p.Source.Address.IP
+	if ip.IsLinkLocalUnicast() {
+		return true
+	}
+
+	// Other responses (sent via unicast) are deemed to have originated on the
+	// local link if and only if the source IP address in the IP header matches
+	// a prefix of the local interface on which the packet was received.
+	for _, n := range prefixes {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
 }
 
 // Message returns the DNS message contained in a packet.
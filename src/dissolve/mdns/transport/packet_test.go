@@ -0,0 +1,69 @@
+package transport_test
+
+import (
+	"net"
+
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("InboundPacket", func() {
+	Describe("IsOnLink", func() {
+		var (
+			p        *InboundPacket
+			prefixes []*net.IPNet
+		)
+
+		BeforeEach(func() {
+			p = &InboundPacket{
+				Source: Endpoint{
+					Address: &net.UDPAddr{
+						IP:   net.ParseIP("10.0.0.20"),
+						Port: Port,
+					},
+				},
+				Destination: net.ParseIP("192.168.1.10"),
+				HopLimit:    64,
+			}
+
+			prefixes = []*net.IPNet{cidr("192.168.1.10/24")}
+		})
+
+		It("returns false for unicast packets from sources outside of the prefixes", func() {
+			Expect(p.IsOnLink(prefixes)).To(BeFalse())
+		})
+
+		It("returns true for unicast packets from sources within the prefixes", func() {
+			p.Source.Address.IP = net.ParseIP("192.168.1.20")
+			p.HopLimit = -1
+			Expect(p.IsOnLink(prefixes)).To(BeTrue())
+		})
+
+		It("returns false for forwarded packets from sources within the prefixes", func() {
+			p.Source.Address.IP = net.ParseIP("192.168.1.20")
+			Expect(p.IsOnLink(prefixes)).To(BeFalse())
+		})
+
+		It("returns true for packets sent to the multicast group", func() {
+			p.Destination = IPv4GroupAddress.IP
+			Expect(p.IsOnLink(prefixes)).To(BeTrue())
+		})
+
+		It("returns true for packets that have not passed through a router", func() {
+			p.HopLimit = 255
+			Expect(p.IsOnLink(prefixes)).To(BeTrue())
+		})
+
+		It("returns false for packets with an unknown hop limit", func() {
+			p.HopLimit = -1
+			Expect(p.IsOnLink(prefixes)).To(BeFalse())
+		})
+
+		It("returns true for packets from link-local sources", func() {
+			p.Source.Address.IP = net.ParseIP("fe80::1")
+			p.HopLimit = -1
+			Expect(p.IsOnLink(prefixes)).To(BeTrue())
+		})
+	})
+})
@@ -0,0 +1,11 @@
+//+build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd,!windows
+
+package transport
+
+import "syscall"
+
+// reusePort does nothing on this platform, the port can not be shared with
+// other mDNS implementations.
+func reusePort(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,26 @@
+//+build darwin dragonfly freebsd linux netbsd openbsd
+
+package transport
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePort sets the SO_REUSEADDR and SO_REUSEPORT options on a socket before
+// it is bound, so that other sockets may bind to the same port.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var err error
+
+	if cerr := c.Control(func(fd uintptr) {
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1)
+		if err == nil {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+		}
+	}); cerr != nil {
+		return cerr
+	}
+
+	return err
+}
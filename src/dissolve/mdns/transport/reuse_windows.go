@@ -0,0 +1,20 @@
+//+build windows
+
+package transport
+
+import "syscall"
+
+// reusePort sets the SO_REUSEADDR option on a socket before it is bound, so
+// that other sockets may bind to the same port. Windows does not support
+// SO_REUSEPORT, SO_REUSEADDR alone allows the port to be shared.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var err error
+
+	if cerr := c.Control(func(fd uintptr) {
+		err = syscall.SetsockoptInt(syscall.Handle(fd), syscall.SOL_SOCKET, syscall.SO_REUSEADDR, 1)
+	}); cerr != nil {
+		return cerr
+	}
+
+	return err
+}
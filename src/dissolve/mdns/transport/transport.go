@@ -3,6 +3,7 @@ package transport
 import (
 	"net"
 
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
 	"github.com/miekg/dns"
 )
 
@@ -11,8 +12,14 @@ const Port = 5353
 
 // Transport is an interface for communicating via UDP.
 type Transport interface {
-	// Listen starts listening for UDP packets on the given interface.
-	Listen(iface *net.Interface) error
+	// Listen starts listening for UDP packets.
+	Listen() error
+
+	// Join joins the transport's multicast group on the given interface.
+	Join(iface *net.Interface) error
+
+	// Leave leaves the transport's multicast group on the given interface.
+	Leave(iface *net.Interface) error
 
 	// Read reads the next packet from the transport.
 	Read() (*InboundPacket, error)
@@ -27,27 +34,120 @@ type Transport interface {
 	Close() error
 }
 
-// SendResponse sends a DNS message as a response to an inbound packet.
-func SendResponse(in *InboundPacket, to *net.UDPAddr, m *dns.Msg) (bool, error) {
+const (
+	// defaultMTU is the MTU assumed when the MTU of the destination interface
+	// can not be determined.
+	defaultMTU = 1500
+
+	// udpHeaderSize is the size of a UDP header.
+	udpHeaderSize = 8
+
+	// ipv4HeaderSize is the size of an IPv4 header, without options.
+	ipv4HeaderSize = 20
+
+	// ipv6HeaderSize is the size of an IPv6 header, without extension headers.
+	ipv6HeaderSize = 40
+)
+
+// Send sends a DNS message to dest via t.
+//
+// Responses that are too large to fit in a single packet on the destination
+// interface are split across multiple packets, unless dest is a legacy querier,
+// in which case the response is truncated.
+//
+// It returns false if m is a response that does not contain any records, or a
+// query that does not contain any questions or records, in which case nothing
+// is sent.
+func Send(t Transport, dest Endpoint, m *dns.Msg) (bool, error) {
 	if len(m.Answer) == 0 &&
 		len(m.Ns) == 0 &&
-		len(m.Extra) == 0 {
+		len(m.Extra) == 0 &&
+		(m.Response || len(m.Question) == 0) {
 		return false, nil
 	}
 
-	out, err := NewOutboundPacket(
+	messages := []*dns.Msg{m}
+
+	if m.Response {
+		size := maxMessageSize(t, dest)
+
+		if dest.IsLegacy() {
+			// legacy queriers only expect a single response packet, so
+			// oversize responses are truncated as they would be by a
+			// conventional unicast DNS server.
+			m.Truncate(size)
+		} else {
+			messages = mdns.SplitResponse(m, size)
+		}
+	}
+
+	for _, x := range messages {
+		if err := send(t, dest, x); err != nil {
+			return false, err
+		}
+	}
+
+	return true, nil
+}
+
+// send marshals m into a single packet and sends it to dest via t.
+func send(t Transport, dest Endpoint, m *dns.Msg) error {
+	out, err := NewOutboundPacket(dest, m)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return t.Write(out)
+}
+
+// maxMessageSize returns the size of the largest DNS message that can be sent
+// to dest via t without exceeding the MTU of the destination interface.
+//
+// See https://tools.ietf.org/html/rfc6762#section-17.
+func maxMessageSize(t Transport, dest Endpoint) int {
+	mtu := defaultMTU
+
+	if n, ok := InterfaceMTU(t, dest.InterfaceIndex); ok {
+		mtu = n
+	}
+
+	// Even when fragmentation is used, a Multicast DNS packet, including IP
+	// and UDP headers, MUST NOT exceed 9000 bytes.
+	if mtu > mdns.MaxPacketSize {
+		mtu = mdns.MaxPacketSize
+	}
+
+	if dest.Address.IP.To4() != nil {
+		return mtu - ipv4HeaderSize - udpHeaderSize
+	}
+
+	return mtu - ipv6HeaderSize - udpHeaderSize
+}
+
+// SendMulticast sends a DNS message to t's multicast group via the given
+// interface.
+func SendMulticast(t Transport, iface *net.Interface, m *dns.Msg) (bool, error) {
+	return Send(
+		t,
+		Endpoint{
+			InterfaceIndex: iface.Index,
+			Address:        t.Group(),
+		},
+		m,
+	)
+}
+
+// SendResponse sends a DNS message as a response to an inbound packet.
+func SendResponse(in *InboundPacket, to *net.UDPAddr, m *dns.Msg) (bool, error) {
+	return Send(
+		in.Transport,
 		Endpoint{
 			InterfaceIndex: in.Source.InterfaceIndex,
 			Address:        to,
 		},
 		m,
 	)
-	if err != nil {
-		return false, err
-	}
-	defer out.Close()
-
-	return true, in.Transport.Write(out)
 }
 
 // SendUnicastResponse sends a DNS message as a unicast response to an inbound
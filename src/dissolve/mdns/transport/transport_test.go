@@ -0,0 +1,183 @@
+package transport_test
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Send", func() {
+	var (
+		link           *Link
+		sender, target *VirtualTransport
+		iface          net.Interface
+	)
+
+	BeforeEach(func() {
+		// a small MTU, so that large responses must be split
+		link = &Link{MTU: 576}
+		a := link.NewInterface("eth0", cidr("192.168.1.10/24"))
+		b := link.NewInterface("eth1", cidr("192.168.1.20/24"))
+
+		sender = NewVirtualTransport(VirtualNetwork{a})
+		target = NewVirtualTransport(VirtualNetwork{b})
+
+		iface = a.Interface()
+		Expect(sender.Join(&iface)).To(Succeed())
+
+		ifaceB := b.Interface()
+		Expect(target.Join(&ifaceB)).To(Succeed())
+	})
+
+	// response returns a response containing n PTR records.
+	response := func(n int) *dns.Msg {
+		m := mdns.NewResponse(mdns.NewQuery(false), false)
+
+		for i := 0; i < n; i++ {
+			m.Answer = append(m.Answer, rr(fmt.Sprintf(
+				"_http._tcp.local. 4500 IN PTR instance-%d._http._tcp.local.",
+				i,
+			)))
+		}
+
+		return m
+	}
+
+	AfterEach(func() {
+		sender.Close()
+		target.Close()
+	})
+
+	It("sends queries that only contain questions", func() {
+		m := mdns.NewQuery(false, dns.Question{
+			Name:   "host.local.",
+			Qtype:  dns.TypeA,
+			Qclass: dns.ClassINET,
+		})
+
+		sent, err := SendMulticast(sender, &iface, m)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sent).To(BeTrue())
+
+		p, err := target.Read()
+		Expect(err).ShouldNot(HaveOccurred())
+		defer p.Close()
+
+		x, err := p.Message()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(x.Question).To(Equal(m.Question))
+	})
+
+	It("does not send responses that do not contain any records", func() {
+		m := mdns.NewResponse(
+			mdns.NewQuery(false, dns.Question{
+				Name:   "host.local.",
+				Qtype:  dns.TypeA,
+				Qclass: dns.ClassINET,
+			}),
+			true,
+		)
+
+		sent, err := SendMulticast(sender, &iface, m)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sent).To(BeFalse())
+	})
+
+	It("does not send queries that do not contain any questions or records", func() {
+		sent, err := SendMulticast(sender, &iface, mdns.NewQuery(false))
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sent).To(BeFalse())
+	})
+
+	It("splits responses that are larger than the interface MTU across multiple packets", func() {
+		m := response(30)
+		Expect(m.Len()).To(BeNumerically(">", 576))
+
+		sent, err := SendMulticast(sender, &iface, m)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sent).To(BeTrue())
+
+		var (
+			packets int
+			records []dns.RR
+		)
+
+		for p := read(target); p != nil; p = read(target) {
+			packets++
+
+			// 20 bytes of IPv4 header and 8 bytes of UDP header
+			Expect(len(p.Data) + 28).To(BeNumerically("<=", 576))
+
+			x, err := p.Message()
+			Expect(err).ShouldNot(HaveOccurred())
+			records = append(records, x.Answer...)
+
+			p.Close()
+		}
+
+		Expect(packets).To(BeNumerically(">", 1))
+		Expect(records).To(HaveLen(len(m.Answer)))
+
+		for i, x := range records {
+			Expect(x.String()).To(Equal(m.Answer[i].String()))
+		}
+	})
+
+	It("truncates responses to legacy queriers that are larger than the interface MTU", func() {
+		target.Port = 12345
+
+		sent, err := Send(
+			sender,
+			Endpoint{
+				InterfaceIndex: iface.Index,
+				Address: &net.UDPAddr{
+					IP:   net.ParseIP("192.168.1.20"),
+					Port: target.Port,
+				},
+			},
+			response(30),
+		)
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(sent).To(BeTrue())
+
+		p := read(target)
+		Expect(p).NotTo(BeNil())
+		defer p.Close()
+
+		x, err := p.Message()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(x.Truncated).To(BeTrue())
+		Expect(x.Answer).NotTo(BeEmpty())
+		Expect(len(x.Answer)).To(BeNumerically("<", 30))
+
+		Expect(read(target)).To(BeNil())
+	})
+})
+
+// cidr parses s as an IP address with a network prefix, such as
+// "192.168.1.10/24".
+func cidr(s string) *net.IPNet {
+	ip, n, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	n.IP = ip
+
+	return n
+}
+
+// rr parses s as a resource record.
+func rr(s string) dns.RR {
+	r, err := dns.NewRR(s)
+	if err != nil {
+		panic(err)
+	}
+
+	return r
+}
@@ -0,0 +1,527 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+)
+
+// firstVirtualIndex is the index of the first virtual interface. Virtual
+// interfaces are numbered well above the indices of any real interfaces, so
+// that the two can not be confused.
+const firstVirtualIndex = 1 << 20
+
+// nextVirtualIndex is the index assigned to the next virtual interface, less
+// one. Indices are unique within the process, so that interfaces on different
+// links can be combined in a single VirtualNetwork.
+var nextVirtualIndex int64 = firstVirtualIndex - 1
+
+// errClosed is the error returned when using a closed virtual transport.
+// It uses the same message as the net package so that it is recognized in the
+// same way as the error from a closed socket.
+var errClosed = errors.New("use of closed network connection")
+
+// Link is a simulated network link that carries packets between the virtual
+// interfaces attached to it, allowing several responders and queriers to
+// communicate within a single process.
+//
+// The zero value is a perfect link, with no latency or packet loss.
+type Link struct {
+	// Latency is the time it takes for a packet to reach each interface.
+	Latency time.Duration
+
+	// Jitter is the maximum random delay added to the latency of each packet.
+	// Packets with different delays may be delivered in a different order to
+	// that in which they were sent.
+	Jitter time.Duration
+
+	// Loss is the probability, between 0 and 1, that a packet is not
+	// delivered to an interface.
+	Loss float64
+
+	// Duplication is the probability, between 0 and 1, that a packet is
+	// delivered to an interface twice. Each copy is delayed independently.
+	Duplication float64
+
+	// MTU is the maximum size of a packet, including IP and UDP headers.
+	// Larger packets are dropped. If it is zero, the default of 1500 is used.
+	MTU int
+
+	// Clock is used to delay the delivery of packets. If it is nil, the
+	// system clock is used.
+	Clock clock.Clock
+
+	// Rand is the source of the random numbers used to simulate jitter, loss
+	// and duplication. If it is nil, a source seeded from the current time is
+	// used.
+	Rand rand.Source
+
+	m       sync.Mutex
+	rand    *rand.Rand
+	members map[member]struct{}
+}
+
+// member is a transport that has joined its multicast group on one of a link's
+// interfaces.
+type member struct {
+	Transport *VirtualTransport
+	Interface *VirtualInterface
+}
+
+// delivery is a packet that is to be delivered to a member of a link.
+type delivery struct {
+	To     member
+	Delay  time.Duration
+	Packet *InboundPacket
+}
+
+// NewInterface attaches a new virtual interface to the link.
+//
+// addrs is the set of unicast addresses, and network prefixes, assigned to the
+// interface.
+func (l *Link) NewInterface(name string, addrs ...*net.IPNet) *VirtualInterface {
+	return &VirtualInterface{
+		link:  l,
+		addrs: addrs,
+		iface: net.Interface{
+			Index: int(atomic.AddInt64(&nextVirtualIndex, 1)),
+			MTU:   l.mtu(),
+			Name:  name,
+			Flags: net.FlagUp | net.FlagBroadcast | net.FlagMulticast,
+		},
+	}
+}
+
+// mtu returns the link's MTU.
+func (l *Link) mtu() int {
+	if l.MTU == 0 {
+		return defaultMTU
+	}
+
+	return l.MTU
+}
+
+// join adds m to the link's members.
+func (l *Link) join(m member) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	if l.members == nil {
+		l.members = map[member]struct{}{}
+	}
+
+	l.members[m] = struct{}{}
+}
+
+// leave removes m from the link's members.
+func (l *Link) leave(m member) {
+	l.m.Lock()
+	defer l.m.Unlock()
+
+	delete(l.members, m)
+}
+
+// transmit sends a packet from the member "from" to dest via the link, using
+// src as the source address.
+//
+// Multicast packets are delivered to every member that has joined the
+// multicast group, except for the sender itself, as the real transports ignore
+// their own packets when the host's IP stack loops them back. Unicast packets
+// are delivered to the member with the destination address and port.
+func (l *Link) transmit(from member, src, dest *net.UDPAddr, data []byte) {
+	size := len(data) + udpHeaderSize
+	if src.IP.To4() != nil {
+		size += ipv4HeaderSize
+	} else {
+		size += ipv6HeaderSize
+	}
+
+	if size > l.mtu() {
+		return
+	}
+
+	var deliveries []delivery
+
+	l.m.Lock()
+
+	if l.rand == nil {
+		s := l.Rand
+		if s == nil {
+			s = rand.NewSource(time.Now().UnixNano())
+		}
+		l.rand = rand.New(s)
+	}
+
+	for m := range l.members {
+		if m == from || !m.accepts(dest) {
+			continue
+		}
+
+		if l.rand.Float64() < l.Loss {
+			continue
+		}
+
+		copies := 1
+		if l.rand.Float64() < l.Duplication {
+			copies++
+		}
+
+		for i := 0; i < copies; i++ {
+			delay := l.Latency
+			if l.Jitter > 0 {
+				delay += time.Duration(l.rand.Int63n(int64(l.Jitter) + 1))
+			}
+
+			deliveries = append(deliveries, delivery{
+				To:    m,
+				Delay: delay,
+				Packet: &InboundPacket{
+					Transport:   m.Transport,
+					Source:      Endpoint{m.Interface.iface.Index, src},
+					Destination: dest.IP,
+					HopLimit:    maxHopLimit,
+					Data:        append(getBuffer()[:0], data...),
+				},
+			})
+		}
+	}
+
+	l.m.Unlock()
+
+	c := l.Clock
+	if c == nil {
+		c = clock.System{}
+	}
+
+	for _, d := range deliveries {
+		if d.Delay <= 0 {
+			d.To.Transport.deliver(d.Packet)
+			continue
+		}
+
+		// the timer is started before the goroutine so that a fake clock can
+		// be advanced as soon as transmit() returns.
+		t := c.NewTimer(d.Delay)
+		go func(d delivery) {
+			defer t.Stop()
+
+			select {
+			case <-t.C():
+				d.To.Transport.deliver(d.Packet)
+			case <-d.To.Transport.done:
+				d.Packet.Close()
+			}
+		}(d)
+	}
+}
+
+// accepts returns true if a packet sent to dest should be delivered to m.
+//
+// As with a real socket, the destination port must match the transport's port,
+// so a legacy querier does not receive packets sent to the mDNS port.
+func (m member) accepts(dest *net.UDPAddr) bool {
+	if dest.Port != m.Transport.port() {
+		return false
+	}
+
+	if dest.IP.IsMulticast() {
+		return dest.IP.Equal(m.Transport.Group().IP)
+	}
+
+	return m.Interface.hasAddr(dest.IP)
+}
+
+// VirtualInterface is a simulated network interface attached to a Link.
+//
+// Virtual interfaces can only be used with virtual transports, and only by way
+// of a VirtualNetwork that contains them.
+type VirtualInterface struct {
+	link  *Link
+	iface net.Interface
+	addrs []*net.IPNet
+}
+
+// Interface returns the network interface, as used by the responder.
+func (vi *VirtualInterface) Interface() net.Interface {
+	return vi.iface
+}
+
+// Link returns the link to which the interface is attached.
+func (vi *VirtualInterface) Link() *Link {
+	return vi.link
+}
+
+// Addrs returns the unicast addresses assigned to the interface.
+func (vi *VirtualInterface) Addrs() []net.Addr {
+	addrs := make([]net.Addr, len(vi.addrs))
+	for i, a := range vi.addrs {
+		addrs[i] = a
+	}
+
+	return addrs
+}
+
+// addr returns the interface's first address in the same family as group.
+func (vi *VirtualInterface) addr(group net.IP) net.IP {
+	v4 := group.To4() != nil
+
+	for _, a := range vi.addrs {
+		if (a.IP.To4() != nil) == v4 {
+			return a.IP
+		}
+	}
+
+	if v4 {
+		return net.IPv4zero
+	}
+
+	return net.IPv6unspecified
+}
+
+// hasAddr returns true if ip is one of the interface's addresses.
+func (vi *VirtualInterface) hasAddr(ip net.IP) bool {
+	for _, a := range vi.addrs {
+		if a.IP.Equal(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// VirtualNetwork is a network made up of virtual interfaces.
+type VirtualNetwork []*VirtualInterface
+
+// Interfaces returns the available network interfaces.
+func (n VirtualNetwork) Interfaces() ([]net.Interface, error) {
+	ifaces := make([]net.Interface, len(n))
+	for i, vi := range n {
+		ifaces[i] = vi.iface
+	}
+
+	return ifaces, nil
+}
+
+// Addrs returns the unicast addresses assigned to iface.
+func (n VirtualNetwork) Addrs(iface net.Interface) ([]net.Addr, error) {
+	vi, err := n.lookup(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	return vi.Addrs(), nil
+}
+
+// lookup returns the virtual interface that corresponds to iface.
+func (n VirtualNetwork) lookup(iface net.Interface) (*VirtualInterface, error) {
+	for _, vi := range n {
+		if vi.iface.Index == iface.Index {
+			return vi, nil
+		}
+	}
+
+	return nil, fmt.Errorf("%s is not an interface on this virtual network", iface.Name)
+}
+
+// VirtualTransport is an in-memory transport that sends and receives packets
+// via the links of virtual interfaces.
+//
+// Virtual transports must be created with NewVirtualTransport().
+type VirtualTransport struct {
+	// IPv6 indicates whether the transport uses IPv6 rather than IPv4.
+	IPv6 bool
+
+	// Port is the UDP port from which packets are sent, and to which unicast
+	// packets must be sent to reach the transport. If it is zero, the mDNS
+	// port is used. Any other port simulates a "legacy" querier.
+	Port int
+
+	network VirtualNetwork
+	m       sync.Mutex
+	joined  map[int]member
+	queue   chan *InboundPacket
+	done    chan struct{}
+	closed  bool
+}
+
+// virtualQueueSize is the number of packets that can be queued for reading by
+// a virtual transport. Further packets are dropped, as they would be if the
+// receive buffer of a real socket was full.
+const virtualQueueSize = 256
+
+// NewVirtualTransport returns a new virtual transport that can join its
+// multicast group on the interfaces of n.
+func NewVirtualTransport(n VirtualNetwork) *VirtualTransport {
+	return &VirtualTransport{
+		network: n,
+		joined:  map[int]member{},
+		queue:   make(chan *InboundPacket, virtualQueueSize),
+		done:    make(chan struct{}),
+	}
+}
+
+// Listen starts listening for UDP packets.
+func (t *VirtualTransport) Listen() error {
+	return nil
+}
+
+// Join joins the multicast group on the given interface, which must be one of
+// the interfaces of the transport's virtual network.
+func (t *VirtualTransport) Join(iface *net.Interface) error {
+	vi, err := t.network.lookup(*iface)
+	if err != nil {
+		return err
+	}
+
+	m := member{t, vi}
+
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.closed {
+		return t.closedError("join")
+	}
+
+	t.joined[iface.Index] = m
+
+	vi.link.join(m)
+
+	return nil
+}
+
+// Leave leaves the multicast group on the given interface.
+func (t *VirtualTransport) Leave(iface *net.Interface) error {
+	t.m.Lock()
+	m, ok := t.joined[iface.Index]
+	delete(t.joined, iface.Index)
+	t.m.Unlock()
+
+	if ok {
+		m.Interface.link.leave(m)
+	}
+
+	return nil
+}
+
+// Read reads the next packet from the transport.
+func (t *VirtualTransport) Read() (*InboundPacket, error) {
+	select {
+	case p := <-t.queue:
+		return p, nil
+	case <-t.done:
+		return nil, t.closedError("read")
+	}
+}
+
+// Write sends a packet via the transport.
+func (t *VirtualTransport) Write(p *OutboundPacket) error {
+	t.m.Lock()
+	m, ok := t.joined[p.Destination.InterfaceIndex]
+	closed := t.closed
+	t.m.Unlock()
+
+	if closed {
+		return t.closedError("write")
+	}
+
+	if !ok {
+		return fmt.Errorf(
+			"can not send to %s via interface %d, the transport has not joined its multicast group on that interface",
+			p.Destination.Address,
+			p.Destination.InterfaceIndex,
+		)
+	}
+
+	src := &net.UDPAddr{
+		IP:   m.Interface.addr(t.Group().IP),
+		Port: t.port(),
+	}
+
+	m.Interface.link.transmit(m, src, p.Destination.Address, p.Data)
+
+	return nil
+}
+
+// Group returns the multicast group address for this transport.
+func (t *VirtualTransport) Group() *net.UDPAddr {
+	if t.IPv6 {
+		return IPv6GroupAddress
+	}
+
+	return IPv4GroupAddress
+}
+
+// Close closes the transport, preventing further reads and writes.
+func (t *VirtualTransport) Close() error {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if t.closed {
+		return nil
+	}
+
+	t.closed = true
+	close(t.done)
+
+	for i, m := range t.joined {
+		m.Interface.link.leave(m)
+		delete(t.joined, i)
+	}
+
+	return nil
+}
+
+// InterfaceMTU returns the MTU of the interface with the given index, or false
+// if the transport has not joined its multicast group on that interface.
+func (t *VirtualTransport) InterfaceMTU(index int) (int, bool) {
+	t.m.Lock()
+	defer t.m.Unlock()
+
+	if m, ok := t.joined[index]; ok {
+		return m.Interface.iface.MTU, true
+	}
+
+	return 0, false
+}
+
+// closedError returns the error produced by operations on a closed transport.
+func (t *VirtualTransport) closedError(op string) error {
+	return &net.OpError{
+		Op:   op,
+		Net:  "udp",
+		Addr: t.Group(),
+		Err:  errClosed,
+	}
+}
+
+// port returns the UDP port used by the transport.
+func (t *VirtualTransport) port() int {
+	if t.Port == 0 {
+		return Port
+	}
+
+	return t.Port
+}
+
+// deliver queues p to be read from the transport. It is dropped if the queue
+// is full or the transport has been closed.
+func (t *VirtualTransport) deliver(p *InboundPacket) {
+	select {
+	case <-t.done:
+		p.Close()
+		return
+	default:
+	}
+
+	select {
+	case t.queue <- p:
+	default:
+		p.Close()
+	}
+}
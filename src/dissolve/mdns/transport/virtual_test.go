@@ -0,0 +1,291 @@
+package transport_test
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/jmalloc/dissolve/src/dissolve/mdns"
+	"github.com/jmalloc/dissolve/src/dissolve/mdns/clock"
+	. "github.com/jmalloc/dissolve/src/dissolve/mdns/transport"
+	"github.com/miekg/dns"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("VirtualTransport", func() {
+	var (
+		link                   *Link
+		ifaceA, ifaceB         net.Interface
+		transportA, transportB *VirtualTransport
+		query                  *dns.Msg
+	)
+
+	BeforeEach(func() {
+		link = &Link{}
+
+		a := link.NewInterface("eth0", cidr("192.168.1.10/24"))
+		b := link.NewInterface("eth1", cidr("192.168.1.20/24"))
+
+		transportA = NewVirtualTransport(VirtualNetwork{a})
+		transportB = NewVirtualTransport(VirtualNetwork{b})
+
+		ifaceA = a.Interface()
+		ifaceB = b.Interface()
+
+		Expect(transportA.Join(&ifaceA)).To(Succeed())
+		Expect(transportB.Join(&ifaceB)).To(Succeed())
+
+		query = mdns.NewQuery(false, dns.Question{
+			Name:   "host.local.",
+			Qtype:  dns.TypeA,
+			Qclass: dns.ClassINET,
+		})
+	})
+
+	AfterEach(func() {
+		transportA.Close()
+		transportB.Close()
+	})
+
+	It("delivers multicast packets to the other transports on the link", func() {
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		p := read(transportB)
+		Expect(p).NotTo(BeNil())
+		defer p.Close()
+
+		Expect(p.Transport).To(Equal(transportB))
+		Expect(p.Source.InterfaceIndex).To(Equal(ifaceB.Index))
+		Expect(p.Source.Address.IP.Equal(net.ParseIP("192.168.1.10"))).To(BeTrue())
+		Expect(p.Source.Address.Port).To(Equal(Port))
+		Expect(p.Destination.Equal(IPv4GroupAddress.IP)).To(BeTrue())
+		Expect(p.HopLimit).To(Equal(255))
+
+		m, err := p.Message()
+		Expect(err).ShouldNot(HaveOccurred())
+		Expect(m.Question).To(Equal(query.Question))
+	})
+
+	It("only delivers unicast packets to the transport with the destination address", func() {
+		c := link.NewInterface("eth2", cidr("192.168.1.30/24"))
+		ifaceC := c.Interface()
+		transportC := NewVirtualTransport(VirtualNetwork{c})
+		defer transportC.Close()
+		Expect(transportC.Join(&ifaceC)).To(Succeed())
+
+		_, err := Send(
+			transportA,
+			Endpoint{
+				InterfaceIndex: ifaceA.Index,
+				Address:        &net.UDPAddr{IP: net.ParseIP("192.168.1.30"), Port: Port},
+			},
+			query,
+		)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		p := read(transportC)
+		Expect(p).NotTo(BeNil())
+		Expect(p.Destination.Equal(net.ParseIP("192.168.1.30"))).To(BeTrue())
+		p.Close()
+
+		Expect(read(transportB)).To(BeNil())
+	})
+
+	It("does not deliver packets to interfaces on other links", func() {
+		other := (&Link{}).NewInterface("eth2", cidr("192.168.1.30/24"))
+		ifaceC := other.Interface()
+		transportC := NewVirtualTransport(VirtualNetwork{other})
+		defer transportC.Close()
+		Expect(transportC.Join(&ifaceC)).To(Succeed())
+
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(read(transportC)).To(BeNil())
+	})
+
+	It("does not deliver packets to transports that have left the multicast group", func() {
+		Expect(transportB.Leave(&ifaceB)).To(Succeed())
+
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(read(transportB)).To(BeNil())
+	})
+
+	It("delays packets by the link's latency", func() {
+		c := clock.NewFake(time.Now())
+		link.Clock = c
+		link.Latency = 100 * time.Millisecond
+
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		c.Advance(99 * time.Millisecond)
+		Expect(read(transportB)).To(BeNil())
+
+		c.Advance(1 * time.Millisecond)
+		p := read(transportB)
+		Expect(p).NotTo(BeNil())
+		p.Close()
+	})
+
+	It("adds a random delay of up to the link's jitter", func() {
+		c := clock.NewFake(time.Now())
+		link.Clock = c
+		link.Latency = 100 * time.Millisecond
+		link.Jitter = 50 * time.Millisecond
+
+		for i := 0; i < 10; i++ {
+			_, err := SendMulticast(transportA, &ifaceA, query)
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		c.Advance(99 * time.Millisecond)
+		Expect(read(transportB)).To(BeNil())
+
+		c.Advance(51 * time.Millisecond)
+		for i := 0; i < 10; i++ {
+			p := read(transportB)
+			Expect(p).NotTo(BeNil())
+			p.Close()
+		}
+	})
+
+	It("drops packets according to the link's loss probability", func() {
+		link.Loss = 1
+
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(read(transportB)).To(BeNil())
+	})
+
+	It("duplicates packets according to the link's duplication probability", func() {
+		link.Duplication = 1
+
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		for i := 0; i < 2; i++ {
+			p := read(transportB)
+			Expect(p).NotTo(BeNil())
+			p.Close()
+		}
+
+		Expect(read(transportB)).To(BeNil())
+	})
+
+	It("drops packets that are larger than the link's MTU", func() {
+		link.MTU = 576
+
+		write := func(n int) {
+			err := transportA.Write(&OutboundPacket{
+				Destination: Endpoint{
+					InterfaceIndex: ifaceA.Index,
+					Address:        IPv4GroupAddress,
+				},
+				Data: make([]byte, n),
+			})
+			Expect(err).ShouldNot(HaveOccurred())
+		}
+
+		// 20 byte IPv4 header, 8 byte UDP header
+		write(576 - 28)
+		p := read(transportB)
+		Expect(p).NotTo(BeNil())
+		p.Close()
+
+		write(576 - 27)
+		Expect(read(transportB)).To(BeNil())
+	})
+
+	It("can not send via interfaces on which it has not joined the multicast group", func() {
+		_, err := SendMulticast(transportA, &ifaceB, query)
+		Expect(err).Should(HaveOccurred())
+	})
+
+	It("can not join the multicast group on interfaces outside its network", func() {
+		Expect(transportA.Join(&ifaceB)).ShouldNot(Succeed())
+	})
+
+	It("returns errors like those of a closed socket once it is closed", func() {
+		Expect(transportA.Close()).To(Succeed())
+
+		_, err := transportA.Read()
+		Expect(err).To(MatchError(ContainSubstring("use of closed network connection")))
+
+		_, err = SendMulticast(transportA, &ifaceA, query)
+		Expect(err).To(MatchError(ContainSubstring("use of closed network connection")))
+
+		Expect(transportA.Join(&ifaceA)).To(MatchError(ContainSubstring("use of closed network connection")))
+	})
+
+	It("does not deliver multicast packets to the transport that sent them", func() {
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		p := read(transportB)
+		Expect(p).NotTo(BeNil())
+		p.Close()
+
+		Expect(read(transportA)).To(BeNil())
+	})
+
+	It("does not deliver multicast packets to transports that use a different port", func() {
+		transportB.Port = 12345
+
+		_, err := SendMulticast(transportA, &ifaceA, query)
+		Expect(err).ShouldNot(HaveOccurred())
+
+		Expect(read(transportB)).To(BeNil())
+	})
+})
+
+// readers is the channel of packets read from each transport by read().
+var (
+	readersM sync.Mutex
+	readers  = map[*VirtualTransport]chan *InboundPacket{}
+)
+
+// read returns the next packet received by t, or nil if none arrives within a
+// short period of real time.
+//
+// Packets are read by a single goroutine for each transport, which runs until
+// the transport is closed, so that a read that times out does not consume a
+// packet that arrives later.
+func read(t *VirtualTransport) *InboundPacket {
+	readersM.Lock()
+	c, ok := readers[t]
+	if !ok {
+		c = make(chan *InboundPacket, 100)
+		readers[t] = c
+
+		go func() {
+			defer func() {
+				readersM.Lock()
+				delete(readers, t)
+				readersM.Unlock()
+			}()
+
+			for {
+				p, err := t.Read()
+				if err != nil {
+					return
+				}
+
+				c <- p
+			}
+		}()
+	}
+	readersM.Unlock()
+
+	select {
+	case p := <-c:
+		return p
+	case <-time.After(100 * time.Millisecond):
+		return nil
+	}
+}